@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/modules"
+)
+
+// maxRequestSize bounds the body of an enqueue request
+const maxRequestSize = 1 << 20
+
+// apiQueues maps the queue names of the API paths to their modules
+var apiQueues = map[string]string{
+	"mail":   "pgb_mail",
+	"notify": "pgb_notify",
+}
+
+// enqueueResponse answers a successful enqueue request
+type enqueueResponse struct {
+	ID        int    `json:"id"`
+	StatusURL string `json:"status_url"`
+}
+
+// apiError is the body of a failed API request
+type apiError struct {
+	Error    string   `json:"error"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// enqueueAPI serves the HTTP API inserting mails and notifications into
+// the queues of the configured databases
+type enqueueAPI struct {
+	bridge *Bridge
+	tokens [][]byte
+}
+
+// registerAPI adds the enqueue API to mux:
+// POST /v1/{database}/{queue} enqueues an item and GET
+// /v1/{database}/{queue}/{id} returns its status; every request needs one
+// of the tokens as bearer token
+func registerAPI(mux *http.ServeMux, bridge *Bridge, tokens []string) {
+	api := &enqueueAPI{bridge: bridge}
+	for _, token := range tokens {
+		api.tokens = append(api.tokens, []byte(token))
+	}
+
+	mux.Handle("POST /v1/{database}/{queue}", api.authenticate(api.enqueue))
+	mux.Handle("GET /v1/{database}/{queue}/{id}", api.authenticate(api.status))
+}
+
+// authenticate rejects requests without a valid bearer token
+func (a *enqueueAPI) authenticate(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !a.validToken([]byte(token)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pgbridge"`)
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: "missing or invalid bearer token"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// validToken compares a token with every configured token in constant time
+func (a *enqueueAPI) validToken(token []byte) bool {
+	valid := false
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(t, token) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// queue resolves the database and queue of a request path
+func (a *enqueueAPI) queue(w http.ResponseWriter, r *http.Request) (modules.Queue, bool) {
+	database := r.PathValue("database")
+	moduleName, ok := apiQueues[r.PathValue("queue")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, apiError{Error: fmt.Sprintf("unknown queue '%s'", r.PathValue("queue"))})
+		return nil, false
+	}
+
+	pool, err := a.bridge.queuePool(database, moduleName)
+	switch {
+	case errors.Is(err, errDatabaseUnavailable):
+		writeJSON(w, http.StatusServiceUnavailable, apiError{Error: err.Error()})
+		return nil, false
+	case err != nil:
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		return nil, false
+	}
+
+	queue, err := modules.NewQueue(moduleName, pool, database)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		return nil, false
+	}
+	return queue, true
+}
+
+// enqueue inserts the request into the queue table and answers with the
+// id of the new item and where to poll its status
+func (a *enqueueAPI) enqueue(w http.ResponseWriter, r *http.Request) {
+	queue, ok := a.queue(w, r)
+	if !ok {
+		return
+	}
+
+	enqueuer, ok := queue.(modules.Enqueuer)
+	if !ok {
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "queue does not accept new items"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, apiError{Error: fmt.Sprintf("request body larger than %d bytes", maxRequestSize)})
+		return
+	}
+
+	id, err := enqueuer.Enqueue(r.Context(), body)
+	if err != nil {
+		var invalid *modules.ValidationError
+		if errors.As(err, &invalid) {
+			writeJSON(w, http.StatusUnprocessableEntity, apiError{Error: "invalid request", Problems: invalid.Problems})
+			return
+		}
+		a.bridge.Logger().LogSystemf(logger.LevelError, "api", "Failed to enqueue on %s/%s: %v", r.PathValue("database"), r.PathValue("queue"), err)
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to enqueue"})
+		return
+	}
+
+	statusURL := fmt.Sprintf("/v1/%s/%s/%d", r.PathValue("database"), r.PathValue("queue"), id)
+	w.Header().Set("Location", statusURL)
+	writeJSON(w, http.StatusCreated, enqueueResponse{ID: id, StatusURL: statusURL})
+}
+
+// status returns the state of an item
+func (a *enqueueAPI) status(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: fmt.Sprintf("invalid id '%s'", r.PathValue("id"))})
+		return
+	}
+
+	queue, ok := a.queue(w, r)
+	if !ok {
+		return
+	}
+
+	item, err := queue.GetItem(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSON(w, http.StatusNotFound, apiError{Error: fmt.Sprintf("item %d not found", id)})
+		return
+	}
+	if err != nil {
+		a.bridge.Logger().LogSystemf(logger.LevelError, "api", "Failed to get %s/%s/%d: %v", r.PathValue("database"), r.PathValue("queue"), id, err)
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to get item"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, item)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// loadAPITokens reads the bearer tokens of the API, one per line; empty
+// lines and lines starting with # are skipped
+func loadAPITokens(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open API tokens file: %w", err)
+	}
+	defer file.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read API tokens file: %w", err)
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("no tokens in API tokens file %s", path)
+	}
+	return tokens, nil
+}
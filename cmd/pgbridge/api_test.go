@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"pgbridge/internal/config"
+	"pgbridge/internal/logger"
+)
+
+func newTestAPI(t *testing.T) *http.ServeMux {
+	t.Helper()
+
+	bridge := NewBridge(nil, logger.NewLogger(serviceName, nil))
+	// Configured but never connected
+	bridge.managers["db1"] = newDatabaseManager(config.DatabaseConfig{
+		Name:             "db1",
+		ConnectionString: "postgres://u:p@localhost:5432/db1",
+		ActiveModules:    []string{"pgb_mail"},
+	}, bridge)
+
+	mux := http.NewServeMux()
+	registerAPI(mux, bridge, []string{"secret", "other"})
+	return mux
+}
+
+func apiRequest(mux *http.ServeMux, method, path, token, body string) (*httptest.ResponseRecorder, apiError) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var apiErr apiError
+	json.Unmarshal(rec.Body.Bytes(), &apiErr)
+	return rec, apiErr
+}
+
+func TestAPI_Authentication(t *testing.T) {
+	mux := newTestAPI(t)
+
+	for _, token := range []string{"", "wrong", "secre"} {
+		rec, _ := apiRequest(mux, "POST", "/v1/db1/mail", token, "{}")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: expected 401, got %d", token, rec.Code)
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q: expected a WWW-Authenticate header", token)
+		}
+	}
+
+	// Both configured tokens are accepted
+	for _, token := range []string{"secret", "other"} {
+		rec, _ := apiRequest(mux, "POST", "/v1/db1/mail", token, "{}")
+		if rec.Code == http.StatusUnauthorized {
+			t.Errorf("token %q: expected to be accepted", token)
+		}
+	}
+}
+
+func TestAPI_Routing(t *testing.T) {
+	mux := newTestAPI(t)
+
+	cases := []struct {
+		method, path string
+		code         int
+		error        string
+	}{
+		{"POST", "/v1/db1/sms", http.StatusNotFound, "unknown queue 'sms'"},
+		{"POST", "/v1/db2/mail", http.StatusNotFound, "unknown database 'db2'"},
+		{"POST", "/v1/db1/notify", http.StatusNotFound, "module pgb_notify is not active on db1"},
+		{"POST", "/v1/db1/mail", http.StatusServiceUnavailable, "database unavailable: db1"},
+		{"GET", "/v1/db1/mail/abc", http.StatusBadRequest, "invalid id 'abc'"},
+		{"GET", "/v1/db1/mail/0", http.StatusBadRequest, "invalid id '0'"},
+		{"GET", "/v1/db1/mail/1", http.StatusServiceUnavailable, "database unavailable: db1"},
+	}
+
+	for _, c := range cases {
+		rec, apiErr := apiRequest(mux, c.method, c.path, "secret", "{}")
+		if rec.Code != c.code {
+			t.Errorf("%s %s: expected %d, got %d", c.method, c.path, c.code, rec.Code)
+		}
+		if apiErr.Error != c.error {
+			t.Errorf("%s %s: expected error %q, got %q", c.method, c.path, c.error, apiErr.Error)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: expected a JSON response, got %q", c.method, c.path, ct)
+		}
+	}
+}
+
+func TestLoadAPITokens(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "tokens")
+	os.WriteFile(path, []byte("# deploy\nsecret\n\n  other  \n"), 0600)
+	tokens, err := loadAPITokens(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(tokens, []string{"secret", "other"}) {
+		t.Errorf("Unexpected tokens %v", tokens)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	os.WriteFile(empty, []byte("# nothing\n"), 0600)
+	if _, err := loadAPITokens(empty); err == nil {
+		t.Error("Expected an error for a file without tokens")
+	}
+
+	if _, err := loadAPITokens(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestCLI_APITokensNeedHTTP(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@localhost:5432/db1, [pgb_mail]\n")
+
+	code, _, stderr := runArgs("run", "--api-tokens-file", "tokens", path)
+	if code != exitUsage || !strings.Contains(stderr, "--http-addr") {
+		t.Errorf("Expected a usage error, got %d %q", code, stderr)
+	}
+}
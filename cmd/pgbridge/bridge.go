@@ -0,0 +1,630 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/config"
+	"pgbridge/internal/database"
+	"pgbridge/internal/health"
+	"pgbridge/internal/leader"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/tracing"
+)
+
+// Bridge runs one DatabaseManager per configured database and applies
+// configuration changes to the running set
+type Bridge struct {
+	// Strict makes Start fail when any database or module cannot be
+	// started, instead of running degraded
+	Strict bool
+	// CentralConfigPath is the file with the central database connection
+	// string, used by modules that need the central database
+	CentralConfigPath string
+	// LeaderElection makes every database processed by one instance only:
+	// the one holding its advisory lock; the others stand by
+	LeaderElection bool
+	// LeaderInterval is how often a standby tries to take over
+	LeaderInterval time.Duration
+	// SchemaCheck is off, report or repair: what to do about schema drift
+	// found when a database starts processing
+	SchemaCheck string
+	// LogConfig configures how pgb_log is created and how long its rows
+	// are kept
+	LogConfig database.LogConfig
+
+	managers     map[string]*DatabaseManager
+	order        []string
+	running      atomic.Pointer[[]*DatabaseManager]
+	loadConfig   func() (*config.Config, error)
+	systemLogger *logger.Logger
+	logger       atomic.Pointer[logger.Logger]
+	logDatabase  string
+	centralPool  *pgxpool.Pool
+	watcher      *configWatcher
+	draining     bool
+	mu           sync.Mutex
+}
+
+// degradedRetryDelay is the pause before starting over when a degraded
+// database is reachable again but still fails to start
+const degradedRetryDelay = 30 * time.Second
+
+// NewBridge creates a bridge; loadConfig is used to re-read the
+// configuration on reload
+func NewBridge(loadConfig func() (*config.Config, error), systemLogger *logger.Logger) *Bridge {
+	return &Bridge{
+		managers:     make(map[string]*DatabaseManager),
+		loadConfig:   loadConfig,
+		systemLogger: systemLogger,
+	}
+}
+
+// Start starts every database of the configuration
+// Databases that cannot be started are retried in the background, unless
+// Strict is set
+func (b *Bridge) Start(ctx context.Context, cfg *config.Config) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, dbConfig := range cfg.Databases {
+		b.systemLogger.LogSystemf(logger.LevelInfo, "main", "Setting up database: %s (%d/%d)", dbConfig.Name, i+1, len(cfg.Databases))
+
+		if err := b.startDatabase(ctx, dbConfig, b.Strict); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startDatabase connects to a database and starts its modules
+// With failFast, everything started for the database is stopped again on
+// failure and the error is returned; otherwise the database is marked
+// degraded and retried in the background
+func (b *Bridge) startDatabase(ctx context.Context, dbConfig config.DatabaseConfig, failFast bool) error {
+	mgr := newDatabaseManager(dbConfig, b)
+
+	if err := b.activate(ctx, mgr, failFast); err != nil {
+		if failFast {
+			b.systemLogger.LogSystemf(logger.LevelError, "main", "%v", err)
+			mgr.stop(ctx)
+			b.detachLogger(dbConfig.Name)
+			return err
+		}
+
+		mgr.reset(ctx)
+		b.detachLogger(dbConfig.Name)
+		b.register(mgr)
+		b.degrade(ctx, mgr, err)
+		return nil
+	}
+
+	b.register(mgr)
+	if mgr.isStandby() {
+		b.systemLogger.LogSystemf(logger.LevelInfo, "main", "Database %s ready, waiting for leadership", dbConfig.Name)
+	} else {
+		b.systemLogger.LogSystemf(logger.LevelInfo, "main", "Database %s ready with %d modules", dbConfig.Name, len(mgr.moduleNames()))
+	}
+
+	return nil
+}
+
+// activate connects a database manager, initializes the pgb schema and
+// starts its modules
+func (b *Bridge) activate(ctx context.Context, mgr *DatabaseManager, failFast bool) error {
+	if err := mgr.connect(ctx); err != nil {
+		return err
+	}
+
+	// The first database also receives pgb_log entries of the service itself
+	if b.logger.Load() == nil {
+		dbLogger := logger.NewLogger(serviceName, mgr.connMgr.GetPool())
+		dbLogger.Start(ctx)
+		b.logger.Store(dbLogger)
+		b.logDatabase = mgr.name
+		b.systemLogger.LogSystemf(logger.LevelInfo, "main", "Database logging initialized on: %s", mgr.name)
+	} else if b.logDatabase == "" {
+		b.logger.Load().SetPool(mgr.connMgr.GetPool())
+		b.logDatabase = mgr.name
+		b.systemLogger.LogSystemf(logger.LevelInfo, "main", "Database logging moved to: %s", mgr.name)
+	}
+	mgr.logger = b.logger.Load()
+
+	return mgr.start(ctx, failFast)
+}
+
+// register adds a database manager to the running set
+func (b *Bridge) register(mgr *DatabaseManager) {
+	b.managers[mgr.name] = mgr
+	b.order = append(b.order, mgr.name)
+	b.publish()
+}
+
+// publish updates the running set seen by databases
+func (b *Bridge) publish() {
+	running := make([]*DatabaseManager, 0, len(b.order))
+	for _, name := range b.order {
+		running = append(running, b.managers[name])
+	}
+	b.running.Store(&running)
+}
+
+// databases returns the running database managers in configuration order
+// without waiting for the bridge lock, which is held while databases are
+// started and stopped
+func (b *Bridge) databases() []*DatabaseManager {
+	if running := b.running.Load(); running != nil {
+		return *running
+	}
+	return nil
+}
+
+// degrade marks a database that could not be started and retries it in the
+// background
+func (b *Bridge) degrade(ctx context.Context, mgr *DatabaseManager, err error) {
+	mgr.setDegraded(true)
+	b.log().LogDBDegraded(mgr.name, err)
+	go b.recoverDatabase(ctx, mgr)
+}
+
+// recoverDatabase waits for a degraded database to become reachable, using
+// the exponential backoff of ConnectionManager.Reconnect, then starts its
+// modules. It gives up when the database is stopped or removed.
+func (b *Bridge) recoverDatabase(ctx context.Context, mgr *DatabaseManager) {
+	for {
+		if err := mgr.connMgr.Reconnect(); err != nil {
+			return
+		}
+
+		b.mu.Lock()
+		if b.managers[mgr.name] != mgr {
+			// Stopped or removed while reconnecting
+			b.mu.Unlock()
+			mgr.connMgr.Disconnect()
+			return
+		}
+
+		err := b.activate(ctx, mgr, false)
+		if err == nil {
+			mgr.setDegraded(false)
+			b.log().LogDBRecovered(mgr.name, len(mgr.moduleNames()))
+			b.mu.Unlock()
+			return
+		}
+
+		mgr.reset(ctx)
+		b.detachLogger(mgr.name)
+		b.mu.Unlock()
+
+		b.log().LogSystemf(logger.LevelWarn, "main", "Database %s is still degraded: %v", mgr.name, err)
+
+		// Reconnected but could not start: wait before starting over
+		select {
+		case <-mgr.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(degradedRetryDelay):
+		}
+	}
+}
+
+// followLeadership starts or stops processing a database after its
+// elector acquired or lost the lock
+func (b *Bridge) followLeadership(ctx context.Context, mgr *DatabaseManager, elector *leader.Elector) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Stopped, removed or reset in the meantime, or shutting down
+	if b.managers[mgr.name] != mgr || mgr.elector != elector || b.draining {
+		return
+	}
+
+	mgr.followLeadership(ctx)
+}
+
+// recampaign campaigns for a database again after a failed takeover, once
+// the elector interval passed, so a database that cannot be taken over
+// does not open election sessions in a loop. It gives up when the database
+// is stopped or removed meanwhile.
+func (b *Bridge) recampaign(ctx context.Context, mgr *DatabaseManager) {
+	select {
+	case <-mgr.done:
+		return
+	case <-ctx.Done():
+		return
+	case <-time.After(b.leaderInterval()):
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Stopped, removed or reset in the meantime, or shutting down
+	if b.managers[mgr.name] != mgr || mgr.elector != nil || b.draining {
+		return
+	}
+
+	mgr.campaign(ctx)
+}
+
+// leaderInterval returns the interval of the electors
+func (b *Bridge) leaderInterval() time.Duration {
+	if b.LeaderInterval <= 0 {
+		return leader.DefaultInterval
+	}
+	return b.LeaderInterval
+}
+
+// stopDatabase drains and stops a running database
+func (b *Bridge) stopDatabase(ctx context.Context, name string) {
+	mgr, ok := b.managers[name]
+	if !ok {
+		return
+	}
+
+	mgr.stop(ctx)
+	delete(b.managers, name)
+	for i, n := range b.order {
+		if n == name {
+			b.order = append(b.order[:i], b.order[i+1:]...)
+			break
+		}
+	}
+	b.publish()
+
+	b.detachLogger(name)
+}
+
+// detachLogger moves database logging off a database that is going away,
+// to the first remaining database if any
+func (b *Bridge) detachLogger(name string) {
+	dbLogger := b.logger.Load()
+	if dbLogger == nil || b.logDatabase != name {
+		return
+	}
+
+	b.logDatabase = ""
+	dbLogger.SetPool(nil)
+	for _, n := range b.order {
+		if mgr, ok := b.managers[n]; ok && !mgr.isDegraded() && mgr.connMgr.GetPool() != nil {
+			dbLogger.SetPool(mgr.connMgr.GetPool())
+			b.logDatabase = n
+			b.systemLogger.LogSystemf(logger.LevelInfo, "main", "Database logging moved to: %s", n)
+			return
+		}
+	}
+}
+
+// Reload re-reads the configuration and applies the differences to the
+// running databases. On error the running configuration is kept.
+func (b *Bridge) Reload(ctx context.Context) error {
+	b.log().LogSystemf(logger.LevelInfo, "main", "Reloading configuration")
+
+	cfg, err := b.loadConfig()
+	if err != nil {
+		b.log().LogConfigError(fmt.Errorf("reload failed, keeping running configuration: %w", err))
+		return err
+	}
+
+	b.Apply(ctx, cfg)
+	return nil
+}
+
+// Apply brings the running databases in line with cfg: added databases and
+// modules are started, removed ones are drained and stopped, and databases
+// whose connection string changed are reconnected. Untouched databases keep
+// running. Failures are logged and retried on the next reload.
+func (b *Bridge) Apply(ctx context.Context, cfg *config.Config) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	diff := config.Diff(b.runningConfig(), cfg)
+	if diff.IsEmpty() {
+		b.log().LogSystemf(logger.LevelInfo, "main", "Configuration unchanged")
+		return
+	}
+
+	for _, dbConfig := range diff.Removed {
+		b.log().LogSystemf(logger.LevelInfo, "main", "Database %s removed from configuration", dbConfig.Name)
+		b.stopDatabase(ctx, dbConfig.Name)
+	}
+
+	for _, change := range diff.Changed {
+		name := change.New.Name
+
+		if change.ConnectionChanged {
+			b.log().LogSystemf(logger.LevelInfo, "main", "Connection settings of %s changed, reconnecting", name)
+			b.stopDatabase(ctx, name)
+			b.startDatabase(ctx, change.New, false)
+			continue
+		}
+
+		mgr := b.managers[name]
+		mgr.setConfig(change.New)
+
+		// A degraded or standby database starts the new module set once it
+		// recovers or takes over
+		if mgr.isDegraded() || mgr.isStandby() {
+			continue
+		}
+
+		for _, moduleName := range append(change.RemovedModules, change.ChangedModules...) {
+			mgr.removeModule(ctx, moduleName)
+		}
+		for _, moduleName := range append(change.AddedModules, change.ChangedModules...) {
+			if err := mgr.addModule(ctx, moduleName); err != nil {
+				b.log().LogSystemf(logger.LevelError, "main", "Failed to start module %s/%s: %v", name, moduleName, err)
+				mgr.removeModule(ctx, moduleName)
+			}
+		}
+	}
+
+	for _, dbConfig := range diff.Added {
+		b.log().LogSystemf(logger.LevelInfo, "main", "Database %s added to configuration", dbConfig.Name)
+		b.startDatabase(ctx, dbConfig, false)
+	}
+
+	b.log().LogConfigReload(len(diff.Added), len(diff.Removed), len(diff.Changed))
+}
+
+// runningConfig returns the configuration of the databases and modules
+// that are actually running, so anything that failed to start is seen as
+// added on the next reload and retried. Degraded and standby databases
+// report their configured modules; they start them later anyway.
+func (b *Bridge) runningConfig() *config.Config {
+	cfg := &config.Config{}
+	for _, name := range b.order {
+		mgr := b.managers[name]
+		dbConfig := mgr.config
+		if !mgr.isDegraded() && !mgr.isStandby() {
+			dbConfig.ActiveModules = mgr.moduleNames()
+		}
+		cfg.Databases = append(cfg.Databases, dbConfig)
+	}
+	return cfg
+}
+
+// errDatabaseUnavailable is returned for a configured database that is not
+// connected
+var errDatabaseUnavailable = errors.New("database unavailable")
+
+// queuePool returns the pool of a database whose configuration includes
+// the module, for inserting into the module's queue
+func (b *Bridge) queuePool(database, module string) (*pgxpool.Pool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	mgr, ok := b.managers[database]
+	if !ok {
+		return nil, fmt.Errorf("unknown database '%s'", database)
+	}
+	if !slices.Contains(mgr.config.ActiveModules, module) {
+		return nil, fmt.Errorf("module %s is not active on %s", module, database)
+	}
+
+	pool := mgr.connMgr.GetPool()
+	if mgr.isDegraded() || pool == nil {
+		return nil, fmt.Errorf("%w: %s", errDatabaseUnavailable, database)
+	}
+	return pool, nil
+}
+
+// getCentralPool returns the shared connection pool to the central database,
+// creating it on first use
+func (b *Bridge) getCentralPool(ctx context.Context) (*pgxpool.Pool, error) {
+	if b.centralPool != nil {
+		return b.centralPool, nil
+	}
+
+	centralPool, err := openCentralPool(ctx, b.CentralConfigPath, b.log())
+	if err != nil {
+		return nil, err
+	}
+
+	b.centralPool = centralPool
+	return centralPool, nil
+}
+
+// openCentralPool connects to the central database whose connection string
+// is read from path (the default location when empty)
+func openCentralPool(ctx context.Context, path string, log *logger.Logger) (*pgxpool.Pool, error) {
+	if path == "" {
+		path = defaultCentralConfigPath
+	}
+
+	centralConfig, err := config.LoadCentralConfig(path, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load central config: %w", err)
+	}
+
+	// Create connection to central database
+	poolConfig, err := pgxpool.ParseConfig(centralConfig.ConnectionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to central database: %w", err)
+	}
+	tracing.TracePool(poolConfig, "central")
+
+	centralPool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to central database: %w", err)
+	}
+
+	return centralPool, nil
+}
+
+// DatabaseCount returns the number of running databases
+func (b *Bridge) DatabaseCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.managers)
+}
+
+// DegradedDatabases returns the names of the databases waiting to be started
+func (b *Bridge) DegradedDatabases() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var names []string
+	for _, name := range b.order {
+		if b.managers[name].isDegraded() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Health reports the state of every database and module; it does not wait
+// for databases being started or stopped
+func (b *Bridge) Health() health.Report {
+	running := b.databases()
+
+	report := health.Report{Databases: make([]health.DatabaseStatus, 0, len(running))}
+	for _, mgr := range running {
+		report.Databases = append(report.Databases, mgr.health())
+	}
+	return report
+}
+
+// Stalled names the health checks and listeners that stopped making
+// progress; degraded databases are retried separately. A database being
+// started or stopped does not hold up the watchdog.
+func (b *Bridge) Stalled(now time.Time) []string {
+	var stalled []string
+	for _, mgr := range b.databases() {
+		if mgr.isDegraded() {
+			continue
+		}
+		if mgr.connMgr.Stalled(now) {
+			stalled = append(stalled, mgr.name+" health check")
+		}
+		if dispatcher := mgr.getDispatcher(); dispatcher != nil && dispatcher.Stalled(now) {
+			stalled = append(stalled, mgr.name+" listener")
+		}
+	}
+	return stalled
+}
+
+// ConnectionStats returns the pool statistics of every database
+func (b *Bridge) ConnectionStats() map[string]*database.ConnectionStats {
+	running := b.databases()
+
+	stats := make(map[string]*database.ConnectionStats, len(running))
+	for _, mgr := range running {
+		stats[mgr.name] = mgr.connMgr.GetStats()
+	}
+	return stats
+}
+
+// Logger returns the service logger
+func (b *Bridge) Logger() *logger.Logger {
+	return b.log()
+}
+
+// log returns the database-backed logger once available, the system
+// logger before that
+func (b *Bridge) log() *logger.Logger {
+	if dbLogger := b.logger.Load(); dbLogger != nil {
+		return dbLogger
+	}
+	return b.systemLogger
+}
+
+// Drain stops accepting notifications on every database and waits until
+// ctx is done for queued and in-flight ones to finish; whatever is left is
+// cancelled. The outcome is logged as a SHUTDOWN_DRAIN event.
+func (b *Bridge) Drain(ctx context.Context) {
+	b.stopWatching()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Leaders keep their lock until Shutdown, so no standby takes over
+	// while queued notifications finish; standby databases step aside
+	b.draining = true
+	for _, name := range b.order {
+		mgr := b.managers[name]
+		if mgr.isStandby() {
+			mgr.stopElection()
+		}
+		mgr.stopListening(ctx)
+	}
+
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	drained, aborted := 0, 0
+	details := make(map[string]interface{})
+	var detailsMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, name := range b.order {
+		mgr := b.managers[name]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats := mgr.drain(ctx)
+
+			detailsMu.Lock()
+			defer detailsMu.Unlock()
+			for moduleName, s := range stats {
+				drained += s.Drained
+				aborted += s.Aborted
+				details[name+"/"+moduleName] = map[string]interface{}{
+					"drained": s.Drained,
+					"aborted": s.Aborted,
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	b.log().LogShutdownDrain(drained, aborted, timeout, details)
+}
+
+// stopWatching stops following central configuration changes; this waits
+// for a running reload, which needs b.mu
+func (b *Bridge) stopWatching() {
+	b.mu.Lock()
+	watcher := b.watcher
+	b.watcher = nil
+	b.mu.Unlock()
+
+	if watcher != nil {
+		watcher.stop()
+	}
+}
+
+// Shutdown stops every database and closes the central connection; work
+// still queued gets until ctx is done. Pending database log entries are
+// flushed before the logging database is disconnected.
+func (b *Bridge) Shutdown(ctx context.Context) {
+	b.stopWatching()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := len(b.order) - 1; i >= 0; i-- {
+		if name := b.order[i]; name != b.logDatabase {
+			b.stopDatabase(ctx, name)
+		}
+	}
+
+	if dbLogger := b.logger.Load(); dbLogger != nil {
+		dbLogger.Shutdown()
+	}
+	b.stopDatabase(ctx, b.logDatabase)
+
+	if b.centralPool != nil {
+		b.centralPool.Close()
+		b.centralPool = nil
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pgbridge/internal/config"
+	"pgbridge/internal/database"
+	"pgbridge/internal/leader"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/tracing"
+)
+
+const (
+	// defaultCentralConfigPath holds the connection string of the central
+	// database in --db-config mode
+	defaultCentralConfigPath = "/etc/pgbridge/central.conf"
+)
+
+// errUsage is returned for invalid flags that were already reported
+var errUsage = errors.New("invalid usage")
+
+// options holds the flags shared by the subcommands; every flag can be set
+// through its environment variable, and an explicit flag wins
+type options struct {
+	configPath        string
+	dbConfig          bool
+	centralConfigPath string
+	shutdownTimeout   time.Duration
+	strict            bool
+	leaderElection    bool
+	leaderInterval    time.Duration
+	schemaCheck       string
+	logPartitioning   bool
+	logRetentionDays  int
+	logArchiveSchema  string
+	traceExporter     string
+	traceEndpoint     string
+	traceFile         string
+	httpAddr          string
+	apiTokensFile     string
+
+	fs     *flag.FlagSet
+	envErr error
+}
+
+// newOptions creates the flag set of a subcommand
+func newOptions(name, usage string, stderr io.Writer) *options {
+	o := &options{fs: flag.NewFlagSet(name, flag.ContinueOnError)}
+	o.fs.SetOutput(stderr)
+	o.fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s %s %s\n\nFlags:\n", serviceName, name, usage)
+		o.fs.PrintDefaults()
+	}
+	return o
+}
+
+// sourceFlags adds the flags selecting the configuration source
+func (o *options) sourceFlags() {
+	o.fs.StringVar(&o.configPath, "config", o.envString("PGBRIDGE_CONFIG", ""),
+		"configuration file (env PGBRIDGE_CONFIG); may also be given as argument")
+	o.fs.BoolVar(&o.dbConfig, "db-config", o.envBool("PGBRIDGE_DB_CONFIG", false),
+		"load the configuration from the central database (env PGBRIDGE_DB_CONFIG)")
+	o.fs.StringVar(&o.centralConfigPath, "central-config", o.envString("PGBRIDGE_CENTRAL_CONFIG", defaultCentralConfigPath),
+		"file with the central database connection string (env PGBRIDGE_CENTRAL_CONFIG)")
+}
+
+// runFlags adds the flags of the daemon
+func (o *options) runFlags() {
+	o.fs.DurationVar(&o.shutdownTimeout, "shutdown-timeout", o.envDuration("PGBRIDGE_SHUTDOWN_TIMEOUT", defaultShutdownTimeout),
+		"how long shutdown waits for in-flight notifications (env PGBRIDGE_SHUTDOWN_TIMEOUT)")
+	o.fs.BoolVar(&o.strict, "strict", o.envBool("PGBRIDGE_STRICT", false),
+		"fail at startup if any database or module cannot be started (env PGBRIDGE_STRICT)")
+	o.fs.BoolVar(&o.leaderElection, "leader-election", o.envBool("PGBRIDGE_LEADER_ELECTION", false),
+		"process each database only while holding its advisory lock, so several instances can run for redundancy (env PGBRIDGE_LEADER_ELECTION)")
+	o.fs.DurationVar(&o.leaderInterval, "leader-interval", o.envDuration("PGBRIDGE_LEADER_INTERVAL", leader.DefaultInterval),
+		"how often a standby tries to take over and the leader checks its lock session (env PGBRIDGE_LEADER_INTERVAL)")
+	o.fs.StringVar(&o.schemaCheck, "schema-check", o.envString("PGBRIDGE_SCHEMA_CHECK", schemaCheckReport),
+		"compare the pgb schema with the modules when a database starts: "+strings.Join(schemaCheckModes, ", ")+" (env PGBRIDGE_SCHEMA_CHECK)")
+	o.fs.StringVar(&o.traceExporter, "trace-exporter", o.envString("PGBRIDGE_TRACE_EXPORTER", tracing.ExporterNone),
+		"export OpenTelemetry spans: "+strings.Join(tracing.Exporters, ", ")+" (env PGBRIDGE_TRACE_EXPORTER)")
+	o.fs.StringVar(&o.traceEndpoint, "trace-endpoint", o.envString("PGBRIDGE_TRACE_ENDPOINT", ""),
+		"OTLP/HTTP endpoint URL of the otlp exporter, e.g. http://collector:4318; OTEL_EXPORTER_OTLP_* apply when empty (env PGBRIDGE_TRACE_ENDPOINT)")
+	o.fs.StringVar(&o.traceFile, "trace-file", o.envString("PGBRIDGE_TRACE_FILE", ""),
+		"file the file exporter appends spans to as JSON (env PGBRIDGE_TRACE_FILE)")
+}
+
+// logFlags adds the flags configuring pgb_log
+func (o *options) logFlags() {
+	o.fs.BoolVar(&o.logPartitioning, "log-partitioning", o.envBool("PGBRIDGE_LOG_PARTITIONING", false),
+		"create pgb_log partitioned by day, converting an existing plain table (env PGBRIDGE_LOG_PARTITIONING)")
+	o.fs.IntVar(&o.logRetentionDays, "log-retention-days", o.envInt("PGBRIDGE_LOG_RETENTION_DAYS", 0),
+		"days pgb_log rows are kept; 0 keeps them forever (env PGBRIDGE_LOG_RETENTION_DAYS)")
+	o.fs.StringVar(&o.logArchiveSchema, "log-archive-schema", o.envString("PGBRIDGE_LOG_ARCHIVE_SCHEMA", ""),
+		"move expired pgb_log partitions to this schema instead of dropping them (env PGBRIDGE_LOG_ARCHIVE_SCHEMA)")
+}
+
+// logConfig returns the pgb_log configuration
+func (o *options) logConfig() database.LogConfig {
+	return database.LogConfig{
+		Partitioned:   o.logPartitioning,
+		Retention:     time.Duration(o.logRetentionDays) * 24 * time.Hour,
+		ArchiveSchema: o.logArchiveSchema,
+	}
+}
+
+// tracing returns the tracing configuration of the daemon
+func (o *options) tracing() tracing.Config {
+	return tracing.Config{
+		Exporter:       o.traceExporter,
+		Endpoint:       o.traceEndpoint,
+		File:           o.traceFile,
+		ServiceName:    serviceName,
+		ServiceVersion: version,
+	}
+}
+
+// httpFlags adds the address of the HTTP endpoints
+func (o *options) httpFlags(usage string) {
+	o.fs.StringVar(&o.httpAddr, "http-addr", o.envString("PGBRIDGE_HTTP_ADDR", ""), usage+" (env PGBRIDGE_HTTP_ADDR)")
+}
+
+// apiFlags adds the flags of the HTTP enqueue API
+func (o *options) apiFlags() {
+	o.fs.StringVar(&o.apiTokensFile, "api-tokens-file", o.envString("PGBRIDGE_API_TOKENS_FILE", ""),
+		"file with the bearer tokens of the HTTP enqueue API, one per line; enables the API on --http-addr (env PGBRIDGE_API_TOKENS_FILE)")
+}
+
+// parse parses the arguments; with acceptsFile a single positional
+// argument is taken as the configuration file
+func (o *options) parse(args []string, acceptsFile bool) error {
+	if err := o.parseFlags(args); err != nil {
+		return err
+	}
+
+	// The argument replaces PGBRIDGE_CONFIG, but not an explicit --config
+	switch {
+	case o.fs.NArg() == 0:
+	case o.fs.NArg() == 1 && acceptsFile && !o.isSet("config"):
+		o.configPath = o.fs.Arg(0)
+	default:
+		return fmt.Errorf("unexpected arguments: %v", o.fs.Args())
+	}
+
+	if o.shutdownTimeout < 0 {
+		return fmt.Errorf("invalid shutdown timeout %s: expected a positive duration such as 30s", o.shutdownTimeout)
+	}
+	if o.leaderInterval < 0 {
+		return fmt.Errorf("invalid leader interval %s: expected a positive duration such as 5s", o.leaderInterval)
+	}
+	if o.logRetentionDays < 0 {
+		return fmt.Errorf("invalid log retention %d: expected 0 or more days", o.logRetentionDays)
+	}
+	if o.logArchiveSchema != "" && (!o.logPartitioning || o.logRetentionDays == 0) {
+		return fmt.Errorf("--log-archive-schema needs --log-partitioning and --log-retention-days")
+	}
+	if o.logArchiveSchema == "pgb" {
+		return fmt.Errorf("--log-archive-schema must not be the pgb schema")
+	}
+	if err := o.tracing().Check(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseFlags parses the flags and leaves the positional arguments in
+// o.fs.Args()
+func (o *options) parseFlags(args []string) error {
+	if o.envErr != nil {
+		return o.envErr
+	}
+	if err := o.fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		// Already reported by the flag package, with the usage
+		return errUsage
+	}
+	return nil
+}
+
+// isSet returns whether a flag was given on the command line
+func (o *options) isSet(name string) bool {
+	set := false
+	o.fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// checkSource verifies that exactly one configuration source was selected
+func (o *options) checkSource() error {
+	if o.dbConfig && o.configPath != "" {
+		return fmt.Errorf("--config and --db-config are mutually exclusive")
+	}
+	if !o.dbConfig && o.configPath == "" {
+		return fmt.Errorf("no configuration source: pass a configuration file or --db-config")
+	}
+	return nil
+}
+
+// configLoader returns a function loading and validating the configuration
+// from the selected source; it is called again on every reload
+func (o *options) configLoader(log *logger.Logger) func() (*config.Config, error) {
+	load := func() (*config.Config, error) {
+		cfg, err := config.LoadConfig(o.configPath, log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+		return cfg, nil
+	}
+
+	if o.dbConfig {
+		load = func() (*config.Config, error) {
+			centralConfig, err := config.LoadCentralConfig(o.centralConfigPath, log)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load central config: %w", err)
+			}
+
+			cfg, err := config.LoadConfigFromDatabase(centralConfig.ConnectionString, log)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load configuration from database: %w", err)
+			}
+			return cfg, nil
+		}
+	}
+
+	// Every configured module must be registered
+	return func() (*config.Config, error) {
+		cfg, err := load()
+		if err != nil {
+			return nil, err
+		}
+		if err := modules.Validate(cfg); err != nil {
+			return nil, fmt.Errorf("configuration validation failed: %w", err)
+		}
+		return cfg, nil
+	}
+}
+
+// envString returns the value of an environment variable, or def
+func (o *options) envString(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// envBool parses a boolean environment variable
+func (o *options) envBool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		o.setEnvError(fmt.Errorf("invalid %s '%s': expected true or false", name, value))
+		return def
+	}
+	return b
+}
+
+// envInt parses a non-negative integer environment variable
+func (o *options) envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		o.setEnvError(fmt.Errorf("invalid %s '%s': expected 0 or more", name, value))
+		return def
+	}
+	return n
+}
+
+// envDuration parses a positive duration environment variable
+func (o *options) envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		o.setEnvError(fmt.Errorf("invalid %s '%s': expected a positive duration such as 30s", name, value))
+		return def
+	}
+	return d
+}
+
+// setEnvError records the first invalid environment variable
+func (o *options) setEnvError(err error) {
+	if o.envErr == nil {
+		o.envErr = err
+	}
+}
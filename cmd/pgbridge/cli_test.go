@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pgbridge/internal/health"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pgbridge.conf")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func runArgs(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := runCLI(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLI_Version(t *testing.T) {
+	code, stdout, _ := runArgs("version")
+	if code != exitOK {
+		t.Errorf("Expected exit %d, got %d", exitOK, code)
+	}
+	if !strings.Contains(stdout, version) {
+		t.Errorf("Expected version in output, got %q", stdout)
+	}
+}
+
+func TestCLI_UnknownCommand(t *testing.T) {
+	code, _, stderr := runArgs("frobnicate")
+	if code != exitUsage {
+		t.Errorf("Expected exit %d, got %d", exitUsage, code)
+	}
+	if !strings.Contains(stderr, "Unknown command") {
+		t.Errorf("Expected unknown command message, got %q", stderr)
+	}
+}
+
+func TestCLI_NoArguments(t *testing.T) {
+	if code, _, _ := runArgs(); code != exitUsage {
+		t.Errorf("Expected exit %d, got %d", exitUsage, code)
+	}
+}
+
+func TestCLI_Validate(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@localhost:5432/db1, [pgb_mail(workers=8), pgb_notify]\n")
+
+	code, stdout, stderr := runArgs("validate", path)
+	if code != exitOK {
+		t.Fatalf("Expected exit %d, got %d: %s", exitOK, code, stderr)
+	}
+	if !strings.Contains(stdout, "db1: pgb_mail, pgb_notify") {
+		t.Errorf("Expected module summary, got %q", stdout)
+	}
+
+	// The --config flag is equivalent to the argument
+	if code, _, stderr := runArgs("validate", "--config", path); code != exitOK {
+		t.Errorf("Expected exit %d with --config, got %d: %s", exitOK, code, stderr)
+	}
+}
+
+func TestCLI_ValidateErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown module": "db1, postgres://u:p@localhost:5432/db1, [pgb_unknown]\n",
+		"bad option":     "db1, postgres://u:p@localhost:5432/db1, [pgb_mail(workers=many)]\n",
+		"negative sweep": "db1, postgres://u:p@localhost:5432/db1, [pgb_mail(sweep_interval=-1s)]\n",
+		"malformed":      "db1 postgres\n",
+	}
+
+	for name, content := range cases {
+		t.Run(name, func(t *testing.T) {
+			if code, _, _ := runArgs("validate", writeConfig(t, content)); code != exitError {
+				t.Errorf("Expected exit %d, got %d", exitError, code)
+			}
+		})
+	}
+}
+
+func TestCLI_ValidateRequiresSource(t *testing.T) {
+	t.Setenv("PGBRIDGE_CONFIG", "")
+	t.Setenv("PGBRIDGE_DB_CONFIG", "")
+
+	if code, _, _ := runArgs("validate"); code != exitUsage {
+		t.Errorf("Expected exit %d without a source, got %d", exitUsage, code)
+	}
+	if code, _, _ := runArgs("validate", "--db-config", "--config", "x.conf"); code != exitUsage {
+		t.Errorf("Expected exit %d with two sources, got %d", exitUsage, code)
+	}
+}
+
+func TestCLI_EnvironmentOverrides(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@localhost:5432/db1, [pgb_mail]\n")
+	t.Setenv("PGBRIDGE_CONFIG", path)
+
+	if code, _, stderr := runArgs("validate"); code != exitOK {
+		t.Errorf("Expected PGBRIDGE_CONFIG to select the file, got exit %d: %s", code, stderr)
+	}
+
+	t.Setenv("PGBRIDGE_SHUTDOWN_TIMEOUT", "1m")
+	o := newOptions("run", "", &bytes.Buffer{})
+	o.runFlags()
+	if err := o.parse(nil, false); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if o.shutdownTimeout != time.Minute {
+		t.Errorf("Expected shutdown timeout from environment, got %s", o.shutdownTimeout)
+	}
+
+	// An explicit flag wins over the environment
+	o = newOptions("run", "", &bytes.Buffer{})
+	o.runFlags()
+	if err := o.parse([]string{"--shutdown-timeout", "5s"}, false); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if o.shutdownTimeout != 5*time.Second {
+		t.Errorf("Expected flag to override environment, got %s", o.shutdownTimeout)
+	}
+}
+
+func TestCLI_LeaderElection(t *testing.T) {
+	t.Setenv("PGBRIDGE_LEADER_ELECTION", "true")
+	t.Setenv("PGBRIDGE_LEADER_INTERVAL", "2s")
+
+	o := newOptions("run", "", &bytes.Buffer{})
+	o.runFlags()
+	if err := o.parse(nil, false); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if !o.leaderElection || o.leaderInterval != 2*time.Second {
+		t.Errorf("Expected leader election from environment, got %v every %s", o.leaderElection, o.leaderInterval)
+	}
+}
+
+func TestCLI_LogRetention(t *testing.T) {
+	t.Setenv("PGBRIDGE_LOG_PARTITIONING", "true")
+	t.Setenv("PGBRIDGE_LOG_RETENTION_DAYS", "30")
+
+	o := newOptions("run", "", &bytes.Buffer{})
+	o.logFlags()
+	if err := o.parse([]string{"--log-archive-schema", "pgb_archive"}, false); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	cfg := o.logConfig()
+	if !cfg.Partitioned || cfg.Retention != 30*24*time.Hour || cfg.ArchiveSchema != "pgb_archive" {
+		t.Errorf("Unexpected log configuration %+v", cfg)
+	}
+
+	// Archiving needs a retention
+	o = newOptions("run", "", &bytes.Buffer{})
+	o.logFlags()
+	if err := o.parse([]string{"--log-retention-days", "0", "--log-archive-schema", "pgb_archive"}, false); err == nil {
+		t.Error("Expected an archive schema without retention to be rejected")
+	}
+
+	t.Setenv("PGBRIDGE_LOG_RETENTION_DAYS", "-1")
+	o = newOptions("run", "", &bytes.Buffer{})
+	o.logFlags()
+	if err := o.parse(nil, false); err == nil || !strings.Contains(err.Error(), "PGBRIDGE_LOG_RETENTION_DAYS") {
+		t.Errorf("Expected the variable to be named, got %v", err)
+	}
+}
+
+func TestCLI_InvalidEnvironment(t *testing.T) {
+	t.Setenv("PGBRIDGE_STRICT", "maybe")
+
+	code, _, stderr := runArgs("run", "/nonexistent.conf")
+	if code != exitUsage {
+		t.Errorf("Expected exit %d, got %d", exitUsage, code)
+	}
+	if !strings.Contains(stderr, "PGBRIDGE_STRICT") {
+		t.Errorf("Expected the variable to be named, got %q", stderr)
+	}
+}
+
+func TestCLI_Status(t *testing.T) {
+	report := health.Report{
+		Ready: false,
+		Databases: []health.DatabaseStatus{{
+			Name:      "db1",
+			Connected: true,
+			Modules:   []health.ModuleStatus{{Name: "pgb_mail", State: health.StateFailed, Error: "boom"}},
+		}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(report)
+	}))
+	defer server.Close()
+
+	code, stdout, _ := runArgs("status", "--http-addr", server.URL)
+	if code != exitError {
+		t.Errorf("Expected exit %d for a service that is not ready, got %d", exitError, code)
+	}
+	for _, want := range []string{"not ready", "db1", "not listening", "pgb_mail", "failed: boom"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("Expected %q in output, got:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestStatusURL(t *testing.T) {
+	cases := map[string]string{
+		":8080":                 "http://localhost:8080/readyz",
+		"127.0.0.1:8080":        "http://127.0.0.1:8080/readyz",
+		"http://host:8080/":     "http://host:8080/readyz",
+		"https://pgbridge.corp": "https://pgbridge.corp/readyz",
+	}
+
+	for addr, want := range cases {
+		if got := statusURL(addr); got != want {
+			t.Errorf("statusURL(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/config"
+	"pgbridge/internal/database"
+	"pgbridge/internal/health"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/modules/pause"
+)
+
+// statusTimeout bounds the request made by the status command
+const statusTimeout = 10 * time.Second
+
+// validateCommand loads the configuration and checks module names and
+// options, without connecting to the configured databases
+func validateCommand(args []string, stdout, stderr io.Writer) int {
+	o := newOptions("validate", "[flags] [config-file]", stderr)
+	o.sourceFlags()
+	if err := o.parse(args, true); err != nil {
+		return parseError(err, stderr)
+	}
+	if err := o.checkSource(); err != nil {
+		return parseError(err, stderr)
+	}
+
+	cfg, err := o.configLoader(nil)()
+	if err != nil {
+		fmt.Fprintf(stderr, "✗ %v\n", err)
+		return exitError
+	}
+
+	failed := false
+	for _, db := range cfg.Databases {
+		for _, moduleName := range db.ActiveModules {
+			if err := checkOptions(db.Options(moduleName)); err != nil {
+				fmt.Fprintf(stderr, "✗ %s/%s: %v\n", db.Name, moduleName, err)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		return exitError
+	}
+
+	fmt.Fprintf(stdout, "✓ Configuration is valid: %d databases\n", len(cfg.Databases))
+	for _, db := range cfg.Databases {
+		fmt.Fprintf(stdout, "  %s: %s\n", db.Name, strings.Join(db.ActiveModules, ", "))
+	}
+	return exitOK
+}
+
+// initSchemaCommand creates the pgb schema and the tables of every
+// configured module, without starting listeners or processing queues
+func initSchemaCommand(args []string, stdout, stderr io.Writer) int {
+	o := newOptions("init-schema", "[flags] [config-file]", stderr)
+	o.sourceFlags()
+	o.logFlags()
+	if err := o.parse(args, true); err != nil {
+		return parseError(err, stderr)
+	}
+	if err := o.checkSource(); err != nil {
+		return parseError(err, stderr)
+	}
+
+	cfg, err := o.configLoader(nil)()
+	if err != nil {
+		fmt.Fprintf(stderr, "✗ %v\n", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Opened on first use, for modules that need the central database
+	central := &lazyPool{open: func(ctx context.Context) (*pgxpool.Pool, error) {
+		return openCentralPool(ctx, o.centralConfigPath, nil)
+	}}
+	defer central.close()
+
+	failed := false
+	for _, db := range cfg.Databases {
+		if err := initDatabaseSchema(ctx, db, central.get, o.logConfig()); err != nil {
+			fmt.Fprintf(stderr, "✗ %s: %v\n", db.Name, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(stdout, "✓ %s: schema initialized (%s)\n", db.Name, strings.Join(db.ActiveModules, ", "))
+	}
+
+	if failed {
+		return exitError
+	}
+	return exitOK
+}
+
+// initDatabaseSchema runs the schema initializer and the Initialize step of
+// every module of a database
+func initDatabaseSchema(ctx context.Context, db config.DatabaseConfig, centralPool func(ctx context.Context) (*pgxpool.Pool, error), logConfig database.LogConfig) error {
+	pool, err := connectDatabase(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	schema := database.NewSchemaInitializer(pool, db.Name, nil)
+	schema.SetLogConfig(logConfig)
+	if err := schema.Initialize(ctx); err != nil {
+		return err
+	}
+	if err := pause.NewPauseModule(nil, nil).Initialize(ctx, pool); err != nil {
+		return err
+	}
+
+	for _, moduleName := range db.ActiveModules {
+		module, err := modules.New(ctx, moduleName, modules.Context{
+			DatabaseName: db.Name,
+			Pool:         pool,
+			CentralPool:  centralPool,
+			Options:      db.Options(moduleName),
+		})
+		if err != nil {
+			return err
+		}
+		if err := module.Initialize(ctx, pool); err != nil {
+			return fmt.Errorf("failed to initialize module %s: %w", moduleName, err)
+		}
+		if _, err := database.NewMigrator(pool, db.Name, nil).Up(ctx, moduleName, modules.Migrations(moduleName)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lazyPool opens a connection pool on first use
+type lazyPool struct {
+	open func(ctx context.Context) (*pgxpool.Pool, error)
+	pool *pgxpool.Pool
+}
+
+// get returns the pool, opening it if needed
+func (l *lazyPool) get(ctx context.Context) (*pgxpool.Pool, error) {
+	if l.pool == nil {
+		pool, err := l.open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		l.pool = pool
+	}
+	return l.pool, nil
+}
+
+// close closes the pool if it was opened
+func (l *lazyPool) close() {
+	if l.pool != nil {
+		l.pool.Close()
+	}
+}
+
+// connectDatabase opens a pool to a configured database and checks that
+// it is reachable
+func connectDatabase(ctx context.Context, db config.DatabaseConfig) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, db.ConnectionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	return pool, nil
+}
+
+// statusCommand queries /readyz of a running instance and prints the
+// breakdown; exits non-zero unless the instance is ready
+func statusCommand(args []string, stdout, stderr io.Writer) int {
+	o := newOptions("status", "[flags]", stderr)
+	o.httpFlags("address of the running instance, e.g. :8080 or http://host:8080")
+	asJSON := o.fs.Bool("json", false, "print the raw JSON report")
+	if err := o.parse(args, false); err != nil {
+		return parseError(err, stderr)
+	}
+	if o.httpAddr == "" {
+		return parseError(fmt.Errorf("no address: pass --http-addr or set PGBRIDGE_HTTP_ADDR"), stderr)
+	}
+
+	url := statusURL(o.httpAddr)
+	client := &http.Client{Timeout: statusTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Fprintf(stderr, "✗ pgbridge is not reachable at %s: %v\n", url, err)
+		return exitError
+	}
+	defer resp.Body.Close()
+
+	var report health.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		fmt.Fprintf(stderr, "✗ Invalid response from %s: %v\n", url, err)
+		return exitError
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printReport(stdout, report)
+	}
+
+	if !report.Ready {
+		return exitError
+	}
+	return exitOK
+}
+
+// statusURL returns the readiness URL for an address
+func statusURL(addr string) string {
+	base := strings.TrimSuffix(addr, "/")
+	if !strings.Contains(base, "://") {
+		if strings.HasPrefix(base, ":") {
+			base = "localhost" + base
+		}
+		base = "http://" + base
+	}
+	return base + "/readyz"
+}
+
+// printReport prints a readiness report as text
+func printReport(w io.Writer, report health.Report) {
+	if report.Ready {
+		fmt.Fprintf(w, "✓ pgbridge is ready\n")
+	} else {
+		fmt.Fprintf(w, "✗ pgbridge is not ready\n")
+	}
+
+	for _, db := range report.Databases {
+		var state []string
+		state = append(state, flagState(db.Connected, "connected", "disconnected"))
+		state = append(state, flagState(db.Listening, "listening", "not listening"))
+		if db.Degraded {
+			state = append(state, "degraded")
+		}
+		if db.Standby {
+			state = append(state, "standby")
+		}
+		fmt.Fprintf(w, "  %-20s %s\n", db.Name, strings.Join(state, ", "))
+
+		for _, module := range db.Modules {
+			line := fmt.Sprintf("    %-18s %s", module.Name, module.State)
+			if module.Error != "" {
+				line += ": " + module.Error
+			}
+			if module.Reason != "" {
+				line += " (" + module.Reason + ")"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// flagState names the state of a flag
+func flagState(b bool, yes, no string) string {
+	if b {
+		return yes
+	}
+	return no
+}
+
+// versionCommand prints the version
+func versionCommand(args []string, stdout, stderr io.Writer) int {
+	o := newOptions("version", "", stderr)
+	if err := o.parse(args, false); err != nil {
+		return parseError(err, stderr)
+	}
+
+	fmt.Fprintf(stdout, "%s %s (%s %s/%s)\n", serviceName, version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return exitOK
+}
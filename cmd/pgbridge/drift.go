@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/config"
+	"pgbridge/internal/database"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/modules/pause"
+)
+
+// Schema check modes of run
+const (
+	schemaCheckOff    = "off"
+	schemaCheckReport = "report"
+	schemaCheckRepair = "repair"
+)
+
+// schemaCheckModes lists the values of --schema-check
+var schemaCheckModes = []string{schemaCheckOff, schemaCheckReport, schemaCheckRepair}
+
+// schemaComponent is a component owning objects in the pgb schema, with
+// the initializer that creates them again
+type schemaComponent struct {
+	expected   database.ExpectedSchema
+	initialize func(ctx context.Context) error
+}
+
+// coreComponents returns the components of every database: the core
+// schema and the control table
+func coreComponents(ctx context.Context, pool *pgxpool.Pool, dbName string, logConfig database.LogConfig) ([]schemaComponent, error) {
+	schema := database.NewSchemaInitializer(pool, dbName, nil)
+	schema.SetLogConfig(logConfig)
+	components := []schemaComponent{{
+		expected:   database.ExpectedSchema{Component: "schema", Objects: schema.Objects()},
+		initialize: schema.Repair,
+	}}
+
+	control, err := moduleComponent(ctx, pool, dbName, pause.NewPauseModule(nil, nil))
+	if err != nil {
+		return nil, err
+	}
+	return append(components, *control), nil
+}
+
+// moduleComponent returns the component of a module; modules without a
+// plan expect nothing
+func moduleComponent(ctx context.Context, pool *pgxpool.Pool, dbName string, module modules.Module) (*schemaComponent, error) {
+	component := &schemaComponent{
+		expected: database.ExpectedSchema{Component: module.Name()},
+		initialize: func(ctx context.Context) error {
+			if err := module.Initialize(ctx, pool); err != nil {
+				return err
+			}
+			_, err := database.NewMigrator(pool, dbName, nil).Up(ctx, module.Name(), modules.Migrations(module.Name()))
+			return err
+		},
+	}
+
+	if planned, ok := module.(modules.PlannedModule); ok {
+		plan, err := planned.Plan(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan %s: %w", module.Name(), err)
+		}
+		component.expected.Objects = plan.Objects
+	}
+	return component, nil
+}
+
+// checkDrift compares the pgb schema with what the components expect.
+// With repair, missing and mismatched objects are created again by the
+// initializer of their component and extra triggers are dropped; the
+// drift left afterwards is returned as remaining.
+func checkDrift(ctx context.Context, pool *pgxpool.Pool, components []schemaComponent, repair bool) (found, remaining []database.Drift, err error) {
+	expected := make([]database.ExpectedSchema, len(components))
+	for i, c := range components {
+		expected[i] = c.expected
+	}
+
+	found, err = database.DetectDrift(ctx, pool, "pgb", expected)
+	if err != nil || !repair || len(found) == 0 {
+		return found, found, err
+	}
+
+	reinitialize := make(map[string]bool)
+	for _, d := range found {
+		switch {
+		case !d.Repairable():
+		case d.Kind == database.DriftExtra:
+			if err := database.DropTrigger(ctx, pool, d.Object); err != nil {
+				return found, nil, err
+			}
+		default:
+			reinitialize[d.Component] = true
+		}
+	}
+
+	for _, c := range components {
+		if !reinitialize[c.expected.Component] {
+			continue
+		}
+		if err := c.initialize(ctx); err != nil {
+			return found, nil, fmt.Errorf("failed to repair %s: %w", c.expected.Component, err)
+		}
+	}
+
+	remaining, err = database.DetectDrift(ctx, pool, "pgb", expected)
+	return found, remaining, err
+}
+
+// checkSchema compares the schema of the database with the running
+// modules and logs the drift; with --schema-check=repair the drift is
+// repaired. Drift does not stop the database.
+func (m *DatabaseManager) checkSchema(ctx context.Context) {
+	mode := m.bridge.SchemaCheck
+	if mode == "" || mode == schemaCheckOff {
+		return
+	}
+
+	// Only modules that started are compared; the others are retried
+	m.mu.RLock()
+	var running []modules.Module
+	for _, name := range m.config.ActiveModules {
+		if module, ok := m.modules[name]; ok {
+			running = append(running, module)
+		}
+	}
+	m.mu.RUnlock()
+
+	pool := m.connMgr.GetPool()
+	found, remaining, err := func() ([]database.Drift, []database.Drift, error) {
+		components, err := coreComponents(ctx, pool, m.name, m.bridge.LogConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, module := range running {
+			component, err := moduleComponent(ctx, pool, m.name, module)
+			if err != nil {
+				return nil, nil, err
+			}
+			components = append(components, *component)
+		}
+		return checkDrift(ctx, pool, components, mode == schemaCheckRepair)
+	}()
+	for _, d := range found {
+		m.logger.LogSchemaDrift(m.name, d.Component, d.Kind, d.Object.String(), d.Detail)
+	}
+	if err != nil {
+		m.logger.LogSystemf(logger.LevelWarn, "schema", "Failed to check the schema of %s: %v", m.name, err)
+		return
+	}
+	if mode == schemaCheckRepair && len(found) > 0 {
+		m.logger.LogSchemaRepaired(m.name, len(found)-len(remaining), len(remaining))
+	}
+}
+
+// schemaCheckCommand reports the schema drift of the configured databases
+// and optionally repairs it
+func schemaCheckCommand(args []string, stdout, stderr io.Writer) int {
+	o := newOptions("schema-check", "[flags] [config-file]", stderr)
+	o.sourceFlags()
+	o.logFlags()
+	dbName := o.fs.String("database", "", "only check this database")
+	repair := o.fs.Bool("repair", false, "create missing and mismatched objects again and drop extra triggers")
+	asJSON := o.fs.Bool("json", false, "print the drift as JSON")
+	if err := o.parse(args, true); err != nil {
+		return parseError(err, stderr)
+	}
+	if err := o.checkSource(); err != nil {
+		return parseError(err, stderr)
+	}
+
+	cfg, err := o.configLoader(nil)()
+	if err != nil {
+		fmt.Fprintf(stderr, "✗ %v\n", err)
+		return exitError
+	}
+
+	var selected []config.DatabaseConfig
+	for _, db := range cfg.Databases {
+		if *dbName == "" || db.Name == *dbName {
+			selected = append(selected, db)
+		}
+	}
+	if len(selected) == 0 {
+		return parseError(fmt.Errorf("unknown database '%s'", *dbName), stderr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	central := &lazyPool{open: func(ctx context.Context) (*pgxpool.Pool, error) {
+		return openCentralPool(ctx, o.centralConfigPath, nil)
+	}}
+	defer central.close()
+
+	type driftEntry struct {
+		Database   string `json:"database"`
+		Kind       string `json:"kind"`
+		Component  string `json:"component,omitempty"`
+		Object     string `json:"object"`
+		Detail     string `json:"detail,omitempty"`
+		Repairable bool   `json:"repairable"`
+		Repaired   bool   `json:"repaired"`
+	}
+	entries := []driftEntry{}
+
+	code := exitOK
+	for _, db := range selected {
+		found, remaining, err := checkDatabaseDrift(ctx, db, central.get, o.logConfig(), *repair)
+		if err != nil {
+			fmt.Fprintf(stderr, "✗ %s: %v\n", db.Name, err)
+			code = exitError
+			continue
+		}
+		if len(remaining) > 0 {
+			code = exitError
+		}
+
+		left := make(map[string]bool)
+		for _, d := range remaining {
+			left[d.String()] = true
+		}
+		for _, d := range found {
+			entries = append(entries, driftEntry{
+				Database:   db.Name,
+				Kind:       d.Kind,
+				Component:  d.Component,
+				Object:     d.Object.String(),
+				Detail:     d.Detail,
+				Repairable: d.Repairable(),
+				Repaired:   *repair && !left[d.String()],
+			})
+		}
+
+		if *asJSON {
+			continue
+		}
+		printDrift(stdout, db.Name, found, left, *repair)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(entries)
+	}
+	return code
+}
+
+// checkDatabaseDrift checks one configured database with all its active
+// modules. Without repair the connection is read-only; logConfig decides
+// how a missing pgb_log is created again.
+func checkDatabaseDrift(ctx context.Context, db config.DatabaseConfig, centralPool func(ctx context.Context) (*pgxpool.Pool, error), logConfig database.LogConfig, repair bool) (found, remaining []database.Drift, err error) {
+	var pool *pgxpool.Pool
+	if repair {
+		pool, err = connectDatabase(ctx, db)
+	} else {
+		pool, err = connectReadOnly(ctx, db.ConnectionString)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer pool.Close()
+
+	components, err := coreComponents(ctx, pool, db.Name, logConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, moduleName := range db.ActiveModules {
+		module, err := modules.New(ctx, moduleName, modules.Context{
+			DatabaseName: db.Name,
+			Pool:         pool,
+			CentralPool:  centralPool,
+			Options:      db.Options(moduleName),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		component, err := moduleComponent(ctx, pool, db.Name, module)
+		if err != nil {
+			return nil, nil, err
+		}
+		components = append(components, *component)
+	}
+
+	return checkDrift(ctx, pool, components, repair)
+}
+
+// printDrift prints the drift of a database, marking what was repaired
+// (✓), is left (✗) or is only reported (⚠)
+func printDrift(w io.Writer, name string, found []database.Drift, left map[string]bool, repaired bool) {
+	if len(found) == 0 {
+		fmt.Fprintf(w, "✓ %s: schema matches the modules\n", name)
+		return
+	}
+
+	fmt.Fprintf(w, "✗ %s: %d differences\n", name, len(found))
+	for _, d := range found {
+		mark := "⚠"
+		switch {
+		case repaired && !left[d.String()]:
+			mark = "✓"
+		case d.Repairable():
+			mark = "✗"
+		}
+
+		owner := ""
+		if d.Component != "" {
+			owner = " (" + d.Component + ")"
+		}
+		fmt.Fprintf(w, "  %s %s%s\n", mark, d, owner)
+	}
+	if !repaired && hasRepairable(found) {
+		fmt.Fprintf(w, "  Run with --repair to fix the differences marked ✗\n")
+	}
+}
+
+// hasRepairable reports whether a repair would fix any of the drift
+func hasRepairable(drift []database.Drift) bool {
+	for _, d := range drift {
+		if d.Repairable() {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSchemaCheck checks a --schema-check mode
+func validateSchemaCheck(mode string) error {
+	for _, m := range schemaCheckModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown schema check '%s': expected one of %s", mode, strings.Join(schemaCheckModes, ", "))
+}
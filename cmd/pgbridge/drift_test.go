@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"pgbridge/internal/database"
+)
+
+func TestPrintDrift(t *testing.T) {
+	duplicate := database.Drift{
+		Kind:      database.DriftExtra,
+		Component: "pgb_notify",
+		Object:    database.SchemaObject{Kind: database.ObjectTrigger, Schema: "pgb", Table: "pgb_notify", Name: "S01_send_notification"},
+		Detail:    "BEFORE INSERT FOR EACH ROW EXECUTE pgb.trg_pgb_send_notification()",
+	}
+	leftover := database.Drift{
+		Kind:   database.DriftExtra,
+		Object: database.SchemaObject{Kind: database.ObjectTable, Schema: "pgb", Name: "pgb_old"},
+	}
+	found := []database.Drift{duplicate, leftover}
+
+	var out bytes.Buffer
+	printDrift(&out, "db1", found, map[string]bool{duplicate.String(): true, leftover.String(): true}, false)
+	for _, expected := range []string{
+		"✗ db1: 2 differences",
+		"✗ extra trigger S01_send_notification on pgb.pgb_notify: BEFORE INSERT",
+		"(pgb_notify)",
+		"⚠ extra table pgb.pgb_old",
+		"Run with --repair",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in the report, got:\n%s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	printDrift(&out, "db1", found, map[string]bool{leftover.String(): true}, true)
+	if !strings.Contains(out.String(), "✓ extra trigger") || strings.Contains(out.String(), "--repair") {
+		t.Errorf("Expected the trigger to be repaired, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	printDrift(&out, "db1", nil, nil, false)
+	if !strings.Contains(out.String(), "✓ db1: schema matches the modules") {
+		t.Errorf("Expected no drift, got:\n%s", out.String())
+	}
+}
+
+func TestSchemaCheck_ArgumentErrors(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@localhost:5432/db1, [pgb_mail]\n")
+
+	cases := map[string][]string{
+		"no source":    {"schema-check"},
+		"unknown db":   {"schema-check", "--config", path, "--database", "db2"},
+		"run mode":     {"run", "--config", path, "--schema-check", "fix"},
+		"unknown flag": {"schema-check", "--config", path, "--fix"},
+	}
+
+	for name, args := range cases {
+		code, _, stderr := runArgs(args...)
+		if code != exitUsage {
+			t.Errorf("%s: expected exit %d, got %d: %s", name, exitUsage, code, stderr)
+		}
+	}
+}
+
+func TestSchemaCheck_Unreachable(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@127.0.0.1:1/db1?connect_timeout=1, [pgb_mail]\n")
+
+	code, _, stderr := runArgs("schema-check", "--config", path)
+	if code != exitError || !strings.Contains(stderr, "db1") {
+		t.Errorf("Expected a connection error, got %d %q", code, stderr)
+	}
+}
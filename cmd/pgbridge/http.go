@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"pgbridge/internal/health"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/metrics"
+)
+
+// httpShutdownTimeout bounds how long stopping the HTTP listener waits for
+// requests in progress
+const httpShutdownTimeout = 5 * time.Second
+
+// httpServer serves the HTTP endpoints of the service
+type httpServer struct {
+	server *http.Server
+}
+
+// startHTTP listens on addr and serves /healthz, /readyz and /metrics for
+// the bridge
+func startHTTP(addr string, bridge *Bridge, apiTokens []string) (*httpServer, error) {
+	if err := registerMetrics(bridge); err != nil {
+		return nil, fmt.Errorf("failed to register metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	health.Register(mux, bridge.Health)
+	mux.Handle("GET /metrics", metrics.Handler())
+	if len(apiTokens) > 0 {
+		registerAPI(mux, bridge, apiTokens)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	s := &httpServer{
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			bridge.Logger().LogSystemf(logger.LevelError, "http", "HTTP server stopped: %v", err)
+		}
+	}()
+
+	bridge.Logger().LogSystemf(logger.LevelInfo, "http", "Serving health and metrics endpoints on %s", ln.Addr())
+	if len(apiTokens) > 0 {
+		bridge.Logger().LogSystemf(logger.LevelInfo, "http", "Serving enqueue API on %s with %d token(s)", ln.Addr(), len(apiTokens))
+	}
+	return s, nil
+}
+
+// stop stops accepting requests and waits briefly for running ones
+func (s *httpServer) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	s.server.Shutdown(ctx)
+}
@@ -0,0 +1,836 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/config"
+	"pgbridge/internal/database"
+	"pgbridge/internal/health"
+	"pgbridge/internal/leader"
+	"pgbridge/internal/listener"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/metrics"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/modules/pause"
+	"pgbridge/internal/tracing"
+	"pgbridge/internal/worker"
+)
+
+const (
+	// defaultSweepInterval is how often module queues are swept for
+	// items whose notification was missed
+	defaultSweepInterval = 5 * time.Minute
+	// defaultSweepGrace leaves recent items to the live listener
+	defaultSweepGrace = 1 * time.Minute
+	// defaultDepthInterval is how often the queue depth metric is sampled
+	defaultDepthInterval = 30 * time.Second
+)
+
+// DatabaseManager manages a single database connection and its modules
+type DatabaseManager struct {
+	name       string
+	config     config.DatabaseConfig
+	connMgr    *database.ConnectionManager
+	modules    map[string]modules.Module
+	pools      map[string]*worker.Pool
+	sweepers   map[string]*worker.Sweeper
+	samplers   map[string]*metrics.QueueSampler
+	failures   map[string]string
+	dispatcher *listener.Dispatcher
+	control    *worker.Pool
+	logTable   *database.LogMaintainer
+	pauses     map[string]pause.State
+	elector    *leader.Elector
+	bridge     *Bridge
+	logger     *logger.Logger
+	degraded   bool
+	standby    bool
+	checking   bool
+	done       chan struct{}
+	stopOnce   sync.Once
+	mu         sync.RWMutex
+}
+
+// newDatabaseManager creates a database manager for a configured database
+func newDatabaseManager(dbConfig config.DatabaseConfig, bridge *Bridge) *DatabaseManager {
+	maxConns, minConns := dbConfig.Pool.Conns()
+	connConfig := database.ConnectionConfig{
+		Name:              dbConfig.Name,
+		ConnectionString:  dbConfig.ConnectionString,
+		MaxConnections:    maxConns,
+		MinConnections:    minConns,
+		HealthCheckPeriod: dbConfig.Pool.HealthCheckPeriod,
+		MaxConnLifetime:   dbConfig.Pool.MaxConnLifetime,
+		MaxConnIdleTime:   dbConfig.Pool.MaxConnIdleTime,
+		StatementTimeout:  dbConfig.Pool.StatementTimeout,
+		ApplicationName:   dbConfig.Pool.ApplicationName,
+	}
+
+	m := &DatabaseManager{
+		name:     dbConfig.Name,
+		config:   dbConfig,
+		connMgr:  database.NewConnectionManager(connConfig, bridge.systemLogger),
+		modules:  make(map[string]modules.Module),
+		pools:    make(map[string]*worker.Pool),
+		sweepers: make(map[string]*worker.Sweeper),
+		samplers: make(map[string]*metrics.QueueSampler),
+		failures: make(map[string]string),
+		pauses:   make(map[string]pause.State),
+		bridge:   bridge,
+		logger:   bridge.systemLogger,
+		done:     make(chan struct{}),
+	}
+	m.connMgr.OnPoolReplaced(m.replacePool)
+	return m
+}
+
+// replacePool hands the new pool to everything that keeps the pool of
+// this database after the connection manager reconnected: the modules,
+// the pgb_log maintenance and the database logger
+func (m *DatabaseManager) replacePool(old, pool *pgxpool.Pool) {
+	m.mu.RLock()
+	for _, module := range m.modules {
+		if pm, ok := module.(modules.PoolModule); ok {
+			pm.SetPool(pool)
+		}
+	}
+	logTable := m.logTable
+	m.mu.RUnlock()
+
+	if logTable != nil {
+		logTable.SetPool(pool)
+	}
+	m.logger.ReplacePool(old, pool)
+	m.logger.LogSystemf(logger.LevelInfo, "main", "Connection pool of %s replaced after reconnecting", m.name)
+}
+
+// connect connects to the database and initializes the pgb schema
+func (m *DatabaseManager) connect(ctx context.Context) error {
+	if err := m.connMgr.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to database %s: %w", m.name, err)
+	}
+
+	// Initialize schema (creates pgb schema and pgb_log table)
+	schemaInit := database.NewSchemaInitializer(m.connMgr.GetPool(), m.name, m.bridge.systemLogger)
+	schemaInit.SetLogConfig(m.bridge.LogConfig)
+	if err := schemaInit.Initialize(ctx); err != nil {
+		return fmt.Errorf("failed to initialize schema for %s: %w", m.name, err)
+	}
+
+	return nil
+}
+
+// start starts the dispatcher and all configured modules, or with leader
+// election stands by until this instance leads the database
+// With failFast the first module that fails to start is returned as an
+// error; otherwise it is logged and skipped, to be retried on reload
+func (m *DatabaseManager) start(ctx context.Context, failFast bool) error {
+	if m.bridge.LeaderElection {
+		m.campaign(ctx)
+	} else if err := m.startProcessing(ctx, failFast); err != nil {
+		return err
+	}
+
+	// Start health check
+	if !m.checking {
+		m.connMgr.StartHealthCheck()
+		m.checking = true
+	}
+
+	return nil
+}
+
+// startProcessing starts the dispatcher and all configured modules
+func (m *DatabaseManager) startProcessing(ctx context.Context, failFast bool) error {
+	// Refuse invalid options before anything is started or initialized;
+	// otherwise addModule skips the module before initializing it
+	if failFast {
+		for _, moduleName := range m.config.ActiveModules {
+			if err := checkOptions(m.config.Options(moduleName)); err != nil {
+				return fmt.Errorf("invalid options for module %s on %s: %w", moduleName, m.name, err)
+			}
+		}
+	}
+
+	// Start the dispatcher: one LISTEN connection for all modules of this database
+	dispatcher := listener.NewDispatcher(m.name, m.connMgr.SessionConnString(), m.logger)
+	if err := dispatcher.Start(ctx); err != nil {
+		m.logger.LogListenerError(m.name, "", err)
+		return fmt.Errorf("failed to start listener for %s: %w", m.name, err)
+	}
+	m.setDispatcher(dispatcher)
+
+	// Follow pgb.pgb_control before any module starts, so paused modules
+	// start paused
+	m.startControl(ctx)
+
+	// Initialize modules for this database
+	for _, moduleName := range m.config.ActiveModules {
+		if err := m.addModule(ctx, moduleName); err != nil {
+			if failFast {
+				return err
+			}
+			m.logger.LogSystemf(logger.LevelError, "main", "Skipping module %s/%s: %v", m.name, moduleName, err)
+			m.removeModule(ctx, moduleName)
+		}
+	}
+
+	// Report what initialization and the migrations left different
+	m.checkSchema(ctx)
+
+	// Create the coming pgb_log partitions and apply the retention; with
+	// leader election only the leader does
+	logTable := database.NewLogMaintainer(m.connMgr.GetPool(), m.name, m.bridge.LogConfig, database.DefaultLogMaintenanceInterval, m.logger)
+	logTable.Start()
+	m.mu.Lock()
+	m.logTable = logTable
+	m.mu.Unlock()
+
+	return nil
+}
+
+// stopProcessing stops the listener and all modules, keeping the
+// connection
+func (m *DatabaseManager) stopProcessing(ctx context.Context) {
+	m.stopListening(ctx)
+	m.setDispatcher(nil)
+
+	for _, moduleName := range m.moduleNames() {
+		m.removeModule(ctx, moduleName)
+	}
+}
+
+// abortProcessing stops the listener and all modules like stopProcessing,
+// but discards the queued notifications instead of finishing them: after
+// losing leadership they are left in the queue tables for the new leader
+func (m *DatabaseManager) abortProcessing(ctx context.Context) {
+	m.stopListening(ctx)
+	m.setDispatcher(nil)
+
+	m.mu.RLock()
+	pools := make([]*worker.Pool, 0, len(m.pools))
+	for _, pool := range m.pools {
+		pools = append(pools, pool)
+	}
+	m.mu.RUnlock()
+
+	for _, pool := range pools {
+		pool.Abort()
+	}
+	m.stopProcessing(ctx)
+}
+
+// startControl creates the control table and routes its channel through
+// the dispatcher; pausing and resuming modules takes effect on the next
+// notification. Without the table nothing can be paused, which is not
+// fatal.
+func (m *DatabaseManager) startControl(ctx context.Context) {
+	pool := m.connMgr.GetPool()
+	module := pause.NewPauseModule(m.applyPauses, m.logger)
+
+	if err := module.Initialize(ctx, pool); err != nil {
+		m.logger.LogSystemf(logger.LevelWarn, "main", "Pausing modules on %s is unavailable: %v", m.name, err)
+		return
+	}
+	m.loadPauses(ctx)
+
+	// One worker: changes are applied in order. Payloads name the module
+	// rather than an item, so they are passed on undecoded.
+	handler := func(ctx context.Context, payload string) error {
+		return module.ProcessNotification(ctx, modules.Notification{Raw: payload})
+	}
+	workers := worker.NewPool(m.name+"/"+module.Name(), worker.Config{Workers: 1}, handler, m.logger)
+	workers.Start()
+	m.control = workers
+
+	if err := m.getDispatcher().Subscribe(ctx, module, workers); err != nil {
+		m.logger.LogListenerError(m.name, module.GetChannelName(), err)
+	}
+}
+
+// loadPauses reads the pause states of the database
+func (m *DatabaseManager) loadPauses(ctx context.Context) bool {
+	states, err := pause.Load(ctx, m.connMgr.GetPool())
+	if err != nil {
+		m.logger.LogSystemf(logger.LevelWarn, "main", "Failed to load pause states of %s: %v", m.name, err)
+		return false
+	}
+
+	m.mu.Lock()
+	m.pauses = states
+	m.mu.Unlock()
+	return true
+}
+
+// isPaused returns whether a module is paused, and why
+func (m *DatabaseManager) isPaused(moduleName string) (bool, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state := m.pauses[moduleName]
+	return state.Paused, state.Reason
+}
+
+// applyPauses reloads the pause states and pauses or resumes the worker
+// pools of the running modules. Paused modules keep LISTENing but defer
+// their notifications; resumed modules catch up on what was deferred.
+func (m *DatabaseManager) applyPauses(ctx context.Context) {
+	if !m.loadPauses(ctx) {
+		return
+	}
+
+	type change struct {
+		name   string
+		module modules.Module
+		pool   *worker.Pool
+		state  pause.State
+	}
+
+	m.mu.RLock()
+	var changes []change
+	for name, pool := range m.pools {
+		state := m.pauses[name]
+		if pool.Paused() != state.Paused {
+			changes = append(changes, change{name: name, module: m.modules[name], pool: pool, state: state})
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, c := range changes {
+		if c.state.Paused {
+			c.pool.Pause()
+			m.logger.LogModulePaused(m.name, c.name, c.state.Reason)
+			continue
+		}
+
+		deferred := c.pool.Resume()
+		m.logger.LogModuleResumed(m.name, c.name, deferred)
+		// The catch-up outlives the control job; it ends with the pool
+		m.catchUp(context.WithoutCancel(ctx), c.name, c.module, c.pool)
+	}
+}
+
+// catchUp hands what accumulated in a module's queue to its worker pool in
+// the background, where it is deduplicated against the notifications being
+// handled (see modules.CatchUp); it ends early when the pool is stopped
+func (m *DatabaseManager) catchUp(ctx context.Context, moduleName string, module modules.Module, pool *worker.Pool) {
+	go func() {
+		submitted, err := modules.CatchUp(ctx, module, pool)
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, worker.ErrPoolStopped) {
+				m.logger.LogSystemf(logger.LevelWarn, "main", "Queue processing for %s/%s had errors: %v", m.name, moduleName, err)
+			}
+			return
+		}
+		if submitted > 0 {
+			m.logger.LogSystemf(logger.LevelInfo, "main", "Queued %d pending items of %s/%s", submitted, m.name, moduleName)
+		}
+	}()
+}
+
+// campaign stands by and competes with other instances for leadership of
+// the database; the bridge starts processing once the lock is acquired
+func (m *DatabaseManager) campaign(ctx context.Context) {
+	m.setStandby(true)
+
+	var elector *leader.Elector
+	elector = leader.NewElector(m.name, m.connMgr.SessionConnString(), leader.Config{
+		Key:      leader.Key(serviceName),
+		Interval: m.bridge.LeaderInterval,
+		// The elector must not block; the bridge lock may be held by
+		// whoever is stopping it
+		OnChange: func() { go m.bridge.followLeadership(ctx, m, elector) },
+	}, m.logger)
+	m.elector = elector
+	elector.Start(ctx)
+}
+
+// followLeadership starts processing when this instance became the
+// leader, catching up on whatever the previous leader left, and stops it
+// when leadership was lost
+func (m *DatabaseManager) followLeadership(ctx context.Context) {
+	leading := m.elector.IsLeader()
+
+	switch {
+	case leading && m.isStandby():
+		m.setStandby(false)
+		if err := m.startProcessing(ctx, false); err != nil {
+			m.logger.LogSystemf(logger.LevelError, "main", "Failed to take over %s, handing leadership back and campaigning again in %s: %v", m.name, m.bridge.leaderInterval(), err)
+			m.stopProcessing(ctx)
+			m.stopElection()
+			go m.bridge.recampaign(ctx, m)
+			return
+		}
+		m.logger.LogSystemf(logger.LevelInfo, "main", "Database %s taken over with %d modules", m.name, len(m.moduleNames()))
+
+	case !leading && !m.isStandby():
+		m.logger.LogSystemf(logger.LevelInfo, "main", "Database %s lost leadership, standing by", m.name)
+		m.abortProcessing(ctx)
+		m.setStandby(true)
+	}
+}
+
+// stopElection stops campaigning and releases leadership
+func (m *DatabaseManager) stopElection() {
+	if m.elector != nil {
+		m.elector.Stop()
+		m.elector = nil
+	}
+}
+
+// addModule creates, initializes and starts a module, then routes its
+// channel through the dispatcher
+func (m *DatabaseManager) addModule(ctx context.Context, moduleName string) (err error) {
+	defer func() { m.setFailure(moduleName, err) }()
+
+	module, err := modules.New(ctx, moduleName, modules.Context{
+		DatabaseName: m.name,
+		Pool:         m.connMgr.GetPool(),
+		Logger:       m.logger,
+		CentralPool:  m.bridge.getCentralPool,
+		Options:      m.config.Options(moduleName),
+	})
+	if err != nil {
+		m.logger.LogModuleError(m.name, moduleName, "create", err)
+		return err
+	}
+
+	// Check the options before the module changes anything on the database
+	opts := m.config.Options(moduleName)
+	poolConfig, err := workerConfig(module, opts)
+	var sweepInterval, sweepGrace, sampleInterval time.Duration
+	if err == nil {
+		sweepInterval, sweepGrace, err = sweepConfig(opts)
+	}
+	if err == nil {
+		sampleInterval, err = depthInterval(opts)
+	}
+	if err != nil {
+		m.logger.LogModuleError(m.name, moduleName, "configure", err)
+		return fmt.Errorf("invalid options for module %s on %s: %w", moduleName, m.name, err)
+	}
+
+	// Initialize module
+	if err := module.Initialize(ctx, m.connMgr.GetPool()); err != nil {
+		m.logger.LogModuleError(m.name, moduleName, "initialize", err)
+		return fmt.Errorf("failed to initialize module %s for %s: %w", moduleName, m.name, err)
+	}
+
+	// Bring the tables of existing installations up to date
+	migrator := database.NewMigrator(m.connMgr.GetPool(), m.name, m.logger)
+	if _, err := migrator.Up(ctx, moduleName, modules.Migrations(moduleName)); err != nil {
+		m.logger.LogModuleError(m.name, moduleName, "migrate", err)
+		return fmt.Errorf("failed to migrate module %s for %s: %w", moduleName, m.name, err)
+	}
+
+	// Start module
+	if err := module.Start(ctx); err != nil {
+		m.logger.LogModuleError(m.name, moduleName, "start", err)
+		return fmt.Errorf("failed to start module %s for %s: %w", moduleName, m.name, err)
+	}
+
+	m.mu.Lock()
+	m.modules[moduleName] = module
+	m.mu.Unlock()
+	m.logger.LogModuleStart(m.name, moduleName)
+
+	// Setup the worker pool that processes this module's notifications
+	handler := metrics.Instrument(m.name, moduleName, tracing.Instrument(m.name, moduleName, modules.Handler(module)))
+	pool := worker.NewPool(m.name+"/"+moduleName, poolConfig, handler, m.logger)
+	pool.Start()
+	m.mu.Lock()
+	state := m.pauses[moduleName]
+	if state.Paused {
+		pool.Pause()
+	}
+	m.pools[moduleName] = pool
+	m.mu.Unlock()
+	m.logger.LogSystemf(logger.LevelInfo, "main", "Worker pool started: %s", pool)
+
+	// Route this module's channel through the dispatcher
+	if err := m.getDispatcher().Subscribe(ctx, module, pool); err != nil {
+		m.logger.LogListenerError(m.name, module.GetChannelName(), err)
+		return fmt.Errorf("failed to start listener for %s/%s: %w", m.name, moduleName, err)
+	}
+
+	// Hand the items queued meanwhile to the workers, unless the module is
+	// paused: they are processed on resume
+	if state.Paused {
+		m.logger.LogModulePaused(m.name, moduleName, state.Reason)
+	} else {
+		m.catchUp(ctx, moduleName, module, pool)
+	}
+
+	// Periodically pick up items whose notification was missed
+	if sweepable, ok := module.(modules.SweepableModule); ok && sweepInterval > 0 {
+		sweeper := worker.NewSweeper(m.name+"/"+moduleName, pool, sweepable.PendingItems, sweepInterval, sweepGrace, m.logger)
+		sweeper.Start()
+		m.mu.Lock()
+		m.sweepers[moduleName] = sweeper
+		m.mu.Unlock()
+		m.logger.LogSystemf(logger.LevelInfo, "main", "Queue sweep started for %s/%s (every %s, grace %s)", m.name, moduleName, sweepInterval, sweepGrace)
+	}
+
+	// Export the backlog of the module's queue table
+	if measurable, ok := module.(modules.QueueDepthModule); ok && sampleInterval > 0 {
+		sampler := metrics.NewQueueSampler(m.name, moduleName, measurable.QueueDepth, sampleInterval, m.logger)
+		sampler.Start()
+		m.mu.Lock()
+		m.samplers[moduleName] = sampler
+		m.mu.Unlock()
+	}
+
+	return nil
+}
+
+// removeModule stops routing a module's channel, finishes its queued
+// notifications until ctx is done and stops it
+func (m *DatabaseManager) removeModule(ctx context.Context, moduleName string) {
+	m.mu.Lock()
+	module, ok := m.modules[moduleName]
+	pool := m.pools[moduleName]
+	sweeper := m.sweepers[moduleName]
+	sampler := m.samplers[moduleName]
+	delete(m.modules, moduleName)
+	delete(m.pools, moduleName)
+	delete(m.sweepers, moduleName)
+	delete(m.samplers, moduleName)
+	m.mu.Unlock()
+
+	if sweeper != nil {
+		sweeper.Stop()
+	}
+	if sampler != nil {
+		sampler.Stop()
+	}
+	metrics.ForgetModule(m.name, moduleName)
+
+	if !ok {
+		return
+	}
+
+	if dispatcher := m.getDispatcher(); dispatcher != nil {
+		err := dispatcher.Unsubscribe(ctx, module.GetChannelName())
+		if err != nil && !errors.Is(err, listener.ErrDispatcherStopped) {
+			m.logger.LogListenerError(m.name, module.GetChannelName(), err)
+		}
+	}
+
+	if pool != nil {
+		m.logger.LogSystemf(logger.LevelInfo, "main", "Stopping worker pool %s/%s", m.name, moduleName)
+		pool.Drain(ctx)
+	}
+
+	m.logger.LogSystemf(logger.LevelInfo, "main", "Stopping module %s/%s", m.name, moduleName)
+	if err := module.Stop(); err != nil {
+		m.logger.LogModuleError(m.name, moduleName, "stop", err)
+		return
+	}
+	m.logger.LogModuleStop(m.name, moduleName)
+}
+
+// drain stops every module, giving its queued and in-flight notifications
+// until ctx is done to finish. The listener must already be stopped.
+func (m *DatabaseManager) drain(ctx context.Context) map[string]worker.DrainStats {
+	m.mu.Lock()
+	pools := m.pools
+	running := m.modules
+	sweepers := m.sweepers
+	samplers := m.samplers
+	m.pools = make(map[string]*worker.Pool)
+	m.modules = make(map[string]modules.Module)
+	m.sweepers = make(map[string]*worker.Sweeper)
+	m.samplers = make(map[string]*metrics.QueueSampler)
+	m.mu.Unlock()
+
+	for _, sweeper := range sweepers {
+		sweeper.Stop()
+	}
+	for _, sampler := range samplers {
+		sampler.Stop()
+	}
+
+	stats := make(map[string]worker.DrainStats)
+	var statsMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for moduleName, pool := range pools {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := pool.Drain(ctx)
+			statsMu.Lock()
+			stats[moduleName] = s
+			statsMu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for moduleName, module := range running {
+		if err := module.Stop(); err != nil {
+			m.logger.LogModuleError(m.name, moduleName, "stop", err)
+			continue
+		}
+		m.logger.LogModuleStop(m.name, moduleName)
+	}
+
+	return stats
+}
+
+// moduleNames returns the names of the running modules
+func (m *DatabaseManager) moduleNames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.modules))
+	for name := range m.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reset stops the listener and all modules, releases leadership and
+// disconnects, leaving the connection manager ready for another attempt
+func (m *DatabaseManager) reset(ctx context.Context) {
+	m.stopProcessing(ctx)
+	m.stopElection()
+	m.setStandby(false)
+
+	m.connMgr.Disconnect()
+}
+
+// setFailure records why a module failed to start, or clears it
+func (m *DatabaseManager) setFailure(moduleName string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		delete(m.failures, moduleName)
+		return
+	}
+	m.failures[moduleName] = err.Error()
+}
+
+// health reports the connection, listener and module states; configured
+// modules that are not running are pending or failed
+func (m *DatabaseManager) health() health.DatabaseStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := health.DatabaseStatus{
+		Name:      m.name,
+		Connected: m.connMgr.IsConnected(),
+		Listening: m.dispatcher != nil && m.dispatcher.IsListening(),
+		Degraded:  m.degraded,
+		Standby:   m.standby,
+		Modules:   make([]health.ModuleStatus, 0, len(m.config.ActiveModules)),
+	}
+
+	for _, moduleName := range m.config.ActiveModules {
+		module := health.ModuleStatus{Name: moduleName, State: health.StatePending}
+		if pool, ok := m.pools[moduleName]; ok && !m.degraded {
+			module.State = health.StateRunning
+			if pool.Paused() {
+				module.State = health.StatePaused
+				module.Reason = m.pauses[moduleName].Reason
+			}
+		} else if m.standby && !m.degraded {
+			module.State = health.StateStandby
+		} else if reason, ok := m.failures[moduleName]; ok {
+			module.State = health.StateFailed
+			module.Error = reason
+		}
+		status.Modules = append(status.Modules, module)
+	}
+
+	return status
+}
+
+// setConfig replaces the configuration of the database
+func (m *DatabaseManager) setConfig(dbConfig config.DatabaseConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.config = dbConfig
+}
+
+// setDispatcher sets the dispatcher of the running modules, or clears it
+func (m *DatabaseManager) setDispatcher(dispatcher *listener.Dispatcher) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dispatcher = dispatcher
+}
+
+// getDispatcher returns the dispatcher, nil while nothing is processed
+func (m *DatabaseManager) getDispatcher() *listener.Dispatcher {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.dispatcher
+}
+
+// setDegraded marks whether the database is waiting to be started
+func (m *DatabaseManager) setDegraded(degraded bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.degraded = degraded
+}
+
+// isDegraded returns whether the database is waiting to be started
+func (m *DatabaseManager) isDegraded() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.degraded
+}
+
+// setStandby marks whether another instance leads the database
+func (m *DatabaseManager) setStandby(standby bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.standby = standby
+}
+
+// isStandby returns whether another instance leads the database
+func (m *DatabaseManager) isStandby() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.standby
+}
+
+// stopListening closes the LISTEN connection so no new work is accepted;
+// a pause change being applied gets until ctx is done
+func (m *DatabaseManager) stopListening(ctx context.Context) {
+	if dispatcher := m.getDispatcher(); dispatcher != nil {
+		m.logger.LogSystemf(logger.LevelInfo, "main", "Stopping listener %s", m.name)
+		dispatcher.Stop()
+	}
+	if m.control != nil {
+		m.control.Drain(ctx)
+		m.control = nil
+	}
+	m.mu.Lock()
+	logTable := m.logTable
+	m.logTable = nil
+	m.mu.Unlock()
+	if logTable != nil {
+		logTable.Stop()
+	}
+}
+
+// stop shuts down the listener, all modules and the connection
+func (m *DatabaseManager) stop(ctx context.Context) {
+	m.logger.LogSystemf(logger.LevelInfo, "main", "Shutting down database: %s", m.name)
+
+	// Stop a background retry
+	m.stopOnce.Do(func() { close(m.done) })
+
+	// Stop the listener
+	m.stopListening(ctx)
+
+	// Stop worker pools (finishing queued notifications until ctx is
+	// done) and modules
+	for _, moduleName := range m.moduleNames() {
+		m.removeModule(ctx, moduleName)
+	}
+
+	// Release leadership once nothing is processed anymore
+	m.stopElection()
+
+	// Shutdown connection manager
+	m.connMgr.Shutdown()
+}
+
+// workerConfig builds the worker pool configuration for a module from its
+// options: workers, queue_size, job_timeout and ordered
+func workerConfig(module modules.Module, opts config.ModuleOptions) (worker.Config, error) {
+	cfg, err := poolOptions(opts)
+	if err != nil {
+		return cfg, err
+	}
+
+	// Payloads identify queue items: never handle one twice at a time when
+	// the listener and the queue sweep both pick it up (a bare id and the
+	// equivalent JSON envelope count as the same item)
+	cfg.Dedup = true
+	cfg.DedupKey = modules.DedupKey
+
+	if cfg.Ordered {
+		keyed, ok := module.(modules.KeyedModule)
+		if !ok {
+			return cfg, fmt.Errorf("module %s does not support ordered processing", module.Name())
+		}
+		cfg.KeyFunc = keyed.OrderingKey
+	}
+
+	return cfg, nil
+}
+
+// poolOptions reads the worker pool options of a module
+func poolOptions(opts config.ModuleOptions) (worker.Config, error) {
+	var cfg worker.Config
+	var err error
+
+	if cfg.Workers, err = opts.Int("workers", worker.DefaultWorkers); err != nil {
+		return cfg, err
+	}
+	if cfg.QueueSize, err = opts.Int("queue_size", worker.DefaultQueueSize); err != nil {
+		return cfg, err
+	}
+	if cfg.JobTimeout, err = opts.Duration("job_timeout", worker.DefaultJobTimeout); err != nil {
+		return cfg, err
+	}
+	if cfg.Ordered, err = opts.Bool("ordered", false); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// sweepConfig reads the queue sweep options of a module: sweep_interval
+// (0 disables the sweep) and sweep_grace
+func sweepConfig(opts config.ModuleOptions) (time.Duration, time.Duration, error) {
+	interval, err := opts.Duration("sweep_interval", defaultSweepInterval)
+	if err != nil {
+		return 0, 0, err
+	}
+	grace, err := opts.Duration("sweep_grace", defaultSweepGrace)
+	if err != nil {
+		return 0, 0, err
+	}
+	if interval < 0 || grace < 0 {
+		return 0, 0, fmt.Errorf("sweep_interval and sweep_grace must not be negative")
+	}
+	return interval, grace, nil
+}
+
+// depthInterval reads how often the queue depth metric is sampled
+// (depth_interval, 0 disables sampling)
+func depthInterval(opts config.ModuleOptions) (time.Duration, error) {
+	interval, err := opts.Duration("depth_interval", defaultDepthInterval)
+	if err != nil {
+		return 0, err
+	}
+	if interval < 0 {
+		return 0, fmt.Errorf("depth_interval must not be negative")
+	}
+	return interval, nil
+}
+
+// checkOptions validates the options of a module without creating it
+func checkOptions(opts config.ModuleOptions) error {
+	if _, err := poolOptions(opts); err != nil {
+		return err
+	}
+	if _, _, err := sweepConfig(opts); err != nil {
+		return err
+	}
+	if _, err := depthInterval(opts); err != nil {
+		return err
+	}
+	return nil
+}
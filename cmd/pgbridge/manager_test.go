@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/config"
+	"pgbridge/internal/database"
+	"pgbridge/internal/health"
+	"pgbridge/internal/listener"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/worker"
+)
+
+func TestDatabaseManager_DispatcherRace(t *testing.T) {
+	bridge := NewBridge(nil, logger.NewLogger(serviceName, nil))
+	mgr := newDatabaseManager(config.DatabaseConfig{
+		Name:             "db1",
+		ConnectionString: "postgres://u:p@localhost:5432/db1",
+		ActiveModules:    []string{"pgb_mail"},
+	}, bridge)
+	bridge.register(mgr)
+
+	// Processing stops while health and the watchdog look at the listener
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			mgr.setDispatcher(listener.NewDispatcher(mgr.name, mgr.config.ConnectionString, nil))
+			mgr.stopProcessing(context.Background())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			mgr.health()
+			bridge.Stalled(time.Now())
+		}
+	}()
+	wg.Wait()
+
+	if mgr.getDispatcher() != nil {
+		t.Error("Expected no dispatcher after processing stopped")
+	}
+}
+
+func TestBridge_HealthWhileLocked(t *testing.T) {
+	bridge := NewBridge(nil, logger.NewLogger(serviceName, nil))
+	bridge.register(newDatabaseManager(config.DatabaseConfig{
+		Name:             "db1",
+		ConnectionString: "postgres://u:p@localhost:5432/db1",
+		ActiveModules:    []string{"pgb_mail"},
+	}, bridge))
+
+	// A database being started holds the bridge lock
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+
+	done := make(chan health.Report, 1)
+	go func() {
+		bridge.Stalled(time.Now())
+		done <- bridge.Health()
+	}()
+
+	select {
+	case report := <-done:
+		if len(report.Databases) != 1 || report.Databases[0].Name != "db1" {
+			t.Errorf("Expected db1 to be reported, got %+v", report)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Health and Stalled not to wait for the bridge lock")
+	}
+}
+
+func TestDatabaseManager_StopListeningHonoursDeadline(t *testing.T) {
+	bridge := NewBridge(nil, logger.NewLogger(serviceName, nil))
+	mgr := newDatabaseManager(config.DatabaseConfig{
+		Name:             "db1",
+		ConnectionString: "postgres://u:p@localhost:5432/db1",
+	}, bridge)
+
+	// A pause change stuck on the database
+	started := make(chan struct{})
+	mgr.control = worker.NewPool("db1/pgb_control", worker.Config{Workers: 1}, func(ctx context.Context, payload string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil)
+	mgr.control.Start()
+	mgr.control.Submit(context.Background(), worker.Job{Payload: "pgb_mail"})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	mgr.stopListening(ctx)
+
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("Expected stopping to give up at the deadline, took %s", elapsed)
+	}
+}
+
+func TestDatabaseManager_ModulesFollowReconnect(t *testing.T) {
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("Skipping integration test: TEST_DATABASE_URL not set")
+	}
+
+	const appName = "pgbridge-reconnect-test"
+	bridge := NewBridge(nil, logger.NewLogger(serviceName, nil))
+	mgr := newDatabaseManager(config.DatabaseConfig{
+		Name:             "db1",
+		ConnectionString: connStr,
+		Pool:             config.PoolConfig{MaxConns: 2, MinConns: 1, MinConnsSet: true, ApplicationName: appName},
+	}, bridge)
+	defer mgr.connMgr.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := mgr.connect(ctx); err != nil {
+		t.Skipf("Skipping integration test: database not reachable: %v", err)
+	}
+
+	oldPool := mgr.connMgr.GetPool()
+	module, err := modules.New(ctx, "pgb_mail", modules.Context{DatabaseName: mgr.name, Pool: oldPool, Logger: mgr.logger})
+	if err != nil {
+		t.Fatalf("Failed to create module: %v", err)
+	}
+	if err := module.Initialize(ctx, oldPool); err != nil {
+		t.Fatalf("Failed to initialize module: %v", err)
+	}
+	if _, err := database.NewMigrator(oldPool, mgr.name, nil).Up(ctx, "pgb_mail", modules.Migrations("pgb_mail")); err != nil {
+		t.Fatalf("Failed to migrate module: %v", err)
+	}
+	mgr.mu.Lock()
+	mgr.modules["pgb_mail"] = module
+	mgr.mu.Unlock()
+
+	// The server drops the connections of the pool
+	admin, err := pgx.Connect(ctx, connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer admin.Close(ctx)
+	if _, err := admin.Exec(ctx, "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE application_name = $1", appName); err != nil {
+		t.Fatalf("Failed to terminate the pool's connections: %v", err)
+	}
+
+	if err := mgr.connMgr.Reconnect(); err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	if mgr.connMgr.GetPool() == oldPool {
+		t.Fatal("Expected a new pool after reconnecting")
+	}
+
+	// The module was handed the new pool, the old one is closed
+	if _, err := module.(modules.QueueDepthModule).QueueDepth(ctx); err != nil {
+		t.Errorf("Expected the module to use the new pool, got: %v", err)
+	}
+	if err := oldPool.Ping(ctx); err == nil {
+		t.Error("Expected the old pool to be closed")
+	}
+}
+
+func TestBridge_RecampaignWaitsForInterval(t *testing.T) {
+	bridge := NewBridge(nil, logger.NewLogger(serviceName, nil))
+	bridge.LeaderInterval = 100 * time.Millisecond
+	mgr := newDatabaseManager(config.DatabaseConfig{
+		Name:             "db1",
+		ConnectionString: "postgres://u:p@127.0.0.1:1/db1",
+	}, bridge)
+	bridge.register(mgr)
+
+	electing := func() bool {
+		bridge.mu.Lock()
+		defer bridge.mu.Unlock()
+		return mgr.elector != nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		bridge.recampaign(ctx, mgr)
+		close(done)
+	}()
+
+	// No new session right after the failed takeover
+	time.Sleep(20 * time.Millisecond)
+	if electing() {
+		t.Fatal("Expected no campaign before the interval passed")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a campaign once the interval passed")
+	}
+	if !electing() {
+		t.Error("Expected the database to campaign again")
+	}
+
+	bridge.mu.Lock()
+	mgr.stopElection()
+	bridge.mu.Unlock()
+}
+
+// initCountingModule counts the calls of Initialize
+type initCountingModule struct {
+	modules.Module
+	initialized *atomic.Int32
+}
+
+func (initCountingModule) Name() string           { return "pgb_init_counting" }
+func (initCountingModule) GetChannelName() string { return "pgb_init_counting" }
+
+func (m initCountingModule) Initialize(ctx context.Context, pool *pgxpool.Pool) error {
+	m.initialized.Add(1)
+	return nil
+}
+
+func TestDatabaseManager_InvalidOptionsBeforeInitialize(t *testing.T) {
+	var initialized atomic.Int32
+	modules.Register("pgb_init_counting", func(ctx context.Context, mc modules.Context) (modules.Module, error) {
+		return initCountingModule{initialized: &initialized}, nil
+	})
+
+	bridge := NewBridge(nil, logger.NewLogger(serviceName, nil))
+	mgr := newDatabaseManager(config.DatabaseConfig{
+		Name:             "db1",
+		ConnectionString: "postgres://u:p@127.0.0.1:1/db1",
+		ActiveModules:    []string{"pgb_init_counting"},
+		ModuleOptions: map[string]config.ModuleOptions{
+			"pgb_init_counting": {"sweep_interval": "soon"},
+		},
+	}, bridge)
+
+	if err := mgr.addModule(context.Background(), "pgb_init_counting"); err == nil {
+		t.Fatal("Expected invalid options to be refused")
+	}
+	if n := initialized.Load(); n != 0 {
+		t.Errorf("Expected the module not to be initialized, got %d calls", n)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/metrics"
+)
+
+// Descriptions of the per-database metrics read from the bridge on scrape
+var (
+	connectedDesc = prometheus.NewDesc("pgbridge_database_connected",
+		"Whether the connection pool of a database is connected (1) or not (0).", []string{"database"}, nil)
+	degradedDesc = prometheus.NewDesc("pgbridge_database_degraded",
+		"Whether a database is degraded and retried in the background.", []string{"database"}, nil)
+	listeningDesc = prometheus.NewDesc("pgbridge_listener_listening",
+		"Whether the LISTEN connection of a database is established.", []string{"database"}, nil)
+	standbyDesc = prometheus.NewDesc("pgbridge_database_standby",
+		"Whether another instance leads a database and this one stands by.", []string{"database"}, nil)
+
+	acquiredConnsDesc = prometheus.NewDesc("pgbridge_pool_acquired_connections",
+		"Connections currently acquired from the pool.", []string{"database"}, nil)
+	idleConnsDesc = prometheus.NewDesc("pgbridge_pool_idle_connections",
+		"Idle connections in the pool.", []string{"database"}, nil)
+	totalConnsDesc = prometheus.NewDesc("pgbridge_pool_total_connections",
+		"Total connections in the pool.", []string{"database"}, nil)
+	constructingConnsDesc = prometheus.NewDesc("pgbridge_pool_constructing_connections",
+		"Connections being established.", []string{"database"}, nil)
+	maxConnsDesc = prometheus.NewDesc("pgbridge_pool_max_connections",
+		"Maximum size of the pool.", []string{"database"}, nil)
+	acquireCountDesc = prometheus.NewDesc("pgbridge_pool_acquires_total",
+		"Connections acquired from the current pool.", []string{"database"}, nil)
+	emptyAcquireCountDesc = prometheus.NewDesc("pgbridge_pool_empty_acquires_total",
+		"Acquires from the current pool that had to wait for a connection.", []string{"database"}, nil)
+	canceledAcquireCountDesc = prometheus.NewDesc("pgbridge_pool_canceled_acquires_total",
+		"Acquires from the current pool that were canceled.", []string{"database"}, nil)
+
+	logDroppedDesc = prometheus.NewDesc("pgbridge_log_entries_dropped_total",
+		"Database log entries dropped because the log channel was full.", nil, nil)
+)
+
+// bridgeCollector exports the connection state and pool statistics of
+// every database, read when metrics are scraped
+type bridgeCollector struct {
+	bridge *Bridge
+}
+
+// registerMetrics adds the bridge's database metrics to the registry
+func registerMetrics(bridge *Bridge) error {
+	return metrics.Registry.Register(bridgeCollector{bridge: bridge})
+}
+
+// Describe sends the descriptions of the collected metrics
+func (c bridgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		connectedDesc, degradedDesc, listeningDesc, standbyDesc,
+		acquiredConnsDesc, idleConnsDesc, totalConnsDesc, constructingConnsDesc, maxConnsDesc,
+		acquireCountDesc, emptyAcquireCountDesc, canceledAcquireCountDesc,
+		logDroppedDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect reads the current state of every database
+func (c bridgeCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, db := range c.bridge.Health().Databases {
+		ch <- prometheus.MustNewConstMetric(connectedDesc, prometheus.GaugeValue, boolValue(db.Connected), db.Name)
+		ch <- prometheus.MustNewConstMetric(degradedDesc, prometheus.GaugeValue, boolValue(db.Degraded), db.Name)
+		ch <- prometheus.MustNewConstMetric(listeningDesc, prometheus.GaugeValue, boolValue(db.Listening), db.Name)
+		ch <- prometheus.MustNewConstMetric(standbyDesc, prometheus.GaugeValue, boolValue(db.Standby), db.Name)
+	}
+
+	for name, stats := range c.bridge.ConnectionStats() {
+		ch <- prometheus.MustNewConstMetric(acquiredConnsDesc, prometheus.GaugeValue, float64(stats.AcquiredConns), name)
+		ch <- prometheus.MustNewConstMetric(idleConnsDesc, prometheus.GaugeValue, float64(stats.IdleConns), name)
+		ch <- prometheus.MustNewConstMetric(totalConnsDesc, prometheus.GaugeValue, float64(stats.TotalConns), name)
+		ch <- prometheus.MustNewConstMetric(constructingConnsDesc, prometheus.GaugeValue, float64(stats.ConstructingConns), name)
+		ch <- prometheus.MustNewConstMetric(maxConnsDesc, prometheus.GaugeValue, float64(stats.MaxConns), name)
+		// Pool counters restart when a pool is replaced; Prometheus
+		// handles that as a counter reset
+		ch <- prometheus.MustNewConstMetric(acquireCountDesc, prometheus.CounterValue, float64(stats.AcquireCount), name)
+		ch <- prometheus.MustNewConstMetric(emptyAcquireCountDesc, prometheus.CounterValue, float64(stats.EmptyAcquireCount), name)
+		ch <- prometheus.MustNewConstMetric(canceledAcquireCountDesc, prometheus.CounterValue, float64(stats.CanceledAcquireCount), name)
+	}
+
+	ch <- prometheus.MustNewConstMetric(logDroppedDesc, prometheus.CounterValue, float64(logger.DroppedEntries()))
+}
+
+// boolValue converts a flag to a gauge value
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"pgbridge/internal/config"
+	"pgbridge/internal/database"
+	"pgbridge/internal/modules"
+)
+
+// migrateSubcommands lists the subcommands of 'pgbridge migrate'
+var migrateSubcommands = []command{
+	{"status", "Show applied and pending migrations", migrateStatusCommand},
+	{"up", "Apply pending migrations", migrateUpCommand},
+	{"down", "Roll back the latest migrations of a module", migrateDownCommand},
+}
+
+// migrateCommand shows, applies and rolls back the schema migrations of
+// the configured databases
+func migrateCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printMigrateUsage(stderr)
+		return exitUsage
+	}
+
+	name := args[0]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		printMigrateUsage(stdout)
+		return exitOK
+	}
+
+	for _, cmd := range migrateSubcommands {
+		if cmd.name == name {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+
+	fmt.Fprintf(stderr, "Unknown migrate command '%s'\n\n", name)
+	printMigrateUsage(stderr)
+	return exitUsage
+}
+
+// printMigrateUsage lists the migrate subcommands
+func printMigrateUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s migrate <command> [flags]\n\nCommands:\n", serviceName)
+	for _, cmd := range migrateSubcommands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nModules with migrations: %s\n", strings.Join(modules.MigrationNames(), ", "))
+	fmt.Fprintf(w, "Run '%s migrate <command> -h' for the flags of a command.\n", serviceName)
+}
+
+// migrateOptions holds the flags shared by the migrate subcommands
+type migrateOptions struct {
+	*options
+	database string
+	module   string
+}
+
+// newMigrateOptions creates the flag set of a migrate subcommand
+func newMigrateOptions(name string, stderr io.Writer) *migrateOptions {
+	o := &migrateOptions{options: newOptions("migrate "+name, "[flags]", stderr)}
+	o.sourceFlags()
+	o.fs.StringVar(&o.database, "database", "", "only the migrations of this database")
+	o.fs.StringVar(&o.module, "module", "", "only the migrations of this module, e.g. pgb_notify")
+	return o
+}
+
+// migrateTarget is one database and the modules whose migrations are
+// selected there
+type migrateTarget struct {
+	db      config.DatabaseConfig
+	modules []string
+}
+
+// selectMigrations returns the databases of the configuration matching
+// the flags, with their active modules that have migrations
+func selectMigrations(cfg *config.Config, database, module string) ([]migrateTarget, error) {
+	var targets []migrateTarget
+	found := false
+
+	for _, db := range cfg.Databases {
+		if database != "" && db.Name != database {
+			continue
+		}
+		found = true
+
+		target := migrateTarget{db: db}
+		for _, name := range db.ActiveModules {
+			if modules.Migrations(name) == nil || (module != "" && name != module) {
+				continue
+			}
+			target.modules = append(target.modules, name)
+		}
+		if len(target.modules) > 0 {
+			targets = append(targets, target)
+		}
+	}
+
+	if database != "" && !found {
+		return nil, fmt.Errorf("unknown database '%s'", database)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no migrations match: no selected database has a module with migrations (%s) active", strings.Join(modules.MigrationNames(), ", "))
+	}
+	return targets, nil
+}
+
+// start parses the flags, loads the configuration and selects the
+// databases and modules to migrate
+func (o *migrateOptions) start(args []string, stderr io.Writer) ([]migrateTarget, int) {
+	if err := o.parse(args, false); err != nil {
+		return nil, parseError(err, stderr)
+	}
+	if err := o.checkSource(); err != nil {
+		return nil, parseError(err, stderr)
+	}
+	if o.module != "" && modules.Migrations(o.module) == nil {
+		return nil, parseError(fmt.Errorf("module '%s' has no migrations (modules with migrations: %s)", o.module, strings.Join(modules.MigrationNames(), ", ")), stderr)
+	}
+
+	cfg, err := o.configLoader(nil)()
+	if err != nil {
+		fmt.Fprintf(stderr, "✗ %v\n", err)
+		return nil, exitError
+	}
+	targets, err := selectMigrations(cfg, o.database, o.module)
+	if err != nil {
+		return nil, parseError(err, stderr)
+	}
+	return targets, exitOK
+}
+
+// migrateEach calls fn for every selected module with a migrator of its
+// database; failures are reported per module and turn the exit code to
+// exitError
+func migrateEach(targets []migrateTarget, stderr io.Writer, fn func(ctx context.Context, m *database.Migrator, db, module string) error) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	code := exitOK
+	for _, t := range targets {
+		pool, err := connectDatabase(ctx, t.db)
+		if err != nil {
+			fmt.Fprintf(stderr, "✗ %s: %v\n", t.db.Name, err)
+			code = exitError
+			continue
+		}
+
+		migrator := database.NewMigrator(pool, t.db.Name, nil)
+		for _, module := range t.modules {
+			if err := fn(ctx, migrator, t.db.Name, module); err != nil {
+				fmt.Fprintf(stderr, "✗ %s/%s: %v\n", t.db.Name, module, err)
+				code = exitError
+			}
+		}
+		pool.Close()
+	}
+	return code
+}
+
+// migrateStatusCommand lists every migration of the selected modules and
+// when it was applied
+func migrateStatusCommand(args []string, stdout, stderr io.Writer) int {
+	o := newMigrateOptions("status", stderr)
+	targets, code := o.start(args, stderr)
+	if targets == nil {
+		return code
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tMODULE\tVERSION\tNAME\tAPPLIED")
+	pending := 0
+
+	code = migrateEach(targets, stderr, func(ctx context.Context, m *database.Migrator, db, module string) error {
+		status, err := m.Status(ctx, module, modules.Migrations(module))
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format(time.DateTime)
+			} else {
+				pending++
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", db, module, s.Version, s.Name, applied)
+		}
+		return nil
+	})
+
+	w.Flush()
+	fmt.Fprintf(stdout, "%d pending\n", pending)
+	return code
+}
+
+// migrateUpCommand applies the pending migrations of the selected modules.
+// Migrations rely on the tables the modules create, so new databases need
+// init-schema (or a first start) instead.
+func migrateUpCommand(args []string, stdout, stderr io.Writer) int {
+	o := newMigrateOptions("up", stderr)
+	targets, code := o.start(args, stderr)
+	if targets == nil {
+		return code
+	}
+
+	return migrateEach(targets, stderr, func(ctx context.Context, m *database.Migrator, db, module string) error {
+		applied, err := m.Up(ctx, module, modules.Migrations(module))
+		for _, migration := range applied {
+			fmt.Fprintf(stdout, "✓ %s/%s: applied migration %d (%s)\n", db, module, migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintf(stdout, "✓ %s/%s: up to date\n", db, module)
+		}
+		return err
+	})
+}
+
+// migrateDownCommand rolls back the latest applied migrations of one
+// module
+func migrateDownCommand(args []string, stdout, stderr io.Writer) int {
+	o := newMigrateOptions("down", stderr)
+	steps := o.fs.Int("steps", 1, "number of migrations to roll back")
+
+	targets, code := o.start(args, stderr)
+	if targets == nil {
+		return code
+	}
+	if o.module == "" {
+		return parseError(fmt.Errorf("--module is required"), stderr)
+	}
+	if *steps < 1 {
+		return parseError(fmt.Errorf("invalid steps %d: expected 1 or more", *steps), stderr)
+	}
+
+	return migrateEach(targets, stderr, func(ctx context.Context, m *database.Migrator, db, module string) error {
+		rolledBack, err := m.Down(ctx, module, modules.Migrations(module), *steps)
+		for _, migration := range rolledBack {
+			fmt.Fprintf(stdout, "✓ %s/%s: rolled back migration %d (%s)\n", db, module, migration.Version, migration.Name)
+		}
+		if err == nil && len(rolledBack) == 0 {
+			fmt.Fprintf(stdout, "✓ %s/%s: nothing to roll back\n", db, module)
+		}
+		return err
+	})
+}
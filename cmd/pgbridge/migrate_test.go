@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrate_Usage(t *testing.T) {
+	if code, _, _ := runArgs("migrate"); code != exitUsage {
+		t.Errorf("Expected exit %d without a subcommand, got %d", exitUsage, code)
+	}
+	if code, _, stderr := runArgs("migrate", "sideways"); code != exitUsage || !strings.Contains(stderr, "Unknown migrate command") {
+		t.Errorf("Expected an unknown command error, got %d %q", code, stderr)
+	}
+
+	code, stdout, _ := runArgs("migrate", "help")
+	if code != exitOK || !strings.Contains(stdout, "pgb_notify") {
+		t.Errorf("Expected the usage to list pgb_notify, got %d %q", code, stdout)
+	}
+}
+
+func TestMigrate_ArgumentErrors(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@localhost:5432/db1, [pgb_mail, pgb_notify]\ndb2, postgres://u:p@localhost:5432/db2, [pgb_mail]\n")
+
+	cases := map[string][]string{
+		"no source":         {"migrate", "status"},
+		"unknown db":        {"migrate", "status", "--config", path, "--database", "db3"},
+		"no migrations":     {"migrate", "up", "--config", path, "--module", "pgb_instance_roles"},
+		"inactive module":   {"migrate", "up", "--config", path, "--database", "db2", "--module", "pgb_notify"},
+		"down no module":    {"migrate", "down", "--config", path},
+		"down invalid step": {"migrate", "down", "--config", path, "--module", "pgb_notify", "--steps", "0"},
+		"positional":        {"migrate", "status", "--config", path, "extra"},
+	}
+
+	for name, args := range cases {
+		code, _, stderr := runArgs(args...)
+		if code != exitUsage {
+			t.Errorf("%s: expected exit %d, got %d: %s", name, exitUsage, code, stderr)
+		}
+	}
+}
+
+func TestMigrate_Unreachable(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@127.0.0.1:1/db1?connect_timeout=1, [pgb_notify]\n")
+
+	code, _, stderr := runArgs("migrate", "up", "--config", path)
+	if code != exitError || !strings.Contains(stderr, "db1") {
+		t.Errorf("Expected a connection error, got %d %q", code, stderr)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+// Modules compiled into pgbridge. Each package registers its modules with
+// modules.Register from its init function; in-house modules are added by
+// importing them here.
+import (
+	_ "pgbridge/internal/modules/mail"
+	_ "pgbridge/internal/modules/notify"
+	_ "pgbridge/internal/modules/roles"
+)
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"slices"
+	"syscall"
+
+	"pgbridge/internal/config"
+	"pgbridge/internal/modules/pause"
+)
+
+// pauseCommand pauses a module on a database: running instances keep
+// LISTENing but defer its notifications until it is resumed
+func pauseCommand(args []string, stdout, stderr io.Writer) int {
+	return setPausedCommand("pause", true, args, stdout, stderr)
+}
+
+// resumeCommand resumes a paused module; running instances process its
+// queue right away
+func resumeCommand(args []string, stdout, stderr io.Writer) int {
+	return setPausedCommand("resume", false, args, stdout, stderr)
+}
+
+// setPausedCommand records the pause state of a module in the control
+// table of its database, where it survives restarts
+func setPausedCommand(name string, paused bool, args []string, stdout, stderr io.Writer) int {
+	o := newOptions(name, "[flags]", stderr)
+	o.sourceFlags()
+	database := o.fs.String("database", "", "the database of the module, as named in the configuration")
+	module := o.fs.String("module", "", "the module to "+name+", e.g. pgb_mail")
+	var reason string
+	if paused {
+		o.fs.StringVar(&reason, "reason", "", "why the module is paused; shown by status and logged")
+	}
+
+	if err := o.parse(args, false); err != nil {
+		return parseError(err, stderr)
+	}
+	if err := o.checkSource(); err != nil {
+		return parseError(err, stderr)
+	}
+	if *database == "" || *module == "" {
+		return parseError(fmt.Errorf("--database and --module are required"), stderr)
+	}
+
+	cfg, err := o.configLoader(nil)()
+	if err != nil {
+		fmt.Fprintf(stderr, "✗ %v\n", err)
+		return exitError
+	}
+	db, err := selectModule(cfg, *database, *module)
+	if err != nil {
+		return parseError(err, stderr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := setPaused(ctx, db, *module, paused, reason); err != nil {
+		fmt.Fprintf(stderr, "✗ %s/%s: %v\n", db.Name, *module, err)
+		return exitError
+	}
+
+	if paused {
+		fmt.Fprintf(stdout, "✓ %s/%s paused; running instances defer its notifications until '%s resume'\n", db.Name, *module, serviceName)
+	} else {
+		fmt.Fprintf(stdout, "✓ %s/%s resumed; running instances process its queue now\n", db.Name, *module)
+	}
+	return exitOK
+}
+
+// selectModule returns the configured database running the module
+func selectModule(cfg *config.Config, database, module string) (config.DatabaseConfig, error) {
+	for _, db := range cfg.Databases {
+		if db.Name != database {
+			continue
+		}
+		if !slices.Contains(db.ActiveModules, module) {
+			return db, fmt.Errorf("module '%s' is not active on %s (active: %v)", module, database, db.ActiveModules)
+		}
+		return db, nil
+	}
+	return config.DatabaseConfig{}, fmt.Errorf("unknown database '%s'", database)
+}
+
+// setPaused creates the control table if needed and updates the state of
+// the module
+func setPaused(ctx context.Context, db config.DatabaseConfig, module string, paused bool, reason string) error {
+	pool, err := connectDatabase(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	if err := pause.NewPauseModule(nil, nil).Initialize(ctx, pool); err != nil {
+		return err
+	}
+	return pause.Set(ctx, pool, module, paused, reason, operator())
+}
+
+// operator names who ran the command, as user@host
+func operator() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
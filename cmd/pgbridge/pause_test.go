@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPause_ArgumentErrors(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@localhost:5432/db1, [pgb_mail]\n")
+
+	cases := map[string][]string{
+		"no source":       {"pause", "--database", "db1", "--module", "pgb_mail"},
+		"no database":     {"pause", "--config", path, "--module", "pgb_mail"},
+		"no module":       {"resume", "--config", path, "--database", "db1"},
+		"unknown db":      {"pause", "--config", path, "--database", "db2", "--module", "pgb_mail"},
+		"inactive module": {"pause", "--config", path, "--database", "db1", "--module", "pgb_notify"},
+		"resume reason":   {"resume", "--config", path, "--database", "db1", "--module", "pgb_mail", "--reason", "x"},
+		"positional":      {"pause", "--config", path, "--database", "db1", "--module", "pgb_mail", "extra"},
+	}
+
+	for name, args := range cases {
+		code, _, stderr := runArgs(args...)
+		if code != exitUsage {
+			t.Errorf("%s: expected exit %d, got %d: %s", name, exitUsage, code, stderr)
+		}
+	}
+}
+
+func TestPause_Unreachable(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@127.0.0.1:1/db1?connect_timeout=1, [pgb_mail]\n")
+
+	code, _, stderr := runArgs("pause", "--config", path, "--database", "db1", "--module", "pgb_mail", "--reason", "SMTP incident")
+	if code != exitError || !strings.Contains(stderr, "db1/pgb_mail") {
+		t.Errorf("Expected a connection error, got %d %q", code, stderr)
+	}
+}
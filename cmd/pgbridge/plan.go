@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/config"
+	"pgbridge/internal/database"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/modules/control"
+	"pgbridge/internal/modules/pause"
+)
+
+// planQueueLimit caps the queued item ids printed per module
+const planQueueLimit = 10
+
+// databasePlan is what starting one database would do
+type databasePlan struct {
+	name    string
+	schema  []database.SchemaChange
+	modules []modulePlan
+	err     error
+}
+
+// modulePlan is what starting one module would do
+type modulePlan struct {
+	name       string
+	channel    string
+	changes    []database.SchemaChange
+	migrations []database.Migration
+	queued     []string
+
+	// note explains why a module has no plan
+	note string
+	err  error
+}
+
+// dryRun connects to every database and prints what run would create and
+// process, without executing DDL, sending mail or forwarding notifications.
+// All connections are opened read-only, so nothing can be written even by
+// mistake.
+func dryRun(o *options, stdout, stderr io.Writer) int {
+	cfg, err := o.configLoader(nil)()
+	if err != nil {
+		fmt.Fprintf(stderr, "✗ %v\n", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	central := &lazyPool{open: func(ctx context.Context) (*pgxpool.Pool, error) {
+		centralConfig, err := config.LoadCentralConfig(o.centralConfigPath, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load central config: %w", err)
+		}
+		pool, err := connectReadOnly(ctx, centralConfig.ConnectionString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to central database: %w", err)
+		}
+		return pool, nil
+	}}
+	defer central.close()
+
+	fmt.Fprintf(stdout, "Dry run: nothing is created, sent or forwarded\n\n")
+
+	var plans []databasePlan
+	for _, db := range cfg.Databases {
+		plans = append(plans, planDatabase(ctx, db, central.get))
+	}
+
+	// Configuration changes are followed on the central database
+	if o.dbConfig {
+		plans = append(plans, planCentral(ctx, central.get))
+	}
+
+	code := exitOK
+	for _, plan := range plans {
+		if !printPlan(stdout, plan) {
+			code = exitError
+		}
+	}
+
+	return code
+}
+
+// planDatabase plans the schema initializer and every module of a database
+func planDatabase(ctx context.Context, db config.DatabaseConfig, centralPool func(ctx context.Context) (*pgxpool.Pool, error)) databasePlan {
+	plan := databasePlan{name: db.Name}
+
+	pool, err := connectReadOnly(ctx, db.ConnectionString)
+	if err != nil {
+		plan.err = err
+		return plan
+	}
+	defer pool.Close()
+
+	plan.schema, err = database.NewSchemaInitializer(pool, db.Name, nil).Plan(ctx)
+	if err != nil {
+		plan.err = err
+		return plan
+	}
+
+	// The control table is created for every database
+	plan.modules = append(plan.modules, planModule(ctx, pool, pause.NewPauseModule(nil, nil)))
+
+	for _, moduleName := range db.ActiveModules {
+		module, err := modules.New(ctx, moduleName, modules.Context{
+			DatabaseName: db.Name,
+			Pool:         pool,
+			CentralPool:  centralPool,
+			Options:      db.Options(moduleName),
+		})
+		if err != nil {
+			plan.modules = append(plan.modules, modulePlan{name: moduleName, err: err})
+			continue
+		}
+		plan.modules = append(plan.modules, planModule(ctx, pool, module))
+	}
+
+	return plan
+}
+
+// planCentral plans the configuration watcher of --db-config mode
+func planCentral(ctx context.Context, centralPool func(ctx context.Context) (*pgxpool.Pool, error)) databasePlan {
+	plan := databasePlan{name: "central"}
+
+	pool, err := centralPool(ctx)
+	if err != nil {
+		plan.err = err
+		return plan
+	}
+
+	module := control.NewControlModule(0, func() {}, nil)
+	plan.modules = append(plan.modules, planModule(ctx, pool, module))
+	return plan
+}
+
+// planModule asks a module for its plan and checks its objects against
+// the database
+func planModule(ctx context.Context, pool *pgxpool.Pool, module modules.Module) modulePlan {
+	mp := modulePlan{name: module.Name(), channel: module.GetChannelName()}
+
+	planned, ok := module.(modules.PlannedModule)
+	if !ok {
+		mp.note = "does not support dry runs; Initialize and ProcessQueue not checked"
+		return mp
+	}
+
+	plan, err := planned.Plan(ctx)
+	if err != nil {
+		mp.err = err
+		return mp
+	}
+	mp.queued = plan.Queued
+
+	mp.changes, err = database.PlanSchema(ctx, pool, plan.Objects)
+	if err != nil {
+		mp.err = err
+		return mp
+	}
+
+	mp.migrations, err = database.NewMigrator(pool, "", nil).Pending(ctx, module.Name(), modules.Migrations(module.Name()))
+	if err != nil {
+		mp.err = err
+	}
+	return mp
+}
+
+// printPlan prints the plan of a database and returns false if planning
+// failed anywhere
+func printPlan(w io.Writer, plan databasePlan) bool {
+	if plan.err != nil {
+		fmt.Fprintf(w, "✗ %s: %v\n\n", plan.name, plan.err)
+		return false
+	}
+
+	ok := true
+	fmt.Fprintf(w, "✓ %s\n", plan.name)
+	printChanges(w, plan.schema)
+
+	for _, mp := range plan.modules {
+		if mp.err != nil {
+			fmt.Fprintf(w, "  ✗ %s: %v\n", mp.name, mp.err)
+			ok = false
+			continue
+		}
+
+		fmt.Fprintf(w, "  %s: LISTEN %s\n", mp.name, mp.channel)
+		if mp.note != "" {
+			fmt.Fprintf(w, "    ⚠ %s\n", mp.note)
+			continue
+		}
+		printChanges(w, mp.changes)
+		for _, migration := range mp.migrations {
+			fmt.Fprintf(w, "    + migration %d: %s\n", migration.Version, migration.Name)
+		}
+		fmt.Fprintf(w, "    queue: %s\n", describeQueued(mp.queued))
+	}
+
+	fmt.Fprintln(w)
+	return ok
+}
+
+// printChanges prints schema changes, marking what would be created (+),
+// replaced (~) or left as is (=)
+func printChanges(w io.Writer, changes []database.SchemaChange) {
+	for _, change := range changes {
+		mark := "="
+		switch change.Action {
+		case database.ActionCreate, database.ActionAdd:
+			mark = "+"
+		case database.ActionReplace:
+			mark = "~"
+		}
+		fmt.Fprintf(w, "    %s %s\n", mark, change)
+	}
+}
+
+// describeQueued summarizes the items ProcessQueue would pick up
+func describeQueued(queued []string) string {
+	if len(queued) == 0 {
+		return "no items to process"
+	}
+
+	shown := queued
+	if len(shown) > planQueueLimit {
+		shown = shown[:planQueueLimit]
+	}
+	description := fmt.Sprintf("%d items to process: %s", len(queued), strings.Join(shown, ", "))
+	if len(queued) > len(shown) {
+		description += fmt.Sprintf(", … (%d more)", len(queued)-len(shown))
+	}
+	return description
+}
+
+// connectReadOnly opens a pool whose transactions are read-only by
+// default, and checks that the database is reachable
+func connectReadOnly(ctx context.Context, connString string) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	poolConfig.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"pgbridge/internal/database"
+	"pgbridge/internal/modules"
+)
+
+// unplannedModule does not implement modules.PlannedModule
+type unplannedModule struct {
+	modules.Module
+}
+
+func (unplannedModule) Name() string           { return "pgb_unplanned" }
+func (unplannedModule) GetChannelName() string { return "pgb_unplanned" }
+
+func TestPrintPlan(t *testing.T) {
+	plan := databasePlan{
+		name: "db1",
+		schema: []database.SchemaChange{
+			{Object: database.SchemaObject{Kind: database.ObjectSchema, Schema: "pgb"}, Action: database.ActionNone},
+		},
+		modules: []modulePlan{
+			{
+				name:    "pgb_mail",
+				channel: "pgb_mail",
+				changes: []database.SchemaChange{
+					{Object: database.SchemaObject{Kind: database.ObjectTable, Schema: "pgb", Name: "pgb_mail"}, Action: database.ActionNone},
+					{Object: database.SchemaObject{Kind: database.ObjectColumn, Schema: "pgb", Table: "pgb_mail", Name: "cancelled_ts"}, Action: database.ActionAdd},
+				},
+				queued: []string{"4", "7"},
+			},
+			{
+				name:    "pgb_notify",
+				channel: "pgb_notify",
+				changes: []database.SchemaChange{
+					{Object: database.SchemaObject{Kind: database.ObjectFunction, Schema: "pgb", Name: "trg_pgb_send_notification"}, Action: database.ActionReplace},
+				},
+				migrations: []database.Migration{
+					{Version: 1, Name: "drop duplicate send notification triggers"},
+				},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	if !printPlan(&out, plan) {
+		t.Error("Expected the plan to succeed")
+	}
+
+	for _, expected := range []string{
+		"✓ db1",
+		"= schema pgb exists",
+		"pgb_mail: LISTEN pgb_mail",
+		"+ add column pgb.pgb_mail.cancelled_ts",
+		"queue: 2 items to process: 4, 7",
+		"~ replace function pgb.trg_pgb_send_notification()",
+		"+ migration 1: drop duplicate send notification triggers",
+		"queue: no items to process",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in the plan, got:\n%s", expected, out.String())
+		}
+	}
+
+	plan.modules[1].err = context.DeadlineExceeded
+	if printPlan(&bytes.Buffer{}, plan) {
+		t.Error("Expected a failed module to fail the plan")
+	}
+}
+
+func TestPlanModule_Unplanned(t *testing.T) {
+	mp := planModule(context.Background(), nil, unplannedModule{})
+	if mp.note == "" || mp.err != nil {
+		t.Errorf("Expected a note for a module without a plan, got %+v", mp)
+	}
+}
+
+func TestDescribeQueued(t *testing.T) {
+	queued := make([]string, planQueueLimit+2)
+	for i := range queued {
+		queued[i] = "1"
+	}
+
+	if got := describeQueued(queued); !strings.HasSuffix(got, "… (2 more)") {
+		t.Errorf("Expected the ids to be capped, got %q", got)
+	}
+}
+
+func TestCLI_DryRunUnreachable(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@127.0.0.1:1/db1?connect_timeout=2, [pgb_mail]\n")
+
+	code, stdout, _ := runArgs("run", "--dry-run", path)
+	if code != exitError {
+		t.Errorf("Expected exit %d, got %d", exitError, code)
+	}
+	if !strings.Contains(stdout, "✗ db1") {
+		t.Errorf("Expected the database to be reported as failed, got %q", stdout)
+	}
+	if strings.Contains(stdout, "pgbridge is running") {
+		t.Error("Expected a dry run not to start the bridge")
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"pgbridge/internal/config"
+	"pgbridge/internal/modules"
+)
+
+// queueColumnWidth truncates long text columns of 'queue list'
+const queueColumnWidth = 40
+
+// queueSubcommands lists the subcommands of 'pgbridge queue'
+var queueSubcommands = []command{
+	{"list", "List queue items", queueListCommand},
+	{"show", "Show one queue item", queueShowCommand},
+	{"requeue", "Reset failed items and notify them again", queueRequeueCommand},
+	{"cancel", "Cancel unsent items", queueCancelCommand},
+	{"purge", "Delete sent items older than a number of days", queuePurgeCommand},
+}
+
+// queueCommand inspects and repairs the queue tables of the configured
+// databases directly, whether or not the daemon is running
+func queueCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printQueueUsage(stderr)
+		return exitUsage
+	}
+
+	name := args[0]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		printQueueUsage(stdout)
+		return exitOK
+	}
+
+	for _, cmd := range queueSubcommands {
+		if cmd.name == name {
+			return cmd.run(args[1:], stdout, stderr)
+		}
+	}
+
+	fmt.Fprintf(stderr, "Unknown queue command '%s'\n\n", name)
+	printQueueUsage(stderr)
+	return exitUsage
+}
+
+// printQueueUsage lists the queue subcommands
+func printQueueUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s queue <command> [flags] [id...]\n\nCommands:\n", serviceName)
+	for _, cmd := range queueSubcommands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nModules with a queue: %s\n", strings.Join(modules.QueueNames(), ", "))
+	fmt.Fprintf(w, "Run '%s queue <command> -h' for the flags of a command.\n", serviceName)
+}
+
+// queueOptions holds the flags shared by the queue subcommands
+type queueOptions struct {
+	*options
+	database string
+	module   string
+}
+
+// newQueueOptions creates the flag set of a queue subcommand
+func newQueueOptions(name, usage string, stderr io.Writer) *queueOptions {
+	o := &queueOptions{options: newOptions("queue "+name, usage, stderr)}
+	o.sourceFlags()
+	o.fs.StringVar(&o.database, "database", "", "only the queues of this database")
+	o.fs.StringVar(&o.module, "module", "", "only the queue of this module, e.g. pgb_mail")
+	return o
+}
+
+// filterFlags adds the flags selecting items
+func (o *queueOptions) filterFlags(filter *modules.QueueFilter) {
+	o.fs.StringVar(&filter.Recipient, "recipient", "", "only items whose recipient contains this text")
+	o.fs.DurationVar(&filter.OlderThan, "older-than", 0, "only items created at least this long ago, e.g. 24h")
+}
+
+// skipUnsupported ignores a status some of the selected queues do not
+// have, unless the module was selected explicitly
+func (o *queueOptions) skipUnsupported(err error) error {
+	if o.module == "" && errors.Is(err, modules.ErrUnsupportedStatus) {
+		return nil
+	}
+	return err
+}
+
+// queueTarget is the queue of one module on one database
+type queueTarget struct {
+	db     config.DatabaseConfig
+	module string
+}
+
+// String returns database/module
+func (t queueTarget) String() string {
+	return t.db.Name + "/" + t.module
+}
+
+// queueSession is a parsed queue subcommand ready to run against its
+// targets
+type queueSession struct {
+	cfg    *config.Config
+	ctx    context.Context
+	stop   context.CancelFunc
+	stderr io.Writer
+}
+
+// start parses the flags, loads the configuration and returns the
+// positional arguments
+func (o *queueOptions) start(args []string, stderr io.Writer) (*queueSession, []string, int) {
+	if err := o.parseFlags(args); err != nil {
+		return nil, nil, parseError(err, stderr)
+	}
+	if err := o.checkSource(); err != nil {
+		return nil, nil, parseError(err, stderr)
+	}
+	if o.module != "" && !modules.HasQueue(o.module) {
+		return nil, nil, parseError(fmt.Errorf("module '%s' has no queue (modules with a queue: %s)", o.module, strings.Join(modules.QueueNames(), ", ")), stderr)
+	}
+
+	cfg, err := o.configLoader(nil)()
+	if err != nil {
+		fmt.Fprintf(stderr, "✗ %v\n", err)
+		return nil, nil, exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	return &queueSession{cfg: cfg, ctx: ctx, stop: stop, stderr: stderr}, o.fs.Args(), exitOK
+}
+
+// selectQueues returns the queues of the configuration matching the
+// database and module flags
+func selectQueues(cfg *config.Config, database, module string) ([]queueTarget, error) {
+	var targets []queueTarget
+	found := false
+
+	for _, db := range cfg.Databases {
+		if database != "" && db.Name != database {
+			continue
+		}
+		found = true
+		for _, name := range db.ActiveModules {
+			if !modules.HasQueue(name) || (module != "" && name != module) {
+				continue
+			}
+			targets = append(targets, queueTarget{db: db, module: name})
+		}
+	}
+
+	if database != "" && !found {
+		return nil, fmt.Errorf("unknown database '%s'", database)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no queue matches: no selected database has a module with a queue (%s) active", strings.Join(modules.QueueNames(), ", "))
+	}
+	return targets, nil
+}
+
+// selectQueue returns the single queue selected by the flags; item ids are
+// only meaningful within one table
+func selectQueue(cfg *config.Config, database, module string) (queueTarget, error) {
+	targets, err := selectQueues(cfg, database, module)
+	if err != nil {
+		return queueTarget{}, err
+	}
+	if len(targets) > 1 {
+		names := make([]string, len(targets))
+		for i, t := range targets {
+			names[i] = t.String()
+		}
+		return queueTarget{}, fmt.Errorf("item ids belong to one queue: select one of %s with --database and --module", strings.Join(names, ", "))
+	}
+	return targets[0], nil
+}
+
+// parseIDs parses item ids given as arguments
+func parseIDs(args []string) ([]int, error) {
+	ids := make([]int, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid item id '%s': expected a positive integer", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// each opens the queue of every target in turn and calls fn; failures are
+// reported per target and turn the exit code to exitError
+func (s *queueSession) each(targets []queueTarget, fn func(t queueTarget, q modules.Queue) error) int {
+	code := exitOK
+	for _, t := range targets {
+		if err := s.with(t, fn); err != nil {
+			fmt.Fprintf(s.stderr, "✗ %s: %v\n", t, err)
+			code = exitError
+		}
+	}
+	return code
+}
+
+// with opens the queue of a target for the duration of fn
+func (s *queueSession) with(t queueTarget, fn func(t queueTarget, q modules.Queue) error) error {
+	pool, err := connectDatabase(s.ctx, t.db)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	q, err := modules.NewQueue(t.module, pool, t.db.Name)
+	if err != nil {
+		return err
+	}
+	return fn(t, q)
+}
+
+// queueListCommand lists the items of the selected queues
+func queueListCommand(args []string, stdout, stderr io.Writer) int {
+	o := newQueueOptions("list", "[flags]", stderr)
+	var filter modules.QueueFilter
+	o.fs.StringVar(&filter.Status, "status", modules.QueueStatusPending, "item status: "+strings.Join(modules.QueueStatuses, ", "))
+	o.filterFlags(&filter)
+	o.fs.IntVar(&filter.Limit, "limit", 50, "maximum number of items per queue; 0 for no limit")
+	asJSON := o.fs.Bool("json", false, "print the items as JSON")
+
+	s, rest, code := o.start(args, stderr)
+	if s == nil {
+		return code
+	}
+	defer s.stop()
+	if len(rest) > 0 {
+		return parseError(fmt.Errorf("unexpected arguments: %v", rest), stderr)
+	}
+	if err := modules.ValidateQueueStatus(filter.Status); err != nil {
+		return parseError(err, stderr)
+	}
+	if filter.Limit < 0 {
+		return parseError(fmt.Errorf("invalid limit %d: expected 0 or more", filter.Limit), stderr)
+	}
+
+	targets, err := selectQueues(s.cfg, o.database, o.module)
+	if err != nil {
+		return parseError(err, stderr)
+	}
+
+	type listedItem struct {
+		Database string `json:"database"`
+		Module   string `json:"module"`
+		modules.QueueItem
+	}
+	listed := []listedItem{}
+
+	code = s.each(targets, func(t queueTarget, q modules.Queue) error {
+		items, err := q.ListItems(s.ctx, filter)
+		if err != nil {
+			return o.skipUnsupported(err)
+		}
+		for _, item := range items {
+			listed = append(listed, listedItem{Database: t.db.Name, Module: t.module, QueueItem: item})
+		}
+		return nil
+	})
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(listed)
+		return code
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tMODULE\tID\tSTATUS\tRETRIES\tCREATED\tRECIPIENT\tSUMMARY\tERROR")
+	for _, item := range listed {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			item.Database, item.Module, item.ID, item.Status, item.RetryCount,
+			item.CreatedAt.Format(time.DateTime),
+			truncate(item.Recipient, queueColumnWidth),
+			truncate(item.Summary, queueColumnWidth),
+			truncate(item.ErrorMessage, queueColumnWidth))
+	}
+	w.Flush()
+	fmt.Fprintf(stdout, "%d items\n", len(listed))
+
+	return code
+}
+
+// queueShowCommand prints every field of one item
+func queueShowCommand(args []string, stdout, stderr io.Writer) int {
+	o := newQueueOptions("show", "[flags] <id>", stderr)
+	asJSON := o.fs.Bool("json", false, "print the item as JSON")
+
+	s, rest, code := o.start(args, stderr)
+	if s == nil {
+		return code
+	}
+	defer s.stop()
+	if len(rest) != 1 {
+		return parseError(fmt.Errorf("expected exactly one item id"), stderr)
+	}
+	ids, err := parseIDs(rest)
+	if err != nil {
+		return parseError(err, stderr)
+	}
+	target, err := selectQueue(s.cfg, o.database, o.module)
+	if err != nil {
+		return parseError(err, stderr)
+	}
+
+	return s.each([]queueTarget{target}, func(t queueTarget, q modules.Queue) error {
+		item, err := q.GetItem(s.ctx, ids[0])
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			encoder := json.NewEncoder(stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(item)
+		}
+		printQueueItem(stdout, t, item)
+		return nil
+	})
+}
+
+// printQueueItem prints an item as a list of fields
+func printQueueItem(w io.Writer, t queueTarget, item *modules.QueueItem) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "queue:\t%s\n", t)
+	fmt.Fprintf(tw, "id:\t%d\n", item.ID)
+	fmt.Fprintf(tw, "status:\t%s\n", item.Status)
+	fmt.Fprintf(tw, "recipient:\t%s\n", item.Recipient)
+	fmt.Fprintf(tw, "summary:\t%s\n", item.Summary)
+	fmt.Fprintf(tw, "retry_count:\t%d\n", item.RetryCount)
+	fmt.Fprintf(tw, "error_message:\t%s\n", item.ErrorMessage)
+	fmt.Fprintf(tw, "created_at:\t%s\n", item.CreatedAt.Format(time.DateTime))
+	if item.SentAt != nil {
+		fmt.Fprintf(tw, "sent_at:\t%s\n", item.SentAt.Format(time.DateTime))
+	}
+	if item.CancelledAt != nil {
+		fmt.Fprintf(tw, "cancelled_at:\t%s\n", item.CancelledAt.Format(time.DateTime))
+	}
+
+	keys := make([]string, 0, len(item.Details))
+	for key := range item.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s:\t%s\n", key, item.Details[key])
+	}
+	tw.Flush()
+}
+
+// queueRequeueCommand resets items and notifies them again, either the
+// given ids or every failed item
+func queueRequeueCommand(args []string, stdout, stderr io.Writer) int {
+	o := newQueueOptions("requeue", "[flags] (--failed | <id>...)", stderr)
+	filter := modules.QueueFilter{Status: modules.QueueStatusFailed}
+	failed := o.fs.Bool("failed", false, "requeue every failed item of the selected queues instead of the given ids")
+	o.filterFlags(&filter)
+
+	s, rest, code := o.start(args, stderr)
+	if s == nil {
+		return code
+	}
+	defer s.stop()
+
+	if *failed {
+		if len(rest) > 0 {
+			return parseError(fmt.Errorf("--failed and item ids are mutually exclusive"), stderr)
+		}
+		targets, err := selectQueues(s.cfg, o.database, o.module)
+		if err != nil {
+			return parseError(err, stderr)
+		}
+
+		return s.each(targets, func(t queueTarget, q modules.Queue) error {
+			items, err := q.ListItems(s.ctx, filter)
+			if err != nil {
+				return o.skipUnsupported(err)
+			}
+			ids := make([]int, len(items))
+			for i, item := range items {
+				ids[i] = item.ID
+			}
+			requeued, err := q.RequeueItems(s.ctx, ids)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "✓ %s: requeued %d failed items\n", t, len(requeued))
+			return nil
+		})
+	}
+
+	if o.isSet("recipient") || o.isSet("older-than") {
+		return parseError(fmt.Errorf("--recipient and --older-than require --failed"), stderr)
+	}
+	return s.applyToIDs(o, rest, stdout, "requeued", modules.Queue.RequeueItems)
+}
+
+// queueCancelCommand cancels unsent items
+func queueCancelCommand(args []string, stdout, stderr io.Writer) int {
+	o := newQueueOptions("cancel", "[flags] <id>...", stderr)
+
+	s, rest, code := o.start(args, stderr)
+	if s == nil {
+		return code
+	}
+	defer s.stop()
+
+	return s.applyToIDs(o, rest, stdout, "cancelled", modules.Queue.CancelItems)
+}
+
+// applyToIDs runs a queue operation on the ids given as arguments and
+// reports the ids it left untouched
+func (s *queueSession) applyToIDs(o *queueOptions, args []string, stdout io.Writer, verb string, op func(q modules.Queue, ctx context.Context, ids []int) ([]int, error)) int {
+	if len(args) == 0 {
+		return parseError(fmt.Errorf("expected one or more item ids"), s.stderr)
+	}
+	ids, err := parseIDs(args)
+	if err != nil {
+		return parseError(err, s.stderr)
+	}
+	target, err := selectQueue(s.cfg, o.database, o.module)
+	if err != nil {
+		return parseError(err, s.stderr)
+	}
+
+	return s.each([]queueTarget{target}, func(t queueTarget, q modules.Queue) error {
+		done, err := op(q, s.ctx, ids)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✓ %s: %s %d of %d items\n", t, verb, len(done), len(ids))
+		if skipped := missingIDs(ids, done); len(skipped) > 0 {
+			fmt.Fprintf(stdout, "  not %s (sent, cancelled or missing): %s\n", verb, joinIDs(skipped))
+		}
+		return nil
+	})
+}
+
+// queuePurgeCommand deletes sent items older than a number of days
+func queuePurgeCommand(args []string, stdout, stderr io.Writer) int {
+	o := newQueueOptions("purge", "[flags] --days <n>", stderr)
+	days := o.fs.Int("days", 0, "delete items sent more than this many days ago (required)")
+
+	s, rest, code := o.start(args, stderr)
+	if s == nil {
+		return code
+	}
+	defer s.stop()
+	if len(rest) > 0 {
+		return parseError(fmt.Errorf("unexpected arguments: %v", rest), stderr)
+	}
+	if *days <= 0 {
+		return parseError(fmt.Errorf("--days is required and must be positive"), stderr)
+	}
+
+	targets, err := selectQueues(s.cfg, o.database, o.module)
+	if err != nil {
+		return parseError(err, stderr)
+	}
+
+	return s.each(targets, func(t queueTarget, q modules.Queue) error {
+		purged, err := q.PurgeSent(s.ctx, *days)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✓ %s: purged %d items sent more than %d days ago\n", t, purged, *days)
+		return nil
+	})
+}
+
+// missingIDs returns the ids of want that are not in got
+func missingIDs(want, got []int) []int {
+	seen := make(map[int]bool, len(got))
+	for _, id := range got {
+		seen[id] = true
+	}
+
+	var missing []int
+	for _, id := range want {
+		if !seen[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// joinIDs formats ids as a comma-separated list
+func joinIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// truncate shortens text to at most n runes, on a single line
+func truncate(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
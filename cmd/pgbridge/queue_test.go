@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"pgbridge/internal/config"
+)
+
+func TestQueue_Usage(t *testing.T) {
+	code, _, stderr := runArgs("queue")
+	if code != exitUsage {
+		t.Errorf("Expected exit %d, got %d", exitUsage, code)
+	}
+	if !strings.Contains(stderr, "requeue") || !strings.Contains(stderr, "pgb_mail") {
+		t.Errorf("Expected the subcommands and queue modules in the usage, got %q", stderr)
+	}
+
+	code, _, stderr = runArgs("queue", "frobnicate")
+	if code != exitUsage || !strings.Contains(stderr, "Unknown queue command") {
+		t.Errorf("Expected an unknown command error, got %d %q", code, stderr)
+	}
+}
+
+func TestQueue_ArgumentErrors(t *testing.T) {
+	path := writeConfig(t, "db1, postgres://u:p@localhost:5432/db1, [pgb_mail, pgb_notify]\n")
+
+	cases := map[string][]string{
+		"no source":       {"queue", "list"},
+		"bad status":      {"queue", "list", "--config", path, "--status", "stuck"},
+		"negative limit":  {"queue", "list", "--config", path, "--limit", "-1"},
+		"no queue":        {"queue", "list", "--config", path, "--module", "pgb_control"},
+		"unknown db":      {"queue", "list", "--config", path, "--database", "db2"},
+		"show no id":      {"queue", "show", "--config", path, "--module", "pgb_mail"},
+		"show ambiguous":  {"queue", "show", "--config", path, "1"},
+		"bad id":          {"queue", "cancel", "--config", path, "--module", "pgb_mail", "abc"},
+		"cancel no ids":   {"queue", "cancel", "--config", path, "--module", "pgb_mail"},
+		"requeue both":    {"queue", "requeue", "--config", path, "--failed", "1"},
+		"filter no -fail": {"queue", "requeue", "--config", path, "--module", "pgb_mail", "--recipient", "a", "1"},
+		"purge no days":   {"queue", "purge", "--config", path},
+	}
+
+	for name, args := range cases {
+		code, _, stderr := runArgs(args...)
+		if code != exitUsage {
+			t.Errorf("%s: expected exit %d, got %d: %s", name, exitUsage, code, stderr)
+		}
+	}
+}
+
+func TestSelectQueues(t *testing.T) {
+	cfg := &config.Config{Databases: []config.DatabaseConfig{
+		{Name: "db1", ActiveModules: []string{"pgb_mail", "pgb_notify", "pgb_control"}},
+		{Name: "db2", ActiveModules: []string{"pgb_mail"}},
+	}}
+
+	names := func(targets []queueTarget) []string {
+		var result []string
+		for _, target := range targets {
+			result = append(result, target.String())
+		}
+		return result
+	}
+
+	targets, err := selectQueues(cfg, "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got, want := names(targets), []string{"db1/pgb_mail", "db1/pgb_notify", "db2/pgb_mail"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	targets, _ = selectQueues(cfg, "", "pgb_mail")
+	if got, want := names(targets), []string{"db1/pgb_mail", "db2/pgb_mail"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if _, err := selectQueues(cfg, "db2", "pgb_notify"); err == nil {
+		t.Error("Expected an error when no queue matches")
+	}
+
+	if _, err := selectQueue(cfg, "db1", ""); err == nil || !strings.Contains(err.Error(), "db1/pgb_notify") {
+		t.Errorf("Expected an ambiguity error listing the queues, got %v", err)
+	}
+	target, err := selectQueue(cfg, "db2", "")
+	if err != nil || target.String() != "db2/pgb_mail" {
+		t.Errorf("Expected db2/pgb_mail, got %v (%v)", target, err)
+	}
+}
+
+func TestQueueHelpers(t *testing.T) {
+	ids, err := parseIDs([]string{"3", "1"})
+	if err != nil || !reflect.DeepEqual(ids, []int{3, 1}) {
+		t.Errorf("Expected [3 1], got %v (%v)", ids, err)
+	}
+	if _, err := parseIDs([]string{"0"}); err == nil {
+		t.Error("Expected an error for id 0")
+	}
+
+	if got := missingIDs([]int{1, 2, 3}, []int{2}); !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("Expected [1 3], got %v", got)
+	}
+	if got := joinIDs([]int{1, 3}); got != "1, 3" {
+		t.Errorf("Expected '1, 3', got %q", got)
+	}
+
+	if got := truncate("short", 10); got != "short" {
+		t.Errorf("Expected 'short', got %q", got)
+	}
+	if got := truncate("a long\nerror message", 10); got != "a long er…" {
+		t.Errorf("Expected 'a long er…', got %q", got)
+	}
+}
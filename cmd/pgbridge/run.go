@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"pgbridge/internal/config"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/systemd"
+	"pgbridge/internal/tracing"
+)
+
+// tracingFlushTimeout bounds how long exiting waits for pending spans to be
+// exported
+const tracingFlushTimeout = 5 * time.Second
+
+// runCommand runs the bridge until it receives SIGTERM or SIGINT
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	o := newOptions("run", "[flags] [config-file]", stderr)
+	o.sourceFlags()
+	o.runFlags()
+	o.logFlags()
+	o.httpFlags("address serving /healthz, /readyz, /metrics and the enqueue API, e.g. :8080")
+	o.apiFlags()
+	plan := o.fs.Bool("dry-run", false, "connect to every database and report what would be created, processed and listened on, then exit without changing anything")
+	if err := o.parse(args, true); err != nil {
+		return parseError(err, stderr)
+	}
+	if err := o.checkSource(); err != nil {
+		return parseError(err, stderr)
+	}
+	if err := validateSchemaCheck(o.schemaCheck); err != nil {
+		return parseError(err, stderr)
+	}
+	if o.apiTokensFile != "" && o.httpAddr == "" {
+		return parseError(fmt.Errorf("--api-tokens-file needs --http-addr"), stderr)
+	}
+	if *plan {
+		return dryRun(o, stdout, stderr)
+	}
+
+	var apiTokens []string
+	if o.apiTokensFile != "" {
+		tokens, err := loadAPITokens(o.apiTokensFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return exitError
+		}
+		apiTokens = tokens
+	}
+
+	// Print banner
+	fmt.Fprintf(stdout, "╔═══════════════════════════════════════╗\n")
+	fmt.Fprintf(stdout, "║   pgbridge - PostgreSQL Bridge        ║\n")
+	fmt.Fprintf(stdout, "║   Version: %-28s║\n", version)
+	fmt.Fprintf(stdout, "╚═══════════════════════════════════════╝\n\n")
+
+	// Create system logger (without database logging initially)
+	systemLogger := logger.NewLogger(serviceName, nil)
+	systemLogger.LogSystemf(logger.LevelInfo, "main", "Starting %s version %s", serviceName, version)
+
+	if o.dbConfig {
+		systemLogger.LogSystemf(logger.LevelInfo, "main", "Using database-based configuration")
+	} else {
+		systemLogger.LogSystemf(logger.LevelInfo, "main", "Using file-based configuration")
+	}
+
+	// The same loader is used on reload
+	loadConfig := o.configLoader(systemLogger)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		systemLogger.LogConfigError(err)
+		fmt.Fprintf(stderr, "%v\n", err)
+		return exitError
+	}
+
+	// Setup signal handling for graceful shutdown and reload
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Export spans from NOTIFY receipt to each query and SMTP or central
+	// insert; pending spans are flushed on exit
+	shutdownTracing, err := tracing.Setup(ctx, o.tracing())
+	if err != nil {
+		systemLogger.LogSystemf(logger.LevelError, "main", "Tracing setup failed: %v", err)
+		fmt.Fprintf(stderr, "%v\n", err)
+		return exitError
+	}
+	defer func() {
+		flushCtx, flushCancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer flushCancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			fmt.Fprintf(stderr, "failed to flush traces: %v\n", err)
+		}
+	}()
+	if o.traceExporter != tracing.ExporterNone {
+		systemLogger.LogSystemf(logger.LevelInfo, "main", "Tracing enabled (%s exporter)", o.traceExporter)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	// Start a database manager for every configured database
+	bridge := NewBridge(loadConfig, systemLogger)
+	bridge.Strict = o.strict
+	bridge.CentralConfigPath = o.centralConfigPath
+	bridge.LeaderElection = o.leaderElection
+	bridge.LeaderInterval = o.leaderInterval
+	bridge.SchemaCheck = o.schemaCheck
+	bridge.LogConfig = o.logConfig()
+	if err := bridge.Start(ctx, cfg); err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		bridge.Shutdown(ctx)
+		return exitError
+	}
+	mainLogger := bridge.Logger()
+
+	var httpSrv *httpServer
+	if o.httpAddr != "" {
+		httpSrv, err = startHTTP(o.httpAddr, bridge, apiTokens)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			bridge.Shutdown(ctx)
+			bridge.Logger().Shutdown()
+			return exitError
+		}
+	}
+
+	// Follow changes made to sw_pgb through the suite
+	if o.dbConfig {
+		if centralConfig, err := config.LoadCentralConfig(o.centralConfigPath, mainLogger); err != nil {
+			mainLogger.LogSystemf(logger.LevelWarn, "main", "Live reconfiguration disabled: %v", err)
+		} else if err := bridge.WatchCentral(ctx, centralConfig.ConnectionString); err != nil {
+			mainLogger.LogSystemf(logger.LevelWarn, "main", "Live reconfiguration disabled: %v", err)
+		}
+	}
+
+	fmt.Fprintf(stdout, "\n✓ pgbridge is running with %d databases\n", bridge.DatabaseCount())
+	if degraded := bridge.DegradedDatabases(); len(degraded) > 0 {
+		fmt.Fprintf(stdout, "⚠ %d databases degraded, retrying in the background: %s\n", len(degraded), strings.Join(degraded, ", "))
+	}
+	fmt.Fprintf(stdout, "✓ Press Ctrl+C to stop, send SIGHUP to reload the configuration\n\n")
+
+	// Tell systemd (Type=notify) that every database is set up
+	watchdog, err := systemd.WatchdogInterval()
+	if err != nil {
+		mainLogger.LogSystemf(logger.LevelWarn, "main", "systemd watchdog disabled: %v", err)
+	}
+	service := startServiceNotifier(bridge, systemd.NewNotifier(os.Getenv("NOTIFY_SOCKET")), watchdog)
+	service.ready()
+
+	// Log service start
+	mainLogger.Log(logger.LevelInfo, "main", &logger.LogEntry{
+		EventType: logger.EventServiceStart,
+		Message:   fmt.Sprintf("pgbridge %s started successfully with %d databases", version, len(cfg.Databases)),
+		Details: map[string]interface{}{
+			"version":        version,
+			"database_count": len(cfg.Databases),
+		},
+	})
+
+	// Wait for shutdown signal, reloading on SIGHUP
+	// (bridge.Logger() is used from here on: database logging may only
+	// become available once a degraded database recovers)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		bridge.Logger().LogSystemf(logger.LevelInfo, "main", "Received SIGHUP")
+		bridge.Reload(ctx)
+	}
+	fmt.Fprintln(stdout, "\n\n⏳ Shutting down gracefully...")
+
+	bridge.Logger().LogSystemf(logger.LevelInfo, "main", "Received shutdown signal")
+	service.stopping()
+
+	// Stop accepting notifications and let in-flight ones finish
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), o.shutdownTimeout)
+	bridge.Logger().LogSystemf(logger.LevelInfo, "main", "Draining in-flight notifications (timeout %s)", o.shutdownTimeout)
+	bridge.Drain(drainCtx)
+	drainCancel()
+
+	bridge.Logger().Log(logger.LevelInfo, "main", &logger.LogEntry{
+		EventType: logger.EventServiceStop,
+		Message:   "pgbridge stopped",
+	})
+
+	// Cleanup; flushes pending database log entries before disconnecting
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), o.shutdownTimeout)
+	bridge.Shutdown(shutdownCtx)
+	shutdownCancel()
+	bridge.Logger().Shutdown()
+
+	// Probes see the service as not ready while it drains; stop serving last
+	if httpSrv != nil {
+		httpSrv.stop()
+	}
+
+	fmt.Fprintln(stdout, "✓ Shutdown complete")
+	return exitOK
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"pgbridge/internal/health"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/systemd"
+)
+
+// statusInterval is how often the STATUS line sent to systemd is refreshed
+const statusInterval = 10 * time.Second
+
+// serviceNotifier reports the bridge to systemd: READY=1 once every
+// database is set up, STATUS lines summarizing the databases, STOPPING=1 on
+// shutdown and, when the unit sets WatchdogSec, WATCHDOG=1 pings for as
+// long as the health checks and listeners make progress
+type serviceNotifier struct {
+	notifier *systemd.Notifier
+	bridge   *Bridge
+	watchdog time.Duration
+
+	status   string
+	stalled  bool
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// startServiceNotifier starts refreshing the status and pinging the
+// watchdog; watchdog is the interval systemd expects pings at, 0 if disabled
+func startServiceNotifier(bridge *Bridge, notifier *systemd.Notifier, watchdog time.Duration) *serviceNotifier {
+	s := &serviceNotifier{
+		notifier: notifier,
+		bridge:   bridge,
+		watchdog: watchdog,
+		stopCh:   make(chan struct{}),
+	}
+
+	if !notifier.Enabled() {
+		return s
+	}
+
+	// Ping at half the interval, as systemd recommends
+	interval := statusInterval
+	if watchdog > 0 && watchdog/2 < interval {
+		interval = watchdog / 2
+	}
+
+	s.wg.Add(1)
+	go s.run(interval)
+
+	if watchdog > 0 {
+		bridge.Logger().LogSystemf(logger.LevelInfo, "main", "systemd watchdog enabled (every %s)", watchdog)
+		s.checkWatchdog()
+	}
+	return s
+}
+
+// checkWatchdog warns about health checks that are noticed to stall only
+// after the watchdog interval, which a shorter health_check_period fixes
+func (s *serviceNotifier) checkWatchdog() {
+	for _, mgr := range s.bridge.databases() {
+		if threshold := mgr.connMgr.StallThreshold(); threshold > s.watchdog {
+			s.bridge.Logger().LogSystemf(logger.LevelWarn, "main", "A stalled health check of %s is noticed after %s, longer than the watchdog interval %s; lower health_check_period", mgr.name, threshold, s.watchdog)
+		}
+	}
+}
+
+// ready tells systemd that the service is up
+func (s *serviceNotifier) ready() {
+	s.notify(systemd.StateReady, "STATUS="+statusLine(s.bridge.Health(), nil))
+}
+
+// stopping tells systemd that the service is shutting down and stops the
+// watchdog pings
+func (s *serviceNotifier) stopping() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		s.wg.Wait()
+	})
+	s.notify(systemd.StateStopping, "STATUS=Shutting down")
+}
+
+// run refreshes the status and pings the watchdog every interval
+func (s *serviceNotifier) run(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.tick(time.Now())
+		}
+	}
+}
+
+// tick pings the watchdog unless something stalled, and sends the status
+// when it changed
+func (s *serviceNotifier) tick(now time.Time) {
+	stalled := s.bridge.Stalled(now)
+
+	if len(stalled) > 0 && !s.stalled {
+		s.bridge.Logger().LogSystemf(logger.LevelError, "main", "Not making progress, withholding watchdog pings: %s", strings.Join(stalled, ", "))
+	}
+	s.stalled = len(stalled) > 0
+
+	if s.watchdog > 0 && !s.stalled {
+		s.notify(systemd.StateWatchdog)
+	}
+
+	if status := statusLine(s.bridge.Health(), stalled); status != s.status {
+		s.status = status
+		if err := s.notifier.Status("%s", status); err != nil {
+			s.bridge.Logger().LogSystemf(logger.LevelWarn, "main", "%v", err)
+		}
+	}
+}
+
+// notify sends states to systemd, logging failures
+func (s *serviceNotifier) notify(states ...string) {
+	if err := s.notifier.Notify(states...); err != nil {
+		s.bridge.Logger().LogSystemf(logger.LevelWarn, "main", "%v", err)
+	}
+}
+
+// statusLine summarizes the databases for systemctl status
+func statusLine(report health.Report, stalled []string) string {
+	connected, degraded, standby := 0, 0, 0
+	for _, db := range report.Databases {
+		if db.Connected {
+			connected++
+		}
+		if db.Degraded {
+			degraded++
+		}
+		if db.Standby {
+			standby++
+		}
+	}
+
+	status := fmt.Sprintf("%d/%d databases connected", connected, len(report.Databases))
+
+	var notes []string
+	if degraded > 0 {
+		notes = append(notes, fmt.Sprintf("%d degraded", degraded))
+	}
+	if standby > 0 {
+		notes = append(notes, fmt.Sprintf("%d standby", standby))
+	}
+	if len(notes) > 0 {
+		status += " (" + strings.Join(notes, ", ") + ")"
+	}
+
+	if len(stalled) > 0 {
+		status += "; stalled: " + strings.Join(stalled, ", ")
+	}
+	return status
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pgbridge/internal/health"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/systemd"
+)
+
+func listenNotify(t *testing.T) (*systemd.Notifier, *net.UnixConn) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return systemd.NewNotifier(path), conn
+}
+
+func receiveNotify(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestServiceNotifier(t *testing.T) {
+	notifier, conn := listenNotify(t)
+	bridge := NewBridge(nil, logger.NewLogger(serviceName, nil))
+
+	s := startServiceNotifier(bridge, notifier, 40*time.Millisecond)
+	s.ready()
+	if got := receiveNotify(t, conn); got != "READY=1\nSTATUS=0/0 databases connected" {
+		t.Errorf("Unexpected ready message %q", got)
+	}
+
+	// Nothing is stalled, so the watchdog is pinged
+	seen := false
+	for i := 0; i < 5 && !seen; i++ {
+		seen = receiveNotify(t, conn) == "WATCHDOG=1"
+	}
+	if !seen {
+		t.Error("Expected WATCHDOG=1")
+	}
+
+	s.stopping()
+	for {
+		got := receiveNotify(t, conn)
+		if strings.HasPrefix(got, "STOPPING=1") {
+			break
+		}
+		if got != "WATCHDOG=1" && !strings.HasPrefix(got, "STATUS=") {
+			t.Fatalf("Unexpected message %q", got)
+		}
+	}
+}
+
+func TestServiceNotifier_Disabled(t *testing.T) {
+	bridge := NewBridge(nil, logger.NewLogger(serviceName, nil))
+	s := startServiceNotifier(bridge, systemd.NewNotifier(""), time.Second)
+	s.ready()
+	s.stopping()
+}
+
+func TestStatusLine(t *testing.T) {
+	report := health.Report{Databases: []health.DatabaseStatus{
+		{Name: "db1", Connected: true},
+		{Name: "db2", Connected: true, Standby: true},
+		{Name: "db3", Degraded: true},
+	}}
+
+	got := statusLine(report, []string{"db1 listener"})
+	want := "2/3 databases connected (1 degraded, 1 standby); stalled: db1 listener"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
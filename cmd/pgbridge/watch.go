@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/listener"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/modules/control"
+	"pgbridge/internal/worker"
+)
+
+// configWatcher listens on the central database for changes to the
+// configuration tables and reloads the bridge when they happen
+type configWatcher struct {
+	pool       *pgxpool.Pool
+	module     *control.ControlModule
+	workers    *worker.Pool
+	dispatcher *listener.Dispatcher
+}
+
+// WatchCentral installs the configuration triggers on the central database
+// and reloads the configuration whenever sw_pgb or sw_instance change
+func (b *Bridge) WatchCentral(ctx context.Context, connString string) error {
+	pool, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		return fmt.Errorf("failed to connect to central database: %w", err)
+	}
+
+	module := control.NewControlModule(control.DefaultDebounce, func() {
+		b.Reload(ctx)
+	}, b.log())
+
+	w := &configWatcher{pool: pool, module: module}
+
+	if err := module.Initialize(ctx, pool); err != nil {
+		// The triggers may have been installed by the schema owner from
+		// migrations/pansoinco_suite_pgb_config_trigger.sql instead
+		b.log().LogSystemf(logger.LevelWarn, "main", "Could not install configuration triggers, relying on existing ones: %v", err)
+	}
+
+	// One worker: reloads are serialized anyway. Payloads name the changed
+	// table rather than an item, so they are passed on undecoded.
+	handler := func(ctx context.Context, payload string) error {
+		return module.ProcessNotification(ctx, modules.Notification{Raw: payload})
+	}
+	w.workers = worker.NewPool("central/"+module.Name(), worker.Config{Workers: 1}, handler, b.log())
+	w.workers.Start()
+
+	w.dispatcher = listener.NewDispatcher("central", connString, b.log())
+	if err := w.dispatcher.Subscribe(ctx, module, w.workers); err != nil {
+		w.stop()
+		return err
+	}
+	if err := w.dispatcher.Start(ctx); err != nil {
+		w.stop()
+		return fmt.Errorf("failed to listen for configuration changes: %w", err)
+	}
+
+	b.mu.Lock()
+	b.watcher = w
+	b.mu.Unlock()
+
+	b.log().LogSystemf(logger.LevelInfo, "main", "Watching central configuration for changes")
+	return nil
+}
+
+// stop stops listening and cancels a pending reload
+func (w *configWatcher) stop() {
+	if w.dispatcher != nil {
+		w.dispatcher.Stop()
+	}
+	if w.workers != nil {
+		w.workers.Stop()
+	}
+	w.module.Stop()
+	w.pool.Close()
+}
@@ -8,6 +8,17 @@ type DatabaseConfig struct {
 	Name             string
 	ConnectionString string
 	ActiveModules    []string
+	ModuleOptions    map[string]ModuleOptions
+	// Pool tunes the connection pool of the database
+	Pool PoolConfig
+}
+
+// Options returns the options configured for a module (never nil)
+func (dc *DatabaseConfig) Options(module string) ModuleOptions {
+	if opts, ok := dc.ModuleOptions[module]; ok {
+		return opts
+	}
+	return ModuleOptions{}
 }
 
 type Config struct {
@@ -28,6 +39,10 @@ func (dc *DatabaseConfig) Validate() error {
 		return fmt.Errorf("at least one module must be enabled in configuration for database %s", dc.Name)
 	}
 
+	if err := dc.Pool.Validate(); err != nil {
+		return fmt.Errorf("invalid pool settings for database %s: %w", dc.Name, err)
+	}
+
 	return nil
 }
 
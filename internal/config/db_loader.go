@@ -28,12 +28,33 @@ func LoadConfigFromDatabase(centralConnStr string, log *logger.Logger) (*Config,
 	}
 	defer pool.Close()
 
+	// The pool settings column is optional, see
+	// migrations/pansoinco_suite_pgb_pool.sql
+	poolColumn := "NULL::text"
+	var hasPoolColumn bool
+	if err := pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'sw_pgb' AND column_name = 'pgb_pool'
+		)
+	`).Scan(&hasPoolColumn); err != nil {
+		queryErr := fmt.Errorf("failed to query database configurations: %w", err)
+		if log != nil {
+			log.LogConfigError(queryErr)
+		}
+		return nil, queryErr
+	}
+	if hasPoolColumn {
+		poolColumn = "sp.pgb_pool"
+	}
+
 	// Query the configuration view
 	query := `
 		SELECT
 			ps.short_name || ' ' || si.db_name as db_name,
 			si.db_connection_string as conn_string,
-			sp.pgb_services as services
+			sp.pgb_services as services,
+			` + poolColumn + ` as pool_settings
 		FROM sw_pgb sp
 		LEFT JOIN sw_instance si ON si.id = sp.sw_instance_id
 		LEFT JOIN ps_sw ps ON ps.id = si.sw_id
@@ -60,8 +81,9 @@ func LoadConfigFromDatabase(centralConnStr string, log *logger.Logger) (*Config,
 		var dbName string
 		var connString string
 		var services []string
+		var poolSettings *string
 
-		if err := rows.Scan(&dbName, &connString, &services); err != nil {
+		if err := rows.Scan(&dbName, &connString, &services, &poolSettings); err != nil {
 			scanErr := fmt.Errorf("failed to scan configuration row: %w", err)
 			if log != nil {
 				log.LogConfigError(scanErr)
@@ -87,15 +109,41 @@ func LoadConfigFromDatabase(centralConnStr string, log *logger.Logger) (*Config,
 		}
 
 		// Convert services to the format expected by DatabaseConfig
+		// Entries may carry options, e.g. 'pgb_mail(workers=8)'
 		var activeModules []string
+		moduleOptions := map[string]ModuleOptions{}
 		for _, svc := range services {
-			activeModules = append(activeModules, strings.TrimSpace(svc))
+			module, opts, err := parseModuleEntry(svc)
+			if err != nil {
+				if log != nil {
+					log.LogSystemf(logger.LevelWarn, "config", "Skipping service '%s' for database %s: %v", svc, dbName, err)
+				}
+				continue
+			}
+			activeModules = append(activeModules, module)
+			if len(opts) > 0 {
+				moduleOptions[module] = opts
+			}
+		}
+
+		// Invalid pool settings fall back to the defaults
+		var poolConfig PoolConfig
+		if poolSettings != nil {
+			poolConfig, err = parsePoolSettings(*poolSettings)
+			if err != nil {
+				if log != nil {
+					log.LogSystemf(logger.LevelWarn, "config", "Ignoring pool settings '%s' for database %s: %v", *poolSettings, dbName, err)
+				}
+				poolConfig = PoolConfig{}
+			}
 		}
 
 		dbConfig := DatabaseConfig{
 			Name:             strings.TrimSpace(dbName),
 			ConnectionString: strings.TrimSpace(connString),
 			ActiveModules:    activeModules,
+			ModuleOptions:    moduleOptions,
+			Pool:             poolConfig,
 		}
 
 		config.Databases = append(config.Databases, dbConfig)
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"reflect"
+)
+
+// ConfigDiff describes the changes between two configurations
+type ConfigDiff struct {
+	Added   []DatabaseConfig
+	Removed []DatabaseConfig
+	Changed []DatabaseChange
+}
+
+// DatabaseChange describes how a database present in both configurations
+// has changed
+type DatabaseChange struct {
+	Old DatabaseConfig
+	New DatabaseConfig
+
+	// ConnectionChanged is set when the connection string or the pool
+	// settings differ; the database has to be reconnected and all its
+	// modules restarted
+	ConnectionChanged bool
+
+	AddedModules   []string
+	RemovedModules []string
+	// ChangedModules are modules present in both whose options differ
+	ChangedModules []string
+}
+
+// IsEmpty returns true if the configurations are equivalent
+func (d *ConfigDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff compares the running configuration with a new one
+// Databases are matched by name; a nil old configuration means every
+// database in the new one is added
+func Diff(old, new *Config) *ConfigDiff {
+	diff := &ConfigDiff{}
+
+	oldDBs := map[string]DatabaseConfig{}
+	if old != nil {
+		for _, db := range old.Databases {
+			oldDBs[db.Name] = db
+		}
+	}
+
+	newDBs := map[string]bool{}
+	for _, db := range new.Databases {
+		newDBs[db.Name] = true
+
+		oldDB, ok := oldDBs[db.Name]
+		if !ok {
+			diff.Added = append(diff.Added, db)
+			continue
+		}
+
+		if change, changed := diffDatabase(oldDB, db); changed {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+
+	if old != nil {
+		for _, db := range old.Databases {
+			if !newDBs[db.Name] {
+				diff.Removed = append(diff.Removed, db)
+			}
+		}
+	}
+
+	return diff
+}
+
+// diffDatabase compares two configurations of the same database
+func diffDatabase(old, new DatabaseConfig) (DatabaseChange, bool) {
+	change := DatabaseChange{
+		Old:               old,
+		New:               new,
+		ConnectionChanged: old.ConnectionString != new.ConnectionString || old.Pool != new.Pool,
+	}
+
+	oldModules := map[string]bool{}
+	for _, module := range old.ActiveModules {
+		oldModules[module] = true
+	}
+
+	newModules := map[string]bool{}
+	for _, module := range new.ActiveModules {
+		newModules[module] = true
+
+		if !oldModules[module] {
+			change.AddedModules = append(change.AddedModules, module)
+		} else if !reflect.DeepEqual(old.Options(module), new.Options(module)) {
+			change.ChangedModules = append(change.ChangedModules, module)
+		}
+	}
+
+	for _, module := range old.ActiveModules {
+		if !newModules[module] {
+			change.RemovedModules = append(change.RemovedModules, module)
+		}
+	}
+
+	changed := change.ConnectionChanged ||
+		len(change.AddedModules) > 0 ||
+		len(change.RemovedModules) > 0 ||
+		len(change.ChangedModules) > 0
+
+	return change, changed
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestDiff_NilOld(t *testing.T) {
+	newCfg := &Config{Databases: []DatabaseConfig{
+		{Name: "db1", ConnectionString: "postgres://localhost/db1", ActiveModules: []string{"pgb_mail"}},
+	}}
+
+	diff := Diff(nil, newCfg)
+	if len(diff.Added) != 1 || diff.Added[0].Name != "db1" {
+		t.Errorf("Expected db1 to be added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 0 || len(diff.Changed) != 0 {
+		t.Errorf("Expected no removed or changed databases, got %+v", diff)
+	}
+}
+
+func TestDiff_Unchanged(t *testing.T) {
+	cfg := &Config{Databases: []DatabaseConfig{
+		{
+			Name:             "db1",
+			ConnectionString: "postgres://localhost/db1",
+			ActiveModules:    []string{"pgb_mail", "pgb_notify"},
+			ModuleOptions:    map[string]ModuleOptions{"pgb_mail": {"workers": "2"}},
+		},
+	}}
+	same := &Config{Databases: []DatabaseConfig{
+		{
+			Name:             "db1",
+			ConnectionString: "postgres://localhost/db1",
+			ActiveModules:    []string{"pgb_notify", "pgb_mail"},
+			ModuleOptions:    map[string]ModuleOptions{"pgb_mail": {"workers": "2"}},
+		},
+	}}
+
+	if diff := Diff(cfg, same); !diff.IsEmpty() {
+		t.Errorf("Expected empty diff, got %+v", diff)
+	}
+}
+
+func TestDiff_AddedRemovedChanged(t *testing.T) {
+	oldCfg := &Config{Databases: []DatabaseConfig{
+		{Name: "keep", ConnectionString: "postgres://localhost/keep", ActiveModules: []string{"pgb_mail"}},
+		{Name: "gone", ConnectionString: "postgres://localhost/gone", ActiveModules: []string{"pgb_mail"}},
+		{Name: "moved", ConnectionString: "postgres://old-host/moved", ActiveModules: []string{"pgb_mail"}},
+		{
+			Name:             "modules",
+			ConnectionString: "postgres://localhost/modules",
+			ActiveModules:    []string{"pgb_mail", "pgb_notify", "pgb_instance_roles"},
+			ModuleOptions:    map[string]ModuleOptions{"pgb_notify": {"ordered": "false"}},
+		},
+	}}
+	newCfg := &Config{Databases: []DatabaseConfig{
+		{Name: "keep", ConnectionString: "postgres://localhost/keep", ActiveModules: []string{"pgb_mail"}},
+		{Name: "moved", ConnectionString: "postgres://new-host/moved", ActiveModules: []string{"pgb_mail"}},
+		{
+			Name:             "modules",
+			ConnectionString: "postgres://localhost/modules",
+			ActiveModules:    []string{"pgb_notify", "pgb_instance_roles", "pgb_other"},
+			ModuleOptions:    map[string]ModuleOptions{"pgb_notify": {"ordered": "true"}},
+		},
+		{Name: "new", ConnectionString: "postgres://localhost/new", ActiveModules: []string{"pgb_notify"}},
+	}}
+
+	diff := Diff(oldCfg, newCfg)
+
+	if len(diff.Added) != 1 || diff.Added[0].Name != "new" {
+		t.Errorf("Expected 'new' to be added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "gone" {
+		t.Errorf("Expected 'gone' to be removed, got %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 2 {
+		t.Fatalf("Expected 2 changed databases, got %+v", diff.Changed)
+	}
+
+	moved := diff.Changed[0]
+	if moved.New.Name != "moved" || !moved.ConnectionChanged {
+		t.Errorf("Expected 'moved' to have a changed connection string, got %+v", moved)
+	}
+
+	modules := diff.Changed[1]
+	if modules.New.Name != "modules" || modules.ConnectionChanged {
+		t.Errorf("Expected 'modules' to keep its connection, got %+v", modules)
+	}
+	if len(modules.AddedModules) != 1 || modules.AddedModules[0] != "pgb_other" {
+		t.Errorf("Expected pgb_other to be added, got %v", modules.AddedModules)
+	}
+	if len(modules.RemovedModules) != 1 || modules.RemovedModules[0] != "pgb_mail" {
+		t.Errorf("Expected pgb_mail to be removed, got %v", modules.RemovedModules)
+	}
+	if len(modules.ChangedModules) != 1 || modules.ChangedModules[0] != "pgb_notify" {
+		t.Errorf("Expected pgb_notify options to change, got %v", modules.ChangedModules)
+	}
+}
+
+func TestDiff_PoolChanged(t *testing.T) {
+	oldCfg := &Config{Databases: []DatabaseConfig{
+		{Name: "db1", ConnectionString: "postgres://localhost/db1", ActiveModules: []string{"pgb_mail"}},
+	}}
+	newCfg := &Config{Databases: []DatabaseConfig{
+		{
+			Name:             "db1",
+			ConnectionString: "postgres://localhost/db1",
+			ActiveModules:    []string{"pgb_mail"},
+			Pool:             PoolConfig{MaxConns: 20},
+		},
+	}}
+
+	diff := Diff(oldCfg, newCfg)
+	if len(diff.Changed) != 1 || !diff.Changed[0].ConnectionChanged {
+		t.Errorf("Expected new pool settings to reconnect db1, got %+v", diff.Changed)
+	}
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ModuleOptions holds per-module key/value settings
+// Format inside a module list: module_name(key=value; key=value)
+// Example: [pgb_mail(workers=8; queue_size=500), pgb_notify(ordered=true)]
+type ModuleOptions map[string]string
+
+// Int returns the option as an integer, or def if it is not set
+func (o ModuleOptions) Int(key string, def int) (int, error) {
+	value, ok := o[key]
+	if !ok {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("option %s: invalid integer '%s'", key, value)
+	}
+
+	return n, nil
+}
+
+// Bool returns the option as a boolean, or def if it is not set
+func (o ModuleOptions) Bool(key string, def bool) (bool, error) {
+	value, ok := o[key]
+	if !ok {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("option %s: invalid boolean '%s'", key, value)
+	}
+
+	return b, nil
+}
+
+// Duration returns the option as a time.Duration, or def if it is not set
+func (o ModuleOptions) Duration(key string, def time.Duration) (time.Duration, error) {
+	value, ok := o[key]
+	if !ok {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("option %s: invalid duration '%s'", key, value)
+	}
+
+	return d, nil
+}
+
+// parseModuleEntry parses a single module list entry
+// Format: module_name or module_name(key=value; key=value)
+func parseModuleEntry(entry string) (string, ModuleOptions, error) {
+	entry = strings.TrimSpace(entry)
+
+	openPos := strings.Index(entry, "(")
+	if openPos == -1 {
+		if strings.Contains(entry, ")") {
+			return "", nil, fmt.Errorf("invalid module entry '%s': unexpected ')'", entry)
+		}
+		return entry, nil, nil
+	}
+
+	if !strings.HasSuffix(entry, ")") {
+		return "", nil, fmt.Errorf("invalid module entry '%s': missing closing ')'", entry)
+	}
+
+	name := strings.TrimSpace(entry[:openPos])
+	if name == "" {
+		return "", nil, fmt.Errorf("invalid module entry '%s': missing module name", entry)
+	}
+
+	options, err := parseOptionList(entry[openPos+1:len(entry)-1], "module "+name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return name, options, nil
+}
+
+// parseOptionList parses options separated by ';' or ','
+// Format: key=value; key=value
+func parseOptionList(body, owner string) (ModuleOptions, error) {
+	options := ModuleOptions{}
+	for _, part := range strings.FieldsFunc(body, func(r rune) bool { return r == ';' || r == ',' }) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		eqPos := strings.Index(part, "=")
+		if eqPos == -1 {
+			return nil, fmt.Errorf("invalid option '%s' for %s: expected key=value", part, owner)
+		}
+
+		key := strings.TrimSpace(part[:eqPos])
+		value := strings.TrimSpace(part[eqPos+1:])
+		if key == "" {
+			return nil, fmt.Errorf("invalid option '%s' for %s: empty key", part, owner)
+		}
+		options[key] = value
+	}
+
+	return options, nil
+}
+
+// splitModuleList splits a module list on commas that are not inside
+// parentheses, so options may also be separated by commas
+func splitModuleList(moduleStr string) []string {
+	var parts []string
+	depth := 0
+	start := 0
+
+	for i, r := range moduleStr {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, moduleStr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, moduleStr[start:])
+
+	return parts
+}
@@ -103,7 +103,7 @@ func LoadConfig(filepath string, log *logger.Logger) (*Config, error) {
 }
 
 // parseLine parses a single configuration line
-// Format: database_name, connection_string, [module1, module2, ...]
+// Format: database_name, connection_string, [module1, module2, ...][, pool(key=value; ...)]
 func parseLine(line string, moduleListRegex *regexp.Regexp) (*DatabaseConfig, error) {
 	// Find the module list first
 	matches := moduleListRegex.FindStringSubmatch(line)
@@ -135,7 +135,16 @@ func parseLine(line string, moduleListRegex *regexp.Regexp) (*DatabaseConfig, er
 	connStr := strings.TrimSpace(lineBeforeModules[firstCommaPos+1:])
 
 	// Parse modules
-	modules := parseModules(moduleListStr)
+	modules, options, err := parseModules(moduleListStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the pool settings after the module list
+	pool, err := parsePoolEntry(line[strings.Index(line, matches[0])+len(matches[0]):])
+	if err != nil {
+		return nil, err
+	}
 
 	if name == "" {
 		return nil, fmt.Errorf("database name cannot be empty")
@@ -153,21 +162,49 @@ func parseLine(line string, moduleListRegex *regexp.Regexp) (*DatabaseConfig, er
 		Name:             name,
 		ConnectionString: connStr,
 		ActiveModules:    modules,
+		ModuleOptions:    options,
+		Pool:             pool,
 	}, nil
 }
 
-// parseModules parses the module list string
-func parseModules(moduleStr string) []string {
+// parsePoolEntry parses what follows the module list: nothing, or the
+// pool settings
+// Format: , pool(key=value; key=value)
+func parsePoolEntry(rest string) (PoolConfig, error) {
+	rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), ","))
+	if rest == "" {
+		return PoolConfig{}, nil
+	}
+
+	name, opts, err := parseModuleEntry(rest)
+	if err != nil || name != poolEntry {
+		return PoolConfig{}, fmt.Errorf("invalid format: expected pool(key=value; ...) after the module list, got '%s'", rest)
+	}
+	return ParsePoolOptions(opts)
+}
+
+// parseModules parses the module list string into module names and
+// any per-module options
+func parseModules(moduleStr string) ([]string, map[string]ModuleOptions, error) {
 	modules := []string{}
+	options := map[string]ModuleOptions{}
 
-	// Split by comma
-	parts := strings.Split(moduleStr, ",")
+	// Split by comma (commas inside module options are kept)
+	parts := splitModuleList(moduleStr)
 	for _, part := range parts {
-		module := strings.TrimSpace(part)
-		if module != "" {
-			modules = append(modules, module)
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		module, opts, err := parseModuleEntry(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		modules = append(modules, module)
+		if len(opts) > 0 {
+			options[module] = opts
 		}
 	}
 
-	return modules
+	return modules, options, nil
 }
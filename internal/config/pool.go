@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// poolEntry names the pool settings of a database
+// Format after the module list: pool(key=value; key=value)
+// Example: db1, postgres://..., [pgb_mail], pool(max_conns=20; statement_timeout=30s)
+const poolEntry = "pool"
+
+// Connection counts of a pool whose max_conns or min_conns is not set
+const (
+	DefaultMaxConns int32 = 10
+	DefaultMinConns int32 = 2
+)
+
+// PoolConfig tunes the connection pool of a database; zero values keep the
+// defaults, see Conns, and those of the connection manager and the
+// connection string
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	StatementTimeout  time.Duration
+	ApplicationName   string
+
+	// MinConnsSet tells min_conns=0 from no setting
+	MinConnsSet bool
+}
+
+// poolOptions parses each pool option into a PoolConfig
+var poolOptions = map[string]func(p *PoolConfig, opts ModuleOptions, key string) error{
+	"max_conns": func(p *PoolConfig, opts ModuleOptions, key string) error {
+		return poolInt(&p.MaxConns, opts, key)
+	},
+	"min_conns": func(p *PoolConfig, opts ModuleOptions, key string) error {
+		n, err := strconv.ParseInt(opts[key], 10, 32)
+		if err != nil || n < 0 {
+			return fmt.Errorf("pool option %s: invalid count '%s': expected zero or a positive integer", key, opts[key])
+		}
+		p.MinConns, p.MinConnsSet = int32(n), true
+		return nil
+	},
+	"max_conn_lifetime": func(p *PoolConfig, opts ModuleOptions, key string) error {
+		return poolDuration(&p.MaxConnLifetime, opts, key)
+	},
+	"max_conn_idle_time": func(p *PoolConfig, opts ModuleOptions, key string) error {
+		return poolDuration(&p.MaxConnIdleTime, opts, key)
+	},
+	"health_check_period": func(p *PoolConfig, opts ModuleOptions, key string) error {
+		return poolDuration(&p.HealthCheckPeriod, opts, key)
+	},
+	"statement_timeout": func(p *PoolConfig, opts ModuleOptions, key string) error {
+		return poolDuration(&p.StatementTimeout, opts, key)
+	},
+	"application_name": func(p *PoolConfig, opts ModuleOptions, key string) error {
+		p.ApplicationName = opts[key]
+		return nil
+	},
+}
+
+// PoolOptionNames lists the pool options in alphabetical order
+func PoolOptionNames() []string {
+	names := make([]string, 0, len(poolOptions))
+	for name := range poolOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePoolOptions parses the pool settings of a database
+func ParsePoolOptions(opts ModuleOptions) (PoolConfig, error) {
+	var pool PoolConfig
+
+	keys := make([]string, 0, len(opts))
+	for key := range opts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		parse, ok := poolOptions[key]
+		if !ok {
+			return pool, fmt.Errorf("unknown pool option '%s' (known: %s)", key, strings.Join(PoolOptionNames(), ", "))
+		}
+		if err := parse(&pool, opts, key); err != nil {
+			return pool, err
+		}
+	}
+
+	return pool, pool.Validate()
+}
+
+// parsePoolSettings parses the pool settings given as a list of options,
+// e.g. 'max_conns=20; statement_timeout=30s'
+func parsePoolSettings(settings string) (PoolConfig, error) {
+	opts, err := parseOptionList(settings, "the pool")
+	if err != nil {
+		return PoolConfig{}, err
+	}
+	return ParsePoolOptions(opts)
+}
+
+// Conns returns the maximum and minimum connection counts the pool is
+// created with
+func (p PoolConfig) Conns() (maxConns, minConns int32) {
+	maxConns, minConns = DefaultMaxConns, DefaultMinConns
+	if p.MaxConns > 0 {
+		maxConns = p.MaxConns
+	}
+	if p.MinConnsSet {
+		minConns = p.MinConns
+	}
+	return maxConns, minConns
+}
+
+// Validate checks that the pool settings are consistent, defaults included
+func (p PoolConfig) Validate() error {
+	maxConns, minConns := p.Conns()
+	if minConns <= maxConns {
+		return nil
+	}
+	if !p.MinConnsSet {
+		return fmt.Errorf("pool option max_conns (%d) is below the default min_conns (%d); set min_conns as well", maxConns, minConns)
+	}
+	return fmt.Errorf("pool option min_conns (%d) exceeds max_conns (%d)", minConns, maxConns)
+}
+
+// poolInt parses a positive connection count
+func poolInt(target *int32, opts ModuleOptions, key string) error {
+	n, err := strconv.ParseInt(opts[key], 10, 32)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("pool option %s: invalid count '%s': expected a positive integer", key, opts[key])
+	}
+	*target = int32(n)
+	return nil
+}
+
+// poolDuration parses a positive duration
+func poolDuration(target *time.Duration, opts ModuleOptions, key string) error {
+	d, err := opts.Duration(key, 0)
+	if err != nil {
+		return fmt.Errorf("pool %w", err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("pool option %s: invalid duration '%s': expected a positive duration such as 30s", key, opts[key])
+	}
+	*target = d
+	return nil
+}
@@ -3,13 +3,22 @@ package database
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"pgbridge/internal/logger"
+	"pgbridge/internal/metrics"
+	"pgbridge/internal/tracing"
 )
 
+// healthCheckTimeout bounds the ping of a health check
+const healthCheckTimeout = 5 * time.Second
+
 // ConnectionManager manages a PostgreSQL connection pool and handles
 // connection health monitoring and automatic reconnection
 type ConnectionManager struct {
@@ -17,6 +26,8 @@ type ConnectionManager struct {
 	pool         *pgxpool.Pool
 	isConnected  bool
 	isShutdown   bool
+	checking     bool
+	lastCheck    time.Time
 	mu           sync.RWMutex
 	shutdownOnce sync.Once
 	shutdown     chan struct{}
@@ -24,6 +35,12 @@ type ConnectionManager struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	logger       *logger.Logger
+
+	// lastPool is the latest pool handed out, kept across Disconnect so
+	// subscribers learn which pool was replaced
+	lastPool    *pgxpool.Pool
+	subscribers map[int]func(old, new *pgxpool.Pool)
+	nextID      int
 }
 
 // ConnectionConfig holds the configuration for a database connection
@@ -31,8 +48,14 @@ type ConnectionConfig struct {
 	Name             string
 	ConnectionString string
 	MaxConnections   int32
+	// MinConnections is taken as is; zero keeps no idle connections
 	MinConnections   int32
 	HealthCheckPeriod time.Duration
+	// Zero keeps the pgx default or the value of the connection string
+	MaxConnLifetime  time.Duration
+	MaxConnIdleTime  time.Duration
+	StatementTimeout time.Duration
+	ApplicationName  string
 }
 
 // ConnectionStats provides information about the connection pool
@@ -55,9 +78,6 @@ func NewConnectionManager(config ConnectionConfig, log *logger.Logger) *Connecti
 	if config.MaxConnections == 0 {
 		config.MaxConnections = 10
 	}
-	if config.MinConnections == 0 {
-		config.MinConnections = 2
-	}
 	if config.HealthCheckPeriod == 0 {
 		config.HealthCheckPeriod = 30 * time.Second
 	}
@@ -73,7 +93,16 @@ func NewConnectionManager(config ConnectionConfig, log *logger.Logger) *Connecti
 }
 
 // Connect establishes a connection to the database
+// When it replaces an earlier pool, the subscribers of OnPoolReplaced are
+// notified once the lock is released
 func (cm *ConnectionManager) Connect() error {
+	var replaced *pgxpool.Pool
+	defer func() {
+		if replaced != nil {
+			cm.notifyPoolReplaced(replaced)
+		}
+	}()
+
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
@@ -85,6 +114,26 @@ func (cm *ConnectionManager) Connect() error {
 		cm.logger.LogSystemf(logger.LevelInfo, "database", "Connecting to database: %s", cm.config.Name)
 	}
 
+	pool, err := cm.openPool()
+	if err != nil {
+		return err
+	}
+
+	cm.pool = pool
+	cm.isConnected = true
+	replaced = cm.lastPool
+	cm.lastPool = pool
+
+	if cm.logger != nil {
+		cm.logger.LogDBConnect(cm.config.Name)
+	}
+
+	return nil
+}
+
+// openPool creates a connection pool and checks that it can reach the
+// database
+func (cm *ConnectionManager) openPool() (*pgxpool.Pool, error) {
 	// Configure connection pool
 	poolConfig, err := pgxpool.ParseConfig(cm.config.ConnectionString)
 	if err != nil {
@@ -92,12 +141,22 @@ func (cm *ConnectionManager) Connect() error {
 		if cm.logger != nil {
 			cm.logger.LogDBConnectError(cm.config.Name, connErr)
 		}
-		return connErr
+		return nil, connErr
 	}
 
 	poolConfig.MaxConns = cm.config.MaxConnections
 	poolConfig.MinConns = cm.config.MinConnections
 	poolConfig.HealthCheckPeriod = cm.config.HealthCheckPeriod
+	if cm.config.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cm.config.MaxConnLifetime
+	}
+	if cm.config.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cm.config.MaxConnIdleTime
+	}
+	for name, value := range cm.runtimeParams() {
+		poolConfig.ConnConfig.RuntimeParams[name] = value
+	}
+	tracing.TracePool(poolConfig, cm.config.Name)
 
 	// Create connection pool
 	pool, err := pgxpool.NewWithConfig(cm.ctx, poolConfig)
@@ -106,7 +165,7 @@ func (cm *ConnectionManager) Connect() error {
 		if cm.logger != nil {
 			cm.logger.LogDBConnectError(cm.config.Name, connErr)
 		}
-		return connErr
+		return nil, connErr
 	}
 
 	// Test the connection
@@ -119,17 +178,135 @@ func (cm *ConnectionManager) Connect() error {
 		if cm.logger != nil {
 			cm.logger.LogDBConnectError(cm.config.Name, connErr)
 		}
-		return connErr
+		return nil, connErr
+	}
+
+	return pool, nil
+}
+
+// runtimeParams returns the session settings of the configuration
+func (cm *ConnectionManager) runtimeParams() map[string]string {
+	params := make(map[string]string)
+	if cm.config.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(cm.config.StatementTimeout.Milliseconds(), 10)
+	}
+	if cm.config.ApplicationName != "" {
+		params["application_name"] = cm.config.ApplicationName
+	}
+	return params
+}
+
+// SessionConnString returns the connection string with the session
+// settings of the pool, for connections opened next to it such as the
+// LISTEN connection and the leader election session
+func (cm *ConnectionManager) SessionConnString() string {
+	connString := cm.config.ConnectionString
+	params := cm.runtimeParams()
+	if len(params) == 0 {
+		return connString
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Settings that are not connection parameters are sent to the server
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return connString
+		}
+		query := u.Query()
+		for _, name := range names {
+			query.Set(name, params[name])
+		}
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	for _, name := range names {
+		connString += fmt.Sprintf(" %s='%s'", name, quote.Replace(params[name]))
+	}
+	return connString
+}
+
+// replacePool opens a new pool and swaps it in for the current one. The
+// current pool stays open until then, so its users see the outage rather
+// than a closed pool, and is closed once the subscribers of OnPoolReplaced
+// moved to the new one. It reports whether there was a current pool, as
+// opposed to a first connect or one after Disconnect.
+func (cm *ConnectionManager) replacePool() (bool, error) {
+	pool, err := cm.openPool()
+	if err != nil {
+		return false, err
 	}
 
+	cm.mu.Lock()
+	if cm.isShutdown {
+		cm.mu.Unlock()
+		pool.Close()
+		return false, fmt.Errorf("shutdown requested")
+	}
+	current := cm.pool
+	replaced := cm.lastPool
 	cm.pool = pool
 	cm.isConnected = true
+	cm.lastPool = pool
+	cm.mu.Unlock()
 
 	if cm.logger != nil {
 		cm.logger.LogDBConnect(cm.config.Name)
 	}
+	if replaced != nil {
+		cm.notifyPoolReplaced(replaced)
+	}
+	if current != nil {
+		current.Close()
+	}
 
-	return nil
+	return current != nil, nil
+}
+
+// OnPoolReplaced registers fn to be called with the old and the new pool
+// whenever a reconnect replaces the pool, so consumers that keep the pool
+// never use the closed one. It returns a function removing fn.
+func (cm *ConnectionManager) OnPoolReplaced(fn func(old, new *pgxpool.Pool)) func() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.subscribers == nil {
+		cm.subscribers = make(map[int]func(old, new *pgxpool.Pool))
+	}
+	id := cm.nextID
+	cm.nextID++
+	cm.subscribers[id] = fn
+
+	return func() {
+		cm.mu.Lock()
+		defer cm.mu.Unlock()
+		delete(cm.subscribers, id)
+	}
+}
+
+// notifyPoolReplaced calls the subscribers with the current pool
+func (cm *ConnectionManager) notifyPoolReplaced(old *pgxpool.Pool) {
+	cm.mu.RLock()
+	pool := cm.pool
+	subscribers := make([]func(old, new *pgxpool.Pool), 0, len(cm.subscribers))
+	for _, fn := range cm.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	cm.mu.RUnlock()
+
+	if pool == nil {
+		return
+	}
+	for _, fn := range subscribers {
+		fn(old, pool)
+	}
 }
 
 // Disconnect closes the connection pool
@@ -198,13 +375,38 @@ func (cm *ConnectionManager) GetStats() *ConnectionStats {
 
 // StartHealthCheck starts a goroutine that monitors connection health
 func (cm *ConnectionManager) StartHealthCheck() {
+	cm.mu.Lock()
+	cm.checking = true
+	cm.lastCheck = time.Now()
+	cm.mu.Unlock()
+
 	cm.wg.Add(1)
 	go cm.healthCheckLoop()
 }
 
+// Stalled reports whether the health check loop is running but has not
+// completed a check within StallThreshold
+func (cm *ConnectionManager) Stalled(now time.Time) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.checking && now.Sub(cm.lastCheck) > cm.StallThreshold()
+}
+
+// StallThreshold is how long the health check loop may go without
+// completing a check: a period, plus a ping running into its timeout, plus
+// as much again for a busy host
+func (cm *ConnectionManager) StallThreshold() time.Duration {
+	return cm.config.HealthCheckPeriod + 2*healthCheckTimeout
+}
+
 // healthCheckLoop runs periodic health checks
 func (cm *ConnectionManager) healthCheckLoop() {
 	defer cm.wg.Done()
+	defer func() {
+		cm.mu.Lock()
+		cm.checking = false
+		cm.mu.Unlock()
+	}()
 
 	ticker := time.NewTicker(cm.config.HealthCheckPeriod)
 	defer ticker.Stop()
@@ -216,10 +418,14 @@ func (cm *ConnectionManager) healthCheckLoop() {
 		case <-cm.ctx.Done():
 			return
 		case <-ticker.C:
-			ctx, cancel := context.WithTimeout(cm.ctx, 5*time.Second)
+			ctx, cancel := context.WithTimeout(cm.ctx, healthCheckTimeout)
 			err := cm.Ping(ctx)
 			cancel()
 
+			cm.mu.Lock()
+			cm.lastCheck = time.Now()
+			cm.mu.Unlock()
+
 			if err != nil {
 				// Connection lost, attempt reconnection
 				if cm.logger != nil {
@@ -249,6 +455,7 @@ func (cm *ConnectionManager) handleConnectionLoss() {
 }
 
 // Reconnect attempts to reconnect with exponential backoff
+// The current pool is replaced only once a new one works.
 func (cm *ConnectionManager) Reconnect() error {
 	initialDelay := 1 * time.Second
 	maxDelay := 60 * time.Second
@@ -268,13 +475,14 @@ func (cm *ConnectionManager) Reconnect() error {
 				cm.logger.LogDBReconnect(cm.config.Name, attempt, currentDelay)
 			}
 
-			// First close the existing connection
-			cm.Disconnect()
-
 			// Attempt to reconnect
-			err := cm.Connect()
+			replaced, err := cm.replacePool()
 			if err == nil {
-				// Successfully reconnected
+				// Successfully reconnected; a database that starts out
+				// unreachable connects for the first time
+				if replaced {
+					metrics.DatabaseReconnects.WithLabelValues(cm.config.Name).Inc()
+				}
 				if cm.logger != nil {
 					cm.logger.LogSystemf(logger.LevelInfo, "database", "Successfully reconnected to %s after %d attempts", cm.config.Name, attempt)
 				}
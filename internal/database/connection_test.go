@@ -2,9 +2,20 @@ package database
 
 import (
 	"context"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"pgbridge/internal/metrics"
 )
 
 // getTestConnectionString returns a connection string for testing
@@ -346,3 +357,316 @@ func TestConnectionManager_ConcurrentAccess(t *testing.T) {
 		t.Errorf("Concurrent query failed: %v", err)
 	}
 }
+
+func TestConnectionManager_PoolSettings(t *testing.T) {
+	connStr, ok := getTestConnectionString()
+	if !ok {
+		t.Skip("Skipping integration test: no database connection string provided")
+	}
+
+	config := ConnectionConfig{
+		Name:             "test_db",
+		ConnectionString: connStr,
+		MaxConnections:   3,
+		MaxConnLifetime:  time.Hour,
+		StatementTimeout: 2500 * time.Millisecond,
+		ApplicationName:  "pgbridge-test",
+	}
+
+	cm := NewConnectionManager(config, nil)
+	defer cm.Shutdown()
+
+	if err := cm.Connect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	pool := cm.GetPool()
+	if pool.Config().MaxConns != 3 || pool.Config().MaxConnLifetime != time.Hour {
+		t.Errorf("Expected the pool settings to be applied, got %d connections for %s", pool.Config().MaxConns, pool.Config().MaxConnLifetime)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var timeout, name string
+	if err := pool.QueryRow(ctx, "SELECT current_setting('statement_timeout'), current_setting('application_name')").Scan(&timeout, &name); err != nil {
+		t.Fatalf("Failed to read session settings: %v", err)
+	}
+	if timeout != "2500ms" || name != "pgbridge-test" {
+		t.Errorf("Expected statement_timeout 2500ms and application_name pgbridge-test, got %s and %s", timeout, name)
+	}
+}
+
+// outageProxy forwards connections to the database and drops them all
+// while it is cut, simulating a network outage
+type outageProxy struct {
+	listener net.Listener
+	target   string
+
+	mu    sync.Mutex
+	down  bool
+	conns []net.Conn
+}
+
+func newOutageProxy(t *testing.T, target string) *outageProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	p := &outageProxy{listener: listener, target: target}
+	go p.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		p.cut()
+	})
+	return p
+}
+
+func (p *outageProxy) serve() {
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		down := p.down
+		p.mu.Unlock()
+		if down {
+			client.Close()
+			continue
+		}
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			client.Close()
+			continue
+		}
+		p.mu.Lock()
+		p.conns = append(p.conns, client, server)
+		p.mu.Unlock()
+		go func() {
+			io.Copy(server, client)
+			server.Close()
+		}()
+		go func() {
+			io.Copy(client, server)
+			client.Close()
+		}()
+	}
+}
+
+// cut drops all forwarded connections and refuses new ones
+func (p *outageProxy) cut() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = true
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// restore forwards new connections again
+func (p *outageProxy) restore() {
+	p.mu.Lock()
+	p.down = false
+	p.mu.Unlock()
+}
+
+func TestConnectionManager_PoolReplaced(t *testing.T) {
+	connStr, ok := getTestConnectionString()
+	if !ok {
+		t.Skip("Skipping integration test: no database connection string provided")
+	}
+
+	// Route the connections through a proxy that can cut them
+	u, err := url.Parse(connStr)
+	if err != nil || u.Host == "" {
+		t.Skip("Skipping integration test: connection string is not a URL")
+	}
+	target := u.Host
+	if u.Port() == "" {
+		target = net.JoinHostPort(u.Hostname(), "5432")
+	}
+	proxy := newOutageProxy(t, target)
+	u.Host = proxy.listener.Addr().String()
+
+	config := ConnectionConfig{
+		Name:              "test_db",
+		ConnectionString:  u.String(),
+		MaxConnections:    2,
+		MinConnections:    1,
+		HealthCheckPeriod: 50 * time.Millisecond,
+	}
+
+	cm := NewConnectionManager(config, nil)
+	defer cm.Shutdown()
+
+	if err := cm.Connect(); err != nil {
+		t.Skipf("Skipping integration test: database not reachable: %v", err)
+	}
+
+	// A consumer keeping the pool, like the modules do
+	var current atomic.Pointer[pgxpool.Pool]
+	current.Store(cm.GetPool())
+
+	var calls atomic.Int32
+	var replaced atomic.Pointer[pgxpool.Pool]
+	unsubscribe := cm.OnPoolReplaced(func(old, pool *pgxpool.Pool) {
+		replaced.Store(old)
+		current.Store(pool)
+		calls.Add(1)
+	})
+
+	oldPool := cm.GetPool()
+	cm.StartHealthCheck()
+	proxy.cut()
+
+	// During the outage the old pool stays in place and open
+	time.Sleep(500 * time.Millisecond)
+	if cm.IsConnected() {
+		t.Error("Expected the health check to notice the outage")
+	}
+	if cm.GetPool() != oldPool || calls.Load() != 0 {
+		t.Fatal("Expected the old pool to stay in place until the database is back")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := oldPool.Ping(ctx); err == nil || strings.Contains(err.Error(), "closed pool") {
+		t.Errorf("Expected a connection error from the old pool, got: %v", err)
+	}
+
+	proxy.restore()
+	deadline := time.Now().Add(10 * time.Second)
+	for calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if calls.Load() != 1 || replaced.Load() != oldPool {
+		t.Fatalf("Expected one notification about the old pool, got %d", calls.Load())
+	}
+	if current.Load() != cm.GetPool() || !cm.IsConnected() {
+		t.Fatal("Expected the consumer to hold the new pool")
+	}
+
+	// The old pool is closed, the handed out one works
+	if err := oldPool.Ping(ctx); err == nil {
+		t.Error("Expected the old pool to be closed")
+	}
+	var one int
+	if err := current.Load().QueryRow(ctx, "SELECT 1").Scan(&one); err != nil {
+		t.Errorf("Expected queries on the new pool to succeed: %v", err)
+	}
+
+	// Removed subscribers are not called anymore
+	unsubscribe()
+	if err := cm.Reconnect(); err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected no notification after unsubscribing, got %d", calls.Load())
+	}
+}
+
+func TestConnectionManager_StallThreshold(t *testing.T) {
+	cm := NewConnectionManager(ConnectionConfig{
+		Name:              "test_db",
+		ConnectionString:  "postgres://u:p@127.0.0.1:1/db",
+		HealthCheckPeriod: time.Second,
+	}, nil)
+	defer cm.Shutdown()
+
+	now := time.Now()
+	cm.mu.Lock()
+	cm.checking = true
+	cm.lastCheck = now
+	cm.mu.Unlock()
+
+	// A short period with a ping running into its timeout is not a stall
+	if cm.Stalled(now.Add(time.Second + healthCheckTimeout)) {
+		t.Error("Expected a slow ping not to count as stalled")
+	}
+	if !cm.Stalled(now.Add(cm.StallThreshold() + time.Millisecond)) {
+		t.Error("Expected a stall past the threshold")
+	}
+}
+
+func TestConnectionManager_SessionConnString(t *testing.T) {
+	tests := map[string]string{
+		"url":           "postgres://u:p@localhost:5432/db?sslmode=disable",
+		"keyword/value": "host=localhost port=5432 dbname=db user=u sslmode=disable",
+	}
+
+	for name, connStr := range tests {
+		t.Run(name, func(t *testing.T) {
+			cm := NewConnectionManager(ConnectionConfig{
+				Name:             "test_db",
+				ConnectionString: connStr,
+				StatementTimeout: 2500 * time.Millisecond,
+				ApplicationName:  "pgbridge 'test'",
+			}, nil)
+			defer cm.Shutdown()
+
+			config, err := pgx.ParseConfig(cm.SessionConnString())
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", cm.SessionConnString(), err)
+			}
+			if got := config.RuntimeParams["statement_timeout"]; got != "2500" {
+				t.Errorf("Expected statement_timeout 2500, got %q", got)
+			}
+			if got := config.RuntimeParams["application_name"]; got != "pgbridge 'test'" {
+				t.Errorf("Expected application_name to be set, got %q", got)
+			}
+			if config.Database != "db" {
+				t.Errorf("Expected the connection settings to be kept, got database %q", config.Database)
+			}
+		})
+	}
+
+	// Without session settings the connection string is unchanged
+	cm := NewConnectionManager(ConnectionConfig{Name: "test_db", ConnectionString: tests["url"]}, nil)
+	defer cm.Shutdown()
+	if got := cm.SessionConnString(); got != tests["url"] {
+		t.Errorf("Expected the connection string unchanged, got %q", got)
+	}
+}
+
+func TestConnectionManager_ReconnectMetric(t *testing.T) {
+	connStr, ok := getTestConnectionString()
+	if !ok {
+		t.Skip("Skipping integration test: no database connection string provided")
+	}
+
+	cm := NewConnectionManager(ConnectionConfig{
+		Name:             "test_db_reconnect_metric",
+		ConnectionString: connStr,
+		MaxConnections:   2,
+	}, nil)
+	defer cm.Shutdown()
+
+	// Reconnect retries until the database is reachable
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, connStr)
+	if err != nil {
+		t.Skipf("Skipping integration test: database not reachable: %v", err)
+	}
+	conn.Close(ctx)
+
+	reconnects := metrics.DatabaseReconnects.WithLabelValues("test_db_reconnect_metric")
+
+	// A database that started out unreachable connects for the first time
+	if err := cm.Reconnect(); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	if got := testutil.ToFloat64(reconnects); got != 0 {
+		t.Errorf("Expected a first connect not to count as reconnect, got %v", got)
+	}
+
+	// Replacing the working pool does
+	if err := cm.Reconnect(); err != nil {
+		t.Fatalf("Failed to reconnect: %v", err)
+	}
+	if got := testutil.ToFloat64(reconnects); got != 1 {
+		t.Errorf("Expected one reconnect, got %v", got)
+	}
+}
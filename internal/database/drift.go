@@ -0,0 +1,354 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Drift kinds
+const (
+	DriftMissing    = "missing"
+	DriftExtra      = "extra"
+	DriftMismatched = "mismatched"
+)
+
+// Trigger type bits of pg_trigger.tgtype
+const (
+	triggerRow      = 1 << 0
+	triggerBefore   = 1 << 1
+	triggerInsert   = 1 << 2
+	triggerDelete   = 1 << 3
+	triggerUpdate   = 1 << 4
+	triggerTruncate = 1 << 5
+	triggerInstead  = 1 << 6
+)
+
+// triggerEvents are the trigger events in the order they are described
+var triggerEvents = []struct {
+	bit  int16
+	name string
+}{
+	{triggerInsert, "INSERT"},
+	{triggerUpdate, "UPDATE"},
+	{triggerDelete, "DELETE"},
+	{triggerTruncate, "TRUNCATE"},
+}
+
+// ExpectedSchema is what one component, the core schema or a module,
+// expects in the catalog
+type ExpectedSchema struct {
+	Component string
+	Objects   []SchemaObject
+}
+
+// Drift is a difference between the expected schema and the catalog
+type Drift struct {
+	Kind string
+
+	// Component expects the object; empty for extra objects nobody
+	// expects
+	Component string
+	Object    SchemaObject
+	Detail    string
+}
+
+// String describes the drift
+func (d Drift) String() string {
+	description := d.Kind + " " + d.Object.String()
+	if d.Detail != "" {
+		description += ": " + d.Detail
+	}
+	return description
+}
+
+// Repairable reports whether a repair fixes the drift: missing and
+// mismatched objects are created again by their component, and extra
+// triggers are dropped. Extra tables, indexes and functions may hold data
+// or serve someone else, so they are only reported.
+func (d Drift) Repairable() bool {
+	if d.Kind == DriftExtra {
+		return d.Object.Kind == ObjectTrigger
+	}
+	return true
+}
+
+// triggerDef is a trigger as found in the catalog
+type triggerDef struct {
+	name     string
+	table    string
+	timing   string
+	events   string
+	row      bool
+	function string
+}
+
+// String describes the trigger like its CREATE TRIGGER statement
+func (t triggerDef) String() string {
+	level := "STATEMENT"
+	if t.row {
+		level = "ROW"
+	}
+	return fmt.Sprintf("%s %s FOR EACH %s EXECUTE %s()", t.timing, t.events, level, t.function)
+}
+
+// expectedTrigger returns the definition an object expects
+func expectedTrigger(o SchemaObject) triggerDef {
+	return triggerDef{
+		timing:   strings.ToUpper(o.Timing),
+		events:   normalizeEvents(o.Events),
+		row:      true,
+		function: o.Function,
+	}
+}
+
+// normalizeEvents orders the events of a trigger as the catalog is
+// described, so INSERT OR DELETE equals DELETE OR INSERT
+func normalizeEvents(events string) string {
+	var bits int16
+	for _, event := range strings.Split(strings.ToUpper(events), " OR ") {
+		for _, e := range triggerEvents {
+			if strings.TrimSpace(event) == e.name {
+				bits |= e.bit
+			}
+		}
+	}
+	return describeEvents(bits)
+}
+
+// describeEvents lists the events of a tgtype
+func describeEvents(tgtype int16) string {
+	var events []string
+	for _, e := range triggerEvents {
+		if tgtype&e.bit != 0 {
+			events = append(events, e.name)
+		}
+	}
+	return strings.Join(events, " OR ")
+}
+
+// DetectDrift compares the objects the components expect with the
+// catalog of schema: expected objects that are missing or, for triggers,
+// defined differently, and tables, trigger functions, triggers and
+// indexes nobody expects. Triggers and indexes are only inspected on
+// expected tables; indexes backing constraints are ignored.
+func DetectDrift(ctx context.Context, pool *pgxpool.Pool, schema string, expected []ExpectedSchema) ([]Drift, error) {
+	var drift []Drift
+
+	tables := make(map[string]string)
+	indexes := make(map[string]bool)
+	functions := make(map[string]bool)
+	triggers := make(map[string]SchemaObject)
+
+	for _, component := range expected {
+		missingTables := make(map[string]bool)
+		for _, object := range component.Objects {
+			if object.Schema != schema {
+				continue
+			}
+			name := strings.ToLower(object.Name)
+			table := strings.ToLower(object.Table)
+
+			switch object.Kind {
+			case ObjectTable:
+				tables[name] = component.Component
+			case ObjectIndex:
+				indexes[table+"."+name] = true
+			case ObjectFunction:
+				functions[name] = true
+			case ObjectTrigger:
+				triggers[table+"."+name] = object
+			}
+
+			if object.Kind == ObjectColumn && missingTables[table] {
+				continue
+			}
+			exists, err := ObjectExists(ctx, pool, object)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check %s: %w", object, err)
+			}
+			if !exists {
+				if object.Kind == ObjectTable {
+					missingTables[name] = true
+				}
+				drift = append(drift, Drift{Kind: DriftMissing, Component: component.Component, Object: object})
+			}
+		}
+	}
+
+	found, err := catalogTriggers(ctx, pool, schema)
+	if err != nil {
+		return nil, err
+	}
+	for _, trigger := range found {
+		if _, ok := tables[trigger.table]; !ok {
+			continue
+		}
+		object := SchemaObject{Kind: ObjectTrigger, Schema: schema, Table: trigger.table, Name: trigger.name}
+
+		want, ok := triggers[trigger.table+"."+trigger.name]
+		if !ok {
+			drift = append(drift, Drift{
+				Kind:      DriftExtra,
+				Component: tables[trigger.table],
+				Object:    object,
+				Detail:    describeExtraTrigger(trigger, triggers),
+			})
+			continue
+		}
+		if want.Timing == "" {
+			continue
+		}
+		if expected := expectedTrigger(want); trigger.String() != expected.String() {
+			drift = append(drift, Drift{
+				Kind:      DriftMismatched,
+				Component: tables[trigger.table],
+				Object:    want,
+				Detail:    fmt.Sprintf("is %s, expected %s", trigger, expected),
+			})
+		}
+	}
+
+	extra, err := catalogExtras(ctx, pool, schema, tables, indexes, functions)
+	if err != nil {
+		return nil, err
+	}
+	drift = append(drift, extra...)
+
+	return drift, nil
+}
+
+// describeExtraTrigger explains an extra trigger, pointing out when it
+// calls the function of an expected trigger on the same table for the
+// same events
+func describeExtraTrigger(trigger triggerDef, expected map[string]SchemaObject) string {
+	detail := trigger.String()
+
+	var duplicates []string
+	for _, want := range expected {
+		if strings.ToLower(want.Table) == trigger.table && want.Function == trigger.function &&
+			normalizeEvents(want.Events) == trigger.events {
+			duplicates = append(duplicates, want.Name)
+		}
+	}
+	if len(duplicates) > 0 {
+		sort.Strings(duplicates)
+		detail += fmt.Sprintf("; duplicates %s, so %s() runs twice per row", strings.Join(duplicates, ", "), trigger.function)
+	}
+	return detail
+}
+
+// catalogTriggers returns the triggers on the tables of schema
+func catalogTriggers(ctx context.Context, pool *pgxpool.Pool, schema string) ([]triggerDef, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT t.tgname, c.relname, t.tgtype, fn.nspname || '.' || p.proname
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_proc p ON p.oid = t.tgfoid
+		JOIN pg_namespace fn ON fn.oid = p.pronamespace
+		WHERE n.nspname = $1 AND NOT t.tgisinternal
+		ORDER BY c.relname, t.tgname
+	`, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list triggers: %w", err)
+	}
+	defer rows.Close()
+
+	var triggers []triggerDef
+	for rows.Next() {
+		var t triggerDef
+		var tgtype int16
+		if err := rows.Scan(&t.name, &t.table, &tgtype, &t.function); err != nil {
+			return nil, fmt.Errorf("failed to list triggers: %w", err)
+		}
+
+		switch {
+		case tgtype&triggerInstead != 0:
+			t.timing = "INSTEAD OF"
+		case tgtype&triggerBefore != 0:
+			t.timing = "BEFORE"
+		default:
+			t.timing = "AFTER"
+		}
+		t.events = describeEvents(tgtype)
+		t.row = tgtype&triggerRow != 0
+		triggers = append(triggers, t)
+	}
+	return triggers, rows.Err()
+}
+
+// catalogExtras returns the tables and trigger functions of schema, and
+// the indexes on expected tables, that are not expected
+func catalogExtras(ctx context.Context, pool *pgxpool.Pool, schema string, tables map[string]string, indexes, functions map[string]bool) ([]Drift, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT 'table', '', c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relkind IN ('r', 'p') AND NOT c.relispartition
+		UNION ALL
+		SELECT 'index', t.relname, i.relname
+		FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = $1
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conindid = x.indexrelid)
+		UNION ALL
+		SELECT 'function', '', p.proname
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = $1 AND p.prorettype = 'trigger'::regtype
+		ORDER BY 1, 2, 3
+	`, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema objects: %w", err)
+	}
+	defer rows.Close()
+
+	var drift []Drift
+	for rows.Next() {
+		var kind, table, name string
+		if err := rows.Scan(&kind, &table, &name); err != nil {
+			return nil, fmt.Errorf("failed to list schema objects: %w", err)
+		}
+
+		object := SchemaObject{Kind: kind, Schema: schema, Table: table, Name: name}
+		switch kind {
+		case ObjectTable:
+			if _, ok := tables[name]; ok {
+				continue
+			}
+		case ObjectIndex:
+			component, ok := tables[table]
+			if !ok || indexes[table+"."+name] {
+				continue
+			}
+			drift = append(drift, Drift{Kind: DriftExtra, Component: component, Object: object})
+			continue
+		case ObjectFunction:
+			if functions[name] {
+				continue
+			}
+		}
+		drift = append(drift, Drift{Kind: DriftExtra, Object: object})
+	}
+	return drift, rows.Err()
+}
+
+// DropTrigger drops an extra trigger; its name is used as found in the
+// catalog, so differently cased duplicates are dropped alone
+func DropTrigger(ctx context.Context, pool *pgxpool.Pool, o SchemaObject) error {
+	sql := fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s",
+		pgx.Identifier{o.Name}.Sanitize(),
+		pgx.Identifier{o.Schema, o.Table}.Sanitize())
+
+	if _, err := pool.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to drop %s: %w", o, err)
+	}
+	return nil
+}
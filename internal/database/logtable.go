@@ -0,0 +1,465 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/logger"
+)
+
+const (
+	// logPartitionsAhead is how many daily partitions of pgb_log are kept
+	// ready beyond today
+	logPartitionsAhead = 7
+
+	// logDeleteBatch bounds the rows deleted at once from a plain pgb_log
+	logDeleteBatch = 10000
+
+	// DefaultLogMaintenanceInterval is how often partitions are created
+	// and the retention is applied
+	DefaultLogMaintenanceInterval = time.Hour
+
+	// partitionBoundFormat is how PostgreSQL prints timestamp bounds
+	partitionBoundFormat = "2006-01-02 15:04:05"
+)
+
+// pg_class.relkind of pgb_log
+const (
+	relkindPlain       = "r"
+	relkindPartitioned = "p"
+)
+
+const (
+	// pgb_log partitioned by day; the primary key must include the
+	// partition key. The sequence is shared with a converted plain table.
+	createPartitionedLogTableSQL = `
+		CREATE SEQUENCE IF NOT EXISTS pgb.pgb_log_id_seq AS INTEGER;
+
+		CREATE TABLE IF NOT EXISTS pgb.pgb_log (
+			id INTEGER NOT NULL DEFAULT nextval('pgb.pgb_log_id_seq'),
+			timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			service_name VARCHAR(50) DEFAULT 'pgbridge',
+			event_type VARCHAR(50) NOT NULL,
+			database_name VARCHAR(100),
+			module_name VARCHAR(50),
+			message TEXT,
+			details JSONB,
+			PRIMARY KEY (id, timestamp)
+		) PARTITION BY RANGE (timestamp);
+
+		ALTER SEQUENCE pgb.pgb_log_id_seq OWNED BY pgb.pgb_log.id;`
+
+	// Renames a plain pgb_log and its indexes out of the way; rows without
+	// a timestamp cannot be placed in a partition
+	renamePlainLogTableSQL = `
+		LOCK TABLE pgb.pgb_log IN ACCESS EXCLUSIVE MODE;
+
+		ALTER TABLE pgb.pgb_log RENAME TO pgb_log_legacy;
+		ALTER INDEX IF EXISTS pgb.pgb_log_pkey RENAME TO pgb_log_legacy_pkey;
+		ALTER INDEX IF EXISTS pgb.idx_pgb_log_timestamp RENAME TO pgb_log_legacy_timestamp_idx;
+		ALTER INDEX IF EXISTS pgb.idx_pgb_log_event_type RENAME TO pgb_log_legacy_event_type_idx;
+
+		UPDATE pgb.pgb_log_legacy SET timestamp = '-infinity' WHERE timestamp IS NULL;
+		ALTER TABLE pgb.pgb_log_legacy ALTER COLUMN timestamp SET NOT NULL;`
+
+	// Attaches the renamed plain table as the partition of everything
+	// before the first daily partition
+	attachLegacyLogTableSQL = `
+		ALTER TABLE pgb.pgb_log ATTACH PARTITION pgb.pgb_log_legacy
+		FOR VALUES FROM (MINVALUE) TO ('%s');`
+
+	createLogPartitionSQL = `
+		CREATE TABLE IF NOT EXISTS pgb.%s PARTITION OF pgb.pgb_log
+		FOR VALUES FROM ('%s') TO ('%s');`
+
+	deleteOldLogRowsSQL = `
+		DELETE FROM pgb.pgb_log
+		WHERE ctid IN (
+			SELECT ctid FROM pgb.pgb_log
+			WHERE timestamp < $1
+			LIMIT $2
+		);`
+)
+
+// partitionUpperBound extracts the upper bound of a range partition
+var partitionUpperBound = regexp.MustCompile(`TO \('([^']+)'\)`)
+
+// LogConfig configures the pgb_log table of a database
+type LogConfig struct {
+	// Partitioned creates pgb_log partitioned by day, converting an
+	// existing plain table
+	Partitioned bool
+
+	// Retention is how long log rows are kept; zero keeps them forever
+	Retention time.Duration
+
+	// ArchiveSchema receives partitions past the retention instead of
+	// dropping them
+	ArchiveSchema string
+}
+
+// LogPartition is a partition of pgb_log and its range. From is only set
+// for partitions still to be created.
+type LogPartition struct {
+	Name  string
+	From  time.Time
+	Until time.Time
+}
+
+// LogMaintenance is what a maintenance pass changed
+type LogMaintenance struct {
+	Created  []string
+	Dropped  []string
+	Archived []string
+	Deleted  int64
+}
+
+// logTableKind returns the relkind of pgb_log, empty if it does not exist
+func logTableKind(ctx context.Context, pool *pgxpool.Pool) (string, error) {
+	var kind string
+	err := pool.QueryRow(ctx, `SELECT relkind::text FROM pg_class WHERE oid = to_regclass('pgb.pgb_log')`).Scan(&kind)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect pgb_log: %w", err)
+	}
+	return kind, nil
+}
+
+// createPartitionedLogTable creates pgb_log partitioned by day, or
+// converts a plain pgb_log in one transaction: the plain table becomes the
+// partition of all rows before tomorrow, so nothing is copied
+func createPartitionedLogTable(ctx context.Context, pool *pgxpool.Pool, convert bool) error {
+	now, err := localTimestamp(ctx, pool)
+	if err != nil {
+		return err
+	}
+	tomorrow := startOfDay(now).AddDate(0, 0, 1)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	statements := []string{createPartitionedLogTableSQL, createLogTimestampIndexSQL, createLogEventTypeIndexSQL}
+	if convert {
+		statements = append([]string{renamePlainLogTableSQL}, statements...)
+		statements = append(statements, fmt.Sprintf(attachLegacyLogTableSQL, tomorrow.Format(partitionBoundFormat)))
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to partition pgb_log: %w", err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// LogPartitions returns the partitions of pgb_log, oldest first; nil if
+// pgb_log is not partitioned
+func LogPartitions(ctx context.Context, pool *pgxpool.Pool) ([]LogPartition, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT c.relname, pg_get_expr(c.relpartbound, c.oid)
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass('pgb.pgb_log')
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pgb_log partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []LogPartition
+	for rows.Next() {
+		var name, bound string
+		if err := rows.Scan(&name, &bound); err != nil {
+			return nil, fmt.Errorf("failed to list pgb_log partitions: %w", err)
+		}
+
+		match := partitionUpperBound.FindStringSubmatch(bound)
+		if match == nil {
+			return nil, fmt.Errorf("unexpected bound of partition %s: %s", name, bound)
+		}
+		until, err := time.Parse(partitionBoundFormat, match[1])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected bound of partition %s: %s", name, bound)
+		}
+		partitions = append(partitions, LogPartition{Name: name, Until: until})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list pgb_log partitions: %w", err)
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].Until.Before(partitions[j].Until)
+	})
+	return partitions, nil
+}
+
+// missingPartitions returns the daily partitions to create so that every
+// day up to logPartitionsAhead days after now has one. They start where
+// the newest partition ends, so ranges never overlap.
+func missingPartitions(partitions []LogPartition, now time.Time) []LogPartition {
+	from := startOfDay(now)
+	if n := len(partitions); n > 0 && partitions[n-1].Until.After(from) {
+		from = partitions[n-1].Until
+	}
+	until := startOfDay(now).AddDate(0, 0, logPartitionsAhead+1)
+
+	var missing []LogPartition
+	for day := from; day.Before(until); {
+		next := startOfDay(day).AddDate(0, 0, 1)
+		missing = append(missing, LogPartition{Name: partitionName(day), From: day, Until: next})
+		day = next
+	}
+	return missing
+}
+
+// partitionName names the daily partition of a day
+func partitionName(day time.Time) string {
+	return "pgb_log_p" + day.Format("20060102")
+}
+
+// expiredPartitions returns the partitions whose rows are all older than
+// cutoff
+func expiredPartitions(partitions []LogPartition, cutoff time.Time) []LogPartition {
+	var expired []LogPartition
+	for _, p := range partitions {
+		if !p.Until.After(cutoff) {
+			expired = append(expired, p)
+		}
+	}
+	return expired
+}
+
+// ensureLogPartitions creates the daily partitions of the coming days
+func ensureLogPartitions(ctx context.Context, pool *pgxpool.Pool, now time.Time) ([]string, error) {
+	partitions, err := LogPartitions(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	for _, p := range missingPartitions(partitions, now) {
+		sql := fmt.Sprintf(createLogPartitionSQL, pgx.Identifier{p.Name}.Sanitize(),
+			p.From.Format(partitionBoundFormat), p.Until.Format(partitionBoundFormat))
+		if _, err := pool.Exec(ctx, sql); err != nil {
+			return created, fmt.Errorf("failed to create partition %s: %w", p.Name, err)
+		}
+		created = append(created, p.Name)
+	}
+	return created, nil
+}
+
+// localTimestamp returns the current time of the database session, the
+// clock the TIMESTAMP column is filled with
+func localTimestamp(ctx context.Context, pool *pgxpool.Pool) (time.Time, error) {
+	var now time.Time
+	if err := pool.QueryRow(ctx, `SELECT LOCALTIMESTAMP`).Scan(&now); err != nil {
+		return now, fmt.Errorf("failed to read the database clock: %w", err)
+	}
+	return now, nil
+}
+
+// startOfDay truncates a timestamp to midnight
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// LogMaintainer keeps pgb_log within its retention: it creates the
+// partitions of the coming days and drops or archives expired ones, or
+// deletes expired rows from a plain table
+type LogMaintainer struct {
+	pool         atomic.Pointer[pgxpool.Pool]
+	databaseName string
+	config       LogConfig
+	interval     time.Duration
+	logger       *logger.Logger
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	stopOnce     sync.Once
+}
+
+// NewLogMaintainer creates a maintainer that runs every interval
+func NewLogMaintainer(pool *pgxpool.Pool, databaseName string, cfg LogConfig, interval time.Duration, log *logger.Logger) *LogMaintainer {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l := &LogMaintainer{
+		databaseName: databaseName,
+		config:       cfg,
+		interval:     interval,
+		logger:       log,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	l.pool.Store(pool)
+	return l
+}
+
+// SetPool replaces the pool after the connection manager reconnected
+func (l *LogMaintainer) SetPool(pool *pgxpool.Pool) {
+	l.pool.Store(pool)
+}
+
+// Start runs a pass right away and then periodically
+func (l *LogMaintainer) Start() {
+	l.wg.Add(1)
+	go l.run()
+}
+
+// run maintains pgb_log until stopped
+func (l *LogMaintainer) run() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := l.Maintain(l.ctx)
+		if l.ctx.Err() != nil {
+			return
+		}
+		l.report(result, err)
+
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// report logs what a pass changed
+func (l *LogMaintainer) report(result LogMaintenance, err error) {
+	if l.logger == nil {
+		return
+	}
+	if err != nil {
+		l.logger.LogSystemf(logger.LevelWarn, "schema", "pgb_log maintenance on %s failed: %v", l.databaseName, err)
+	}
+	if len(result.Created) > 0 {
+		l.logger.LogSystemf(logger.LevelInfo, "schema", "Created pgb_log partitions on %s: %v", l.databaseName, result.Created)
+	}
+	if len(result.Dropped) > 0 {
+		l.logger.LogSystemf(logger.LevelInfo, "schema", "Dropped expired pgb_log partitions on %s: %v", l.databaseName, result.Dropped)
+	}
+	if len(result.Archived) > 0 {
+		l.logger.LogSystemf(logger.LevelInfo, "schema", "Archived expired pgb_log partitions on %s to %s: %v", l.databaseName, l.config.ArchiveSchema, result.Archived)
+	}
+	if result.Deleted > 0 {
+		l.logger.LogSystemf(logger.LevelInfo, "schema", "Deleted %d expired pgb_log rows on %s", result.Deleted, l.databaseName)
+	}
+}
+
+// Maintain runs a single pass. A partitioned pgb_log always gets the
+// partitions of the coming days, whatever the configuration, since rows
+// without a partition cannot be inserted.
+func (l *LogMaintainer) Maintain(ctx context.Context) (LogMaintenance, error) {
+	var result LogMaintenance
+	pool := l.pool.Load()
+
+	kind, err := logTableKind(ctx, pool)
+	if err != nil || kind == "" {
+		return result, err
+	}
+	now, err := localTimestamp(ctx, pool)
+	if err != nil {
+		return result, err
+	}
+
+	if kind == relkindPartitioned {
+		result.Created, err = ensureLogPartitions(ctx, pool, now)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if l.config.Retention <= 0 {
+		return result, nil
+	}
+	cutoff := now.Add(-l.config.Retention)
+
+	if kind != relkindPartitioned {
+		result.Deleted, err = l.deleteExpired(ctx, cutoff)
+		return result, err
+	}
+
+	partitions, err := LogPartitions(ctx, pool)
+	if err != nil {
+		return result, err
+	}
+	for _, p := range expiredPartitions(partitions, cutoff) {
+		if l.config.ArchiveSchema != "" {
+			if err := l.archive(ctx, p.Name); err != nil {
+				return result, err
+			}
+			result.Archived = append(result.Archived, p.Name)
+			continue
+		}
+		if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS "+pgx.Identifier{"pgb", p.Name}.Sanitize()); err != nil {
+			return result, fmt.Errorf("failed to drop partition %s: %w", p.Name, err)
+		}
+		result.Dropped = append(result.Dropped, p.Name)
+	}
+
+	return result, nil
+}
+
+// archive detaches a partition and moves it to the archive schema, where
+// it is a plain table no longer touched by pgbridge
+func (l *LogMaintainer) archive(ctx context.Context, partition string) error {
+	schema := pgx.Identifier{l.config.ArchiveSchema}.Sanitize()
+	table := pgx.Identifier{"pgb", partition}.Sanitize()
+
+	tx, err := l.pool.Load().Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	statements := []string{
+		"CREATE SCHEMA IF NOT EXISTS " + schema,
+		"ALTER TABLE pgb.pgb_log DETACH PARTITION " + table,
+		"ALTER TABLE " + table + " SET SCHEMA " + schema,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to archive partition %s: %w", partition, err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// deleteExpired deletes the rows of a plain pgb_log older than cutoff, in
+// batches so that no single statement holds locks for long
+func (l *LogMaintainer) deleteExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	var deleted int64
+	for {
+		tag, err := l.pool.Load().Exec(ctx, deleteOldLogRowsSQL, cutoff, logDeleteBatch)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete expired log rows: %w", err)
+		}
+		deleted += tag.RowsAffected()
+		if tag.RowsAffected() < logDeleteBatch {
+			return deleted, nil
+		}
+	}
+}
+
+// Stop stops maintaining and waits for a running pass to finish
+func (l *LogMaintainer) Stop() {
+	l.stopOnce.Do(func() {
+		l.cancel()
+		l.wg.Wait()
+	})
+}
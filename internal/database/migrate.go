@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/logger"
+)
+
+// migrationLockKey is the advisory lock serializing migrations across
+// instances and commands ("pgb_migr")
+const migrationLockKey int64 = 0x7067625f6d696772
+
+const (
+	// Applied migrations, one row per component and version
+	createVersionTableSQL = `
+		CREATE TABLE IF NOT EXISTS pgb.pgb_schema_version (
+			component VARCHAR(50) NOT NULL,
+			version INTEGER NOT NULL,
+			name VARCHAR(200) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (component, version)
+		);
+
+		COMMENT ON TABLE pgb.pgb_schema_version IS 'Schema migrations applied by pgbridge';`
+
+	insertVersionSQL = `
+		INSERT INTO pgb.pgb_schema_version (component, version, name)
+		VALUES ($1, $2, $3);`
+
+	deleteVersionSQL = `
+		DELETE FROM pgb.pgb_schema_version
+		WHERE component = $1 AND version = $2;`
+)
+
+// versionTable is the table recording applied migrations
+var versionTable = SchemaObject{Kind: ObjectTable, Schema: "pgb", Name: "pgb_schema_version"}
+
+// ErrIrreversible is returned when rolling back a migration without Down
+var ErrIrreversible = errors.New("migration cannot be rolled back")
+
+// Migration is one schema change of a component (the core schema or a
+// module). Migrations of a component are numbered from 1 and applied in
+// order, each in its own transaction together with its version row.
+type Migration struct {
+	Version int
+	Name    string
+
+	// Up applies the change; it runs after Initialize, so it may rely on
+	// the objects Initialize creates
+	Up string
+
+	// Down reverts Up; empty if the migration cannot be rolled back
+	Down string
+}
+
+// MigrationStatus is a migration and whether it was applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// CheckMigrations verifies that versions run 1, 2, 3, … without gaps
+func CheckMigrations(component string, migrations []Migration) error {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %d of %s has version %d: versions must run from 1 without gaps", i+1, component, m.Version)
+		}
+		if m.Name == "" || m.Up == "" {
+			return fmt.Errorf("migration %d of %s needs a name and an Up statement", m.Version, component)
+		}
+	}
+	return nil
+}
+
+// Migrator applies and rolls back the migrations of a database
+type Migrator struct {
+	pool         *pgxpool.Pool
+	databaseName string
+	logger       *logger.Logger
+}
+
+// NewMigrator creates a new migrator
+func NewMigrator(pool *pgxpool.Pool, databaseName string, log *logger.Logger) *Migrator {
+	return &Migrator{
+		pool:         pool,
+		databaseName: databaseName,
+		logger:       log,
+	}
+}
+
+// Status returns every migration of a component with whether it was
+// applied. It only reads, so it can run on a read-only connection.
+func (m *Migrator) Status(ctx context.Context, component string, migrations []Migration) ([]MigrationStatus, error) {
+	if err := CheckMigrations(component, migrations); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx, m.pool, component)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		status[i] = MigrationStatus{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status[i].Applied = true
+			status[i].AppliedAt = &appliedAt
+		}
+	}
+	return status, nil
+}
+
+// Pending returns the migrations of a component that were not applied
+func (m *Migrator) Pending(ctx context.Context, component string, migrations []Migration) ([]Migration, error) {
+	status, err := m.Status(ctx, component, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, s := range status {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations of a component in order and returns
+// them. Concurrent migrators wait for each other on an advisory lock, so
+// instances starting together apply each migration once.
+func (m *Migrator) Up(ctx context.Context, component string, migrations []Migration) ([]Migration, error) {
+	if err := CheckMigrations(component, migrations); err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, nil
+	}
+
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn, component)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, conn, migration.Up, insertVersionSQL, component, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("failed to apply migration %d (%s) of %s: %w", migration.Version, migration.Name, component, err)
+			}
+			done = append(done, migration)
+			if m.logger != nil {
+				m.logger.LogSystemf(logger.LevelInfo, "schema", "Applied migration %s %d (%s) on %s", component, migration.Version, migration.Name, m.databaseName)
+			}
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the latest steps applied migrations of a component, most
+// recent first, and returns them
+func (m *Migrator) Down(ctx context.Context, component string, migrations []Migration, steps int) ([]Migration, error) {
+	if err := CheckMigrations(component, migrations); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn, component)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("%s %d (%s): %w", component, migration.Version, migration.Name, ErrIrreversible)
+			}
+			if err := m.run(ctx, conn, migration.Down, deleteVersionSQL, component, migration.Version); err != nil {
+				return fmt.Errorf("failed to roll back migration %d (%s) of %s: %w", migration.Version, migration.Name, component, err)
+			}
+			done = append(done, migration)
+			if m.logger != nil {
+				m.logger.LogSystemf(logger.LevelWarn, "schema", "Rolled back migration %s %d (%s) on %s", component, migration.Version, migration.Name, m.databaseName)
+			}
+		}
+		return nil
+	})
+	return done, err
+}
+
+// locked creates the version table and runs fn holding the migration lock
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	if _, err := conn.Exec(ctx, createSchemaSQL+createVersionTableSQL); err != nil {
+		return fmt.Errorf("failed to create schema version table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// run executes a migration statement and updates its version row in one
+// transaction
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, statement, versionSQL string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, statement); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, versionSQL, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// querier runs queries on a pool or a connection
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// applied returns when each applied version of a component was applied;
+// nothing is applied before the version table exists
+func (m *Migrator) applied(ctx context.Context, q querier, component string) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+
+	exists, err := ObjectExists(ctx, m.pool, versionTable)
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT version, applied_at FROM pgb.pgb_schema_version
+		WHERE component = $1
+	`, component)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema versions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema versions: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Schema object kinds
+const (
+	ObjectSchema   = "schema"
+	ObjectTable    = "table"
+	ObjectColumn   = "column"
+	ObjectIndex    = "index"
+	ObjectFunction = "function"
+	ObjectTrigger  = "trigger"
+)
+
+// Planned actions
+const (
+	ActionCreate  = "create"
+	ActionAdd     = "add"
+	ActionReplace = "replace"
+	ActionNone    = "none"
+)
+
+// SchemaObject is a database object created by an initializer
+type SchemaObject struct {
+	Kind   string
+	Schema string
+
+	// Table is the table of a column, index or trigger
+	Table string
+
+	// Name is the name of the object; empty for a schema
+	Name string
+
+	// Replaced objects are replaced on every initialization (CREATE OR
+	// REPLACE FUNCTION, DROP and CREATE TRIGGER)
+	Replaced bool
+
+	// Timing, Events and Function define a FOR EACH ROW trigger, e.g.
+	// AFTER, INSERT OR UPDATE and pgb.trg_pgb_send_notification; the
+	// drift check compares them with the catalog when Timing is set
+	Timing   string
+	Events   string
+	Function string
+}
+
+// String returns the qualified name of the object
+func (o SchemaObject) String() string {
+	switch o.Kind {
+	case ObjectSchema:
+		return "schema " + o.Schema
+	case ObjectColumn:
+		return fmt.Sprintf("column %s.%s.%s", o.Schema, o.Table, o.Name)
+	case ObjectTrigger:
+		return fmt.Sprintf("trigger %s on %s.%s", o.Name, o.Schema, o.Table)
+	case ObjectFunction:
+		return fmt.Sprintf("function %s.%s()", o.Schema, o.Name)
+	default:
+		return fmt.Sprintf("%s %s.%s", o.Kind, o.Schema, o.Name)
+	}
+}
+
+// SchemaChange is what initialization would do to an object
+type SchemaChange struct {
+	Object SchemaObject
+	Action string
+}
+
+// String describes the change
+func (c SchemaChange) String() string {
+	if c.Action == ActionNone {
+		return c.Object.String() + " exists"
+	}
+	return c.Action + " " + c.Object.String()
+}
+
+// PlanSchema reports what creating the objects would change, using only
+// catalog queries. Columns of a table that does not exist yet are created
+// with it and are not reported.
+func PlanSchema(ctx context.Context, pool *pgxpool.Pool, objects []SchemaObject) ([]SchemaChange, error) {
+	missingTables := make(map[string]bool)
+	var changes []SchemaChange
+
+	for _, object := range objects {
+		table := object.Schema + "." + object.Table
+		if object.Kind == ObjectColumn && missingTables[table] {
+			continue
+		}
+
+		exists, err := ObjectExists(ctx, pool, object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s: %w", object, err)
+		}
+
+		action := ActionNone
+		switch {
+		case !exists && object.Kind == ObjectColumn:
+			action = ActionAdd
+		case !exists:
+			action = ActionCreate
+			if object.Kind == ObjectTable {
+				missingTables[object.Schema+"."+object.Name] = true
+			}
+		case object.Replaced:
+			action = ActionReplace
+		}
+
+		changes = append(changes, SchemaChange{Object: object, Action: action})
+	}
+
+	return changes, nil
+}
+
+// ObjectExists looks an object up in the catalog; unquoted names are
+// folded to lower case as PostgreSQL does
+func ObjectExists(ctx context.Context, pool *pgxpool.Pool, o SchemaObject) (bool, error) {
+	var query string
+	var args []interface{}
+
+	switch o.Kind {
+	case ObjectSchema:
+		query = `SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)`
+		args = []interface{}{o.Schema}
+	case ObjectTable, ObjectIndex:
+		query = `SELECT to_regclass($1) IS NOT NULL`
+		args = []interface{}{o.Schema + "." + o.Name}
+	case ObjectColumn:
+		query = `
+			SELECT EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_schema = $1 AND table_name = $2 AND column_name = $3
+			)`
+		args = []interface{}{o.Schema, o.Table, strings.ToLower(o.Name)}
+	case ObjectFunction:
+		query = `
+			SELECT EXISTS (
+				SELECT 1 FROM pg_proc p
+				JOIN pg_namespace n ON n.oid = p.pronamespace
+				WHERE n.nspname = $1 AND p.proname = $2
+			)`
+		args = []interface{}{o.Schema, strings.ToLower(o.Name)}
+	case ObjectTrigger:
+		query = `
+			SELECT EXISTS (
+				SELECT 1 FROM pg_trigger t
+				JOIN pg_class c ON c.oid = t.tgrelid
+				JOIN pg_namespace n ON n.oid = c.relnamespace
+				WHERE n.nspname = $1 AND c.relname = $2 AND t.tgname = $3
+				AND NOT t.tgisinternal
+			)`
+		args = []interface{}{o.Schema, o.Table, strings.ToLower(o.Name)}
+	default:
+		return false, fmt.Errorf("unknown object kind '%s'", o.Kind)
+	}
+
+	var exists bool
+	err := pool.QueryRow(ctx, query, args...).Scan(&exists)
+	return exists, err
+}
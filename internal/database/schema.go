@@ -45,6 +45,7 @@ const (
 type SchemaInitializer struct {
 	pool         *pgxpool.Pool
 	databaseName string
+	logConfig    LogConfig
 	logger       *logger.Logger
 }
 
@@ -57,6 +58,11 @@ func NewSchemaInitializer(pool *pgxpool.Pool, databaseName string, log *logger.L
 	}
 }
 
+// SetLogConfig configures how pgb_log is created
+func (si *SchemaInitializer) SetLogConfig(cfg LogConfig) {
+	si.logConfig = cfg
+}
+
 // Initialize creates the pgb schema and all required tables
 func (si *SchemaInitializer) Initialize(ctx context.Context) error {
 	if si.logger != nil {
@@ -90,6 +96,15 @@ func (si *SchemaInitializer) Initialize(ctx context.Context) error {
 		return indexErr
 	}
 
+	// Create the migration version table
+	if err := si.createVersionTable(ctx); err != nil {
+		versionErr := fmt.Errorf("failed to create schema version table: %w", err)
+		if si.logger != nil {
+			si.logger.LogModuleError(si.databaseName, "schema", "create version table", versionErr)
+		}
+		return versionErr
+	}
+
 	// Log service startup
 	if err := si.logServiceStartup(ctx); err != nil {
 		logErr := fmt.Errorf("failed to log service startup: %w", err)
@@ -106,15 +121,84 @@ func (si *SchemaInitializer) Initialize(ctx context.Context) error {
 	return nil
 }
 
+// Objects returns the objects created by Initialize
+func (si *SchemaInitializer) Objects() []SchemaObject {
+	return []SchemaObject{
+		{Kind: ObjectSchema, Schema: "pgb"},
+		{Kind: ObjectTable, Schema: "pgb", Name: "pgb_log"},
+		{Kind: ObjectIndex, Schema: "pgb", Table: "pgb_log", Name: "idx_pgb_log_timestamp"},
+		{Kind: ObjectIndex, Schema: "pgb", Table: "pgb_log", Name: "idx_pgb_log_event_type"},
+		versionTable,
+	}
+}
+
+// Repair creates missing objects like Initialize, without logging a
+// service startup
+func (si *SchemaInitializer) Repair(ctx context.Context) error {
+	steps := []func(ctx context.Context) error{
+		si.createSchema,
+		si.createLogTable,
+		si.createIndexes,
+		si.createVersionTable,
+	}
+	for _, step := range steps {
+		if err := step(ctx); err != nil {
+			return fmt.Errorf("failed to repair schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// Plan reports what Initialize would change, without changing anything
+func (si *SchemaInitializer) Plan(ctx context.Context) ([]SchemaChange, error) {
+	return PlanSchema(ctx, si.pool, si.Objects())
+}
+
 // createSchema creates the pgb schema if it doesn't exist
 func (si *SchemaInitializer) createSchema(ctx context.Context) error {
 	_, err := si.pool.Exec(ctx, createSchemaSQL)
 	return err
 }
 
-// createLogTable creates the pgb_log table if it doesn't exist
+// createLogTable creates the pgb_log table if it doesn't exist. With a
+// partitioned log configured, a plain pgb_log is converted; a partitioned
+// pgb_log gets the partitions of the coming days either way.
 func (si *SchemaInitializer) createLogTable(ctx context.Context) error {
-	_, err := si.pool.Exec(ctx, createLogTableSQL)
+	kind, err := logTableKind(ctx, si.pool)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case kind == "" && !si.logConfig.Partitioned:
+		_, err := si.pool.Exec(ctx, createLogTableSQL)
+		return err
+	case kind == "" && si.logConfig.Partitioned:
+		if err := createPartitionedLogTable(ctx, si.pool, false); err != nil {
+			return err
+		}
+	case kind == relkindPlain && si.logConfig.Partitioned:
+		if si.logger != nil {
+			si.logger.LogSystemf(logger.LevelInfo, "schema", "Converting pgb_log to a partitioned table on %s", si.databaseName)
+		}
+		if err := createPartitionedLogTable(ctx, si.pool, true); err != nil {
+			return err
+		}
+	case kind != relkindPartitioned:
+		return nil
+	}
+
+	now, err := localTimestamp(ctx, si.pool)
+	if err != nil {
+		return err
+	}
+	_, err = ensureLogPartitions(ctx, si.pool, now)
+	return err
+}
+
+// createVersionTable creates the table recording applied migrations
+func (si *SchemaInitializer) createVersionTable(ctx context.Context) error {
+	_, err := si.pool.Exec(ctx, createVersionTableSQL)
 	return err
 }
 
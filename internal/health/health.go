@@ -0,0 +1,104 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Module states
+const (
+	// StateRunning means the module is started and its channel is routed
+	StateRunning = "running"
+	// StatePending means the module is configured but not started yet,
+	// e.g. because its database is degraded
+	StatePending = "pending"
+	// StateFailed means the module failed to start; it is retried on reload
+	StateFailed = "failed"
+	// StateStandby means another instance leads the database; the module
+	// starts when this instance takes over
+	StateStandby = "standby"
+	// StatePaused means the module was paused in pgb.pgb_control: its
+	// channel is routed, but notifications are deferred until it is resumed
+	StatePaused = "paused"
+)
+
+// ModuleStatus is the state of one module of a database
+type ModuleStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+	// Reason is why a paused module was paused
+	Reason string `json:"reason,omitempty"`
+}
+
+// DatabaseStatus is the state of one database and its modules
+type DatabaseStatus struct {
+	Name      string         `json:"name"`
+	Ready     bool           `json:"ready"`
+	Connected bool           `json:"connected"`
+	Listening bool           `json:"listening"`
+	Degraded  bool           `json:"degraded"`
+	Standby   bool           `json:"standby"`
+	Modules   []ModuleStatus `json:"modules"`
+}
+
+// Report is the readiness of the whole service
+type Report struct {
+	Ready     bool             `json:"ready"`
+	Databases []DatabaseStatus `json:"databases"`
+}
+
+// Checker returns the current state of the service
+type Checker func() Report
+
+// Evaluate sets the Ready flags: a database is ready when it is connected,
+// listening and all its modules are running or paused, or when it is
+// connected and stands by for another instance; the service is ready when
+// every database is
+func (r *Report) Evaluate() {
+	r.Ready = true
+	for i := range r.Databases {
+		db := &r.Databases[i]
+		if db.Standby {
+			db.Ready = db.Connected && !db.Degraded
+		} else {
+			db.Ready = db.Connected && db.Listening && !db.Degraded
+		}
+		for _, module := range db.Modules {
+			if module.State != StateRunning && module.State != StatePaused && module.State != StateStandby {
+				db.Ready = false
+			}
+		}
+		if !db.Ready {
+			r.Ready = false
+		}
+	}
+}
+
+// Register adds the /healthz and /readyz endpoints to mux
+// /healthz answers 200 as long as the process serves requests; /readyz
+// answers 200 when the service is ready and 503 otherwise, with the
+// per-database and per-module breakdown as JSON body.
+func Register(mux *http.ServeMux, check Checker) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := check()
+		report.Evaluate()
+
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
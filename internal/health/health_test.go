@@ -0,0 +1,117 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func readyReport() Report {
+	return Report{
+		Databases: []DatabaseStatus{
+			{
+				Name:      "db1",
+				Connected: true,
+				Listening: true,
+				Modules:   []ModuleStatus{{Name: "pgb_mail", State: StateRunning}},
+			},
+		},
+	}
+}
+
+func serve(t *testing.T, check Checker, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	Register(mux, check)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestHealthz(t *testing.T) {
+	rec := serve(t, func() Report { return Report{} }, "/healthz")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+}
+
+func TestReadyz_Ready(t *testing.T) {
+	rec := serve(t, readyReport, "/readyz")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid JSON body: %v", err)
+	}
+	if !report.Ready || len(report.Databases) != 1 || !report.Databases[0].Ready {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if report.Databases[0].Modules[0].State != StateRunning {
+		t.Errorf("Expected module breakdown in body, got %+v", report.Databases[0].Modules)
+	}
+}
+
+func TestReadyz_NotReady(t *testing.T) {
+	cases := map[string]func(r *Report){
+		"disconnected":   func(r *Report) { r.Databases[0].Connected = false },
+		"not listening":  func(r *Report) { r.Databases[0].Listening = false },
+		"degraded":       func(r *Report) { r.Databases[0].Degraded = true },
+		"module failed":  func(r *Report) { r.Databases[0].Modules[0].State = StateFailed },
+		"module pending": func(r *Report) { r.Databases[0].Modules[0].State = StatePending },
+	}
+
+	for name, breakIt := range cases {
+		t.Run(name, func(t *testing.T) {
+			rec := serve(t, func() Report {
+				r := readyReport()
+				breakIt(&r)
+				return r
+			}, "/readyz")
+
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Errorf("Expected 503, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestReadyz_Standby(t *testing.T) {
+	standby := func() Report {
+		r := readyReport()
+		r.Databases[0].Standby = true
+		r.Databases[0].Listening = false
+		r.Databases[0].Modules[0].State = StateStandby
+		return r
+	}
+
+	rec := serve(t, standby, "/readyz")
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a standby database to be ready, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(t, func() Report {
+		r := standby()
+		r.Databases[0].Connected = false
+		return r
+	}, "/readyz")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a disconnected standby database not to be ready, got %d", rec.Code)
+	}
+}
+
+func TestReadyz_Paused(t *testing.T) {
+	rec := serve(t, func() Report {
+		r := readyReport()
+		r.Databases[0].Modules[0].State = StatePaused
+		r.Databases[0].Modules[0].Reason = "SMTP incident"
+		return r
+	}, "/readyz")
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a paused module to be ready, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,230 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"pgbridge/internal/logger"
+)
+
+// DefaultInterval is how often a standby tries to acquire the lock and
+// the leader pings its session; a session that ends is noticed at once
+const DefaultInterval = 5 * time.Second
+
+// ErrSessionLost is reported when the session holding the lock ended
+var ErrSessionLost = errors.New("lock session lost")
+
+// Key derives an advisory lock key from a name. Advisory locks are scoped
+// to a database, so the same key elects one leader per database.
+func Key(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// Config configures an elector
+type Config struct {
+	// Key is the advisory lock key
+	Key int64
+
+	// Interval is how often a standby tries to acquire the lock and the
+	// leader pings its session; DefaultInterval when zero
+	Interval time.Duration
+
+	// OnChange is called after leadership was acquired or lost; IsLeader
+	// tells which. It runs on the election loop and must not block.
+	OnChange func()
+}
+
+// Elector campaigns for leadership of a database by holding a
+// session-level advisory lock (pg_try_advisory_lock) on a dedicated
+// connection. PostgreSQL releases the lock when that session ends, so a
+// standby takes over on its next attempt after the leader's session
+// disappears.
+type Elector struct {
+	dbName     string
+	connString string
+	config     Config
+	logger     *logger.Logger
+
+	conn     *pgx.Conn
+	leader   atomic.Bool
+	standby  bool
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewElector creates an elector for a database
+func NewElector(dbName, connString string, cfg Config, log *logger.Logger) *Elector {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.OnChange == nil {
+		cfg.OnChange = func() {}
+	}
+
+	return &Elector{
+		dbName:     dbName,
+		connString: connString,
+		config:     cfg,
+		logger:     log,
+	}
+}
+
+// Start begins campaigning in the background
+func (e *Elector) Start(ctx context.Context) {
+	ctx, e.cancel = context.WithCancel(ctx)
+
+	e.wg.Add(1)
+	go e.run(ctx)
+}
+
+// IsLeader returns whether this instance holds the lock
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Stop stops campaigning and closes the lock session, which releases the
+// lock for a standby. OnChange is not called.
+func (e *Elector) Stop() {
+	e.stopOnce.Do(func() {
+		if e.cancel != nil {
+			e.cancel()
+		}
+		e.wg.Wait()
+
+		e.closeConn()
+		e.leader.Store(false)
+	})
+}
+
+// run tries to acquire the lock every interval while standing by, and
+// watches the session while leading
+func (e *Elector) run(ctx context.Context) {
+	defer e.wg.Done()
+
+	for {
+		e.step(ctx)
+
+		// The leader spends the interval waiting on its session
+		if e.leader.Load() && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.config.Interval):
+		}
+	}
+}
+
+// step makes one election round
+func (e *Elector) step(ctx context.Context) {
+	if e.leader.Load() {
+		e.check(ctx)
+		return
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, e.config.Interval)
+	defer cancel()
+
+	acquired, err := e.tryLock(checkCtx)
+	if err != nil {
+		if ctx.Err() == nil && e.logger != nil {
+			e.logger.LogSystemf(logger.LevelWarn, "leader", "Leader election for %s failed, retrying in %s: %v", e.dbName, e.config.Interval, err)
+		}
+		e.closeConn()
+		return
+	}
+
+	if !acquired {
+		if !e.standby && e.logger != nil {
+			e.logger.LogSystemf(logger.LevelInfo, "leader", "Another instance leads %s, standing by", e.dbName)
+		}
+		e.standby = true
+		return
+	}
+
+	e.standby = false
+	e.leader.Store(true)
+	if e.logger != nil {
+		e.logger.LogLeaderElected(e.dbName, e.config.Key)
+	}
+	e.config.OnChange()
+}
+
+// check waits on the lock session for an interval, which fails as soon as
+// the server ends the session, then pings it to catch a connection that
+// went away silently. Leadership is lost when either fails.
+func (e *Elector) check(ctx context.Context) {
+	err := e.wait(ctx)
+	if err == nil {
+		pingCtx, cancel := context.WithTimeout(ctx, e.config.Interval)
+		err = e.conn.Ping(pingCtx)
+		cancel()
+	}
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+
+	e.closeConn()
+	e.leader.Store(false)
+	if e.logger != nil {
+		e.logger.LogLeaderLost(e.dbName, e.config.Key, fmt.Errorf("%w: %v", ErrSessionLost, err))
+	}
+	e.config.OnChange()
+}
+
+// wait reads from the lock session until the interval passed; nothing is
+// sent on it, so it returns early only when the session ended
+func (e *Elector) wait(ctx context.Context) error {
+	waitCtx, cancel := context.WithTimeout(ctx, e.config.Interval)
+	defer cancel()
+
+	for {
+		_, err := e.conn.WaitForNotification(waitCtx)
+		if err == nil {
+			continue
+		}
+		// A timeout leaves the session usable
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil
+		}
+		return err
+	}
+}
+
+// tryLock opens the lock session if needed and tries to acquire the lock
+func (e *Elector) tryLock(ctx context.Context) (bool, error) {
+	if e.conn == nil {
+		conn, err := pgx.Connect(ctx, e.connString)
+		if err != nil {
+			return false, fmt.Errorf("failed to open lock session: %w", err)
+		}
+		e.conn = conn
+	}
+
+	var acquired bool
+	if err := e.conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", e.config.Key).Scan(&acquired); err != nil {
+		return false, fmt.Errorf("failed to try advisory lock: %w", err)
+	}
+	return acquired, nil
+}
+
+// closeConn closes the lock session, releasing the lock if held
+func (e *Elector) closeConn() {
+	if e.conn != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		e.conn.Close(ctx)
+		e.conn = nil
+	}
+}
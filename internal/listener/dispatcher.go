@@ -0,0 +1,539 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/metrics"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/tracing"
+	"pgbridge/internal/worker"
+)
+
+const (
+	// waitTimeout bounds a single WaitForNotification call so shutdown and
+	// subscription changes are picked up promptly
+	waitTimeout = 10 * time.Second
+	// stallTimeout is how long the listen loop may go without finishing a
+	// wait before the dispatcher counts as stalled
+	stallTimeout = 3 * waitTimeout
+
+	initialReconnectDelay = 1 * time.Second
+	maxReconnectDelay     = 60 * time.Second
+)
+
+// ErrDispatcherStopped is returned when subscribing to a stopped dispatcher
+var ErrDispatcherStopped = errors.New("dispatcher stopped")
+
+// Dispatcher LISTENs on the channels of all modules of one database over a
+// single dedicated connection and routes each notification to the worker
+// pool of the module subscribed to its channel
+type Dispatcher struct {
+	dbName     string
+	connString string
+	logger     *logger.Logger
+	conn       *pgx.Conn
+	routes     map[string]*route
+	commands   chan *command
+	wake       context.CancelFunc
+	listening  bool
+	lastWait   time.Time
+	ctx        context.Context
+	cancel     context.CancelFunc
+	shutdown   chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+	mu         sync.RWMutex
+}
+
+// route binds a channel to the module handling it
+type route struct {
+	module modules.Module
+	pool   *worker.Pool
+	// catchUps counts the catch-ups requested since the running one
+	// started; zero when none is running
+	catchUps atomic.Int64
+}
+
+// command is a subscription change executed by the listen loop, which owns
+// the connection
+type command struct {
+	channel string
+	route   *route // nil to unsubscribe
+	done    chan error
+}
+
+// NewDispatcher creates a new dispatcher for a database
+func NewDispatcher(dbName, connString string, log *logger.Logger) *Dispatcher {
+	return &Dispatcher{
+		dbName:     dbName,
+		connString: connString,
+		logger:     log,
+		routes:     make(map[string]*route),
+		commands:   make(chan *command, 16),
+		shutdown:   make(chan struct{}),
+	}
+}
+
+// Start opens the LISTEN connection and begins dispatching
+// Channels subscribed before Start are LISTENed immediately
+func (d *Dispatcher) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	d.mu.Lock()
+	d.ctx, d.cancel = ctx, cancel
+	d.mu.Unlock()
+
+	conn, err := d.connect(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	d.mu.Lock()
+	d.conn = conn
+	d.listening = true
+	d.lastWait = time.Now()
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go d.listen(ctx)
+
+	return nil
+}
+
+// Subscribe routes notifications on the module's channel to its worker pool
+// If the dispatcher is running, LISTEN is issued on the existing connection
+func (d *Dispatcher) Subscribe(ctx context.Context, module modules.Module, pool *worker.Pool) error {
+	return d.submit(ctx, &command{
+		channel: module.GetChannelName(),
+		route:   &route{module: module, pool: pool},
+		done:    make(chan error, 1),
+	})
+}
+
+// Unsubscribe stops routing notifications on a channel
+// If the dispatcher is running, UNLISTEN is issued on the existing connection
+func (d *Dispatcher) Unsubscribe(ctx context.Context, channel string) error {
+	return d.submit(ctx, &command{
+		channel: channel,
+		done:    make(chan error, 1),
+	})
+}
+
+// submit hands a subscription change to the listen loop and waits for it
+func (d *Dispatcher) submit(ctx context.Context, cmd *command) error {
+	select {
+	case <-d.shutdown:
+		return ErrDispatcherStopped
+	default:
+	}
+
+	// Before Start there is no loop yet: just record the route
+	d.mu.Lock()
+	if d.ctx == nil {
+		d.setRoute(cmd)
+		d.mu.Unlock()
+		return nil
+	}
+	d.mu.Unlock()
+
+	select {
+	case d.commands <- cmd:
+	case <-d.shutdown:
+		return ErrDispatcherStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Interrupt a pending WaitForNotification so the command runs now
+	d.mu.Lock()
+	if d.wake != nil {
+		d.wake()
+	}
+	d.mu.Unlock()
+
+	select {
+	case err := <-cmd.done:
+		return err
+	case <-d.shutdown:
+		return ErrDispatcherStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Channels returns the currently subscribed channels
+func (d *Dispatcher) Channels() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	channels := make([]string, 0, len(d.routes))
+	for channel := range d.routes {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// IsListening returns whether the LISTEN connection is currently up
+func (d *Dispatcher) IsListening() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.listening
+}
+
+// Stalled reports whether the dispatcher is listening but its listen loop
+// has not finished a wait for stallTimeout
+func (d *Dispatcher) Stalled(now time.Time) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.listening && now.Sub(d.lastWait) > stallTimeout
+}
+
+// connect opens a dedicated connection and LISTENs on all routed channels
+func (d *Dispatcher) connect(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, d.connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LISTEN connection: %w", err)
+	}
+
+	for _, channel := range d.Channels() {
+		if err := listenOn(ctx, conn, channel); err != nil {
+			conn.Close(ctx)
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// listen waits for notifications and routes them by channel
+func (d *Dispatcher) listen(ctx context.Context) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.shutdown:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		d.runCommands(ctx)
+
+		// Wait for notification with timeout; subscription changes cancel
+		// the wait early through d.wake
+		waitCtx, cancel := context.WithTimeout(ctx, waitTimeout)
+		d.mu.Lock()
+		d.wake = cancel
+		if len(d.commands) > 0 {
+			cancel()
+		}
+		d.mu.Unlock()
+
+		notification, err := d.conn.WaitForNotification(waitCtx)
+
+		d.mu.Lock()
+		d.wake = nil
+		d.lastWait = time.Now()
+		d.mu.Unlock()
+		cancel()
+
+		if err != nil {
+			// Timeouts and wake-ups leave the connection usable
+			if errors.Is(err, context.DeadlineExceeded) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, context.Canceled) {
+				continue
+			}
+
+			// Real error
+			if d.logger != nil {
+				d.logger.LogListenerError(d.dbName, d.channelList(), err)
+			}
+
+			// pgx closes the connection on any non-timeout error, so a
+			// closed connection means the backend is gone
+			if d.conn.IsClosed() {
+				if !d.reconnect(ctx) {
+					return
+				}
+			}
+			continue
+		}
+
+		if notification != nil {
+			d.dispatch(ctx, notification.Channel, notification.Payload)
+		}
+	}
+}
+
+// dispatch hands a notification to the worker pool of its channel
+func (d *Dispatcher) dispatch(ctx context.Context, channel, payload string) {
+	d.mu.RLock()
+	r, ok := d.routes[channel]
+	d.mu.RUnlock()
+
+	if !ok {
+		// Notification raced with an UNLISTEN
+		return
+	}
+
+	metrics.NotificationsReceived.WithLabelValues(d.dbName, r.module.Name()).Inc()
+
+	if d.logger != nil {
+		d.logger.LogSystemf(logger.LevelDebug, "listener", "Received notification on %s/%s: %s", d.dbName, channel, payload)
+	}
+
+	// The receive span ends once the notification is queued; the worker
+	// continues its trace
+	ctx, span := tracing.Start(ctx, r.module.Name()+" receive",
+		tracing.Database(d.dbName),
+		tracing.Module(r.module.Name()),
+		attribute.String("messaging.destination.name", channel),
+	)
+	defer span.End()
+	job := worker.Job{Payload: payload, Trace: span.SpanContext()}
+	if n, err := modules.ParseNotification(payload); err == nil {
+		span.SetAttributes(tracing.RowID(n.ID), tracing.OpKey.String(n.Op))
+		job.Priority = n.Priority
+	}
+
+	// Hand off to the worker pool without blocking, so one busy module
+	// does not hold up the other channels; when its queue is full the
+	// item is left in the table for a catch-up
+	if err := r.pool.TrySubmit(ctx, job); err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, worker.ErrPoolStopped) {
+			return
+		}
+		if errors.Is(err, worker.ErrDuplicateJob) {
+			// Already queued, e.g. by the queue sweep
+			span.SetAttributes(attribute.Bool("pgbridge.duplicate", true))
+			return
+		}
+		if errors.Is(err, worker.ErrQueueFull) {
+			span.SetAttributes(attribute.Bool("pgbridge.deferred", true))
+			d.requestCatchUp(ctx, r, "its worker queue is full")
+			return
+		}
+		tracing.Fail(span, err)
+		if d.logger != nil {
+			d.logger.LogSystemf(logger.LevelError, "listener", "Failed to queue notification on %s/%s: %v", d.dbName, channel, err)
+		}
+	}
+}
+
+// runCommands executes pending subscription changes
+func (d *Dispatcher) runCommands(ctx context.Context) {
+	for {
+		select {
+		case cmd := <-d.commands:
+			cmd.done <- d.runCommand(ctx, cmd)
+		default:
+			return
+		}
+	}
+}
+
+// runCommand issues LISTEN/UNLISTEN for a subscription change and updates
+// the routing table. While disconnected only the routing table is updated;
+// the channel set is re-LISTENed on reconnect.
+func (d *Dispatcher) runCommand(ctx context.Context, cmd *command) error {
+	d.mu.RLock()
+	_, subscribed := d.routes[cmd.channel]
+	d.mu.RUnlock()
+
+	if d.conn != nil && !d.conn.IsClosed() {
+		if cmd.route != nil && !subscribed {
+			if err := listenOn(ctx, d.conn, cmd.channel); err != nil {
+				return err
+			}
+		}
+		if cmd.route == nil && subscribed {
+			if _, err := d.conn.Exec(ctx, "UNLISTEN "+pgx.Identifier{cmd.channel}.Sanitize()); err != nil {
+				return fmt.Errorf("failed to UNLISTEN on channel %s: %w", cmd.channel, err)
+			}
+		}
+	}
+
+	d.mu.Lock()
+	d.setRoute(cmd)
+	d.mu.Unlock()
+
+	if d.logger != nil {
+		if cmd.route != nil {
+			d.logger.LogListenerStarted(d.dbName, cmd.channel)
+		} else if subscribed {
+			d.logger.LogListenerStopped(d.dbName, cmd.channel)
+		}
+	}
+
+	return nil
+}
+
+// setRoute applies a command to the routing table (caller holds d.mu)
+func (d *Dispatcher) setRoute(cmd *command) {
+	if cmd.route != nil {
+		d.routes[cmd.channel] = cmd.route
+	} else {
+		delete(d.routes, cmd.channel)
+	}
+}
+
+// reconnect re-dials the LISTEN connection with exponential backoff and
+// processes the queue of every subscribed module to catch up on
+// notifications missed while disconnected. Returns false if the dispatcher
+// was stopped before a connection could be re-established.
+func (d *Dispatcher) reconnect(ctx context.Context) bool {
+	currentDelay := initialReconnectDelay
+	attempt := 0
+
+	d.mu.Lock()
+	d.listening = false
+	d.mu.Unlock()
+	d.conn.Close(context.Background())
+
+	for {
+		attempt++
+
+		if d.logger != nil {
+			d.logger.LogListenerReconnect(d.dbName, d.channelList(), attempt, currentDelay)
+		}
+
+		conn, err := d.connect(ctx)
+		if err == nil {
+			d.mu.Lock()
+			d.conn = conn
+			d.listening = true
+			d.mu.Unlock()
+
+			metrics.ListenerReconnects.WithLabelValues(d.dbName).Inc()
+			if d.logger != nil {
+				d.logger.LogListenerRecovered(d.dbName, d.channelList(), attempt)
+			}
+
+			// Pick up anything inserted while we were not listening
+			d.mu.RLock()
+			for _, r := range d.routes {
+				d.requestCatchUp(ctx, r, "the listener reconnected")
+			}
+			d.mu.RUnlock()
+			return true
+		}
+
+		if d.logger != nil {
+			d.logger.LogListenerError(d.dbName, d.channelList(), err)
+		}
+
+		// Wait before next attempt with exponential backoff, still
+		// accepting subscription changes in the meantime
+		timer := time.NewTimer(currentDelay)
+	wait:
+		for {
+			select {
+			case <-d.shutdown:
+				timer.Stop()
+				return false
+			case <-ctx.Done():
+				timer.Stop()
+				return false
+			case cmd := <-d.commands:
+				cmd.done <- d.runCommand(ctx, cmd)
+			case <-timer.C:
+				break wait
+			}
+		}
+
+		currentDelay *= 2
+		if currentDelay > maxReconnectDelay {
+			currentDelay = maxReconnectDelay
+		}
+	}
+}
+
+// requestCatchUp hands the queue of a route to its worker pool in the
+// background (see modules.CatchUp), so the listen loop keeps going. A
+// catch-up requested while one is running makes it run once more, for
+// the items it may have missed.
+func (d *Dispatcher) requestCatchUp(ctx context.Context, r *route, reason string) {
+	if r.catchUps.Add(1) > 1 {
+		return
+	}
+
+	if d.logger != nil {
+		d.logger.LogSystemf(logger.LevelInfo, "listener", "Catching up on the queue of %s/%s: %s", d.dbName, r.module.Name(), reason)
+	}
+
+	d.wg.Add(1)
+	go d.catchUp(ctx, r)
+}
+
+// catchUp runs the requested catch-ups of a route
+func (d *Dispatcher) catchUp(ctx context.Context, r *route) {
+	defer d.wg.Done()
+
+	for {
+		requested := r.catchUps.Load()
+
+		// Paused modules catch up when they are resumed
+		if !r.pool.Paused() {
+			_, err := modules.CatchUp(ctx, r.module, r.pool)
+			if err != nil && ctx.Err() == nil && !errors.Is(err, worker.ErrPoolStopped) && d.logger != nil {
+				d.logger.LogSystemf(logger.LevelWarn, "listener", "Catch-up queue processing for %s/%s had errors: %v", d.dbName, r.module.Name(), err)
+			}
+		}
+
+		if r.catchUps.Add(-requested) == 0 {
+			return
+		}
+	}
+}
+
+// channelList returns the subscribed channels as a comma-separated string
+func (d *Dispatcher) channelList() string {
+	return strings.Join(d.Channels(), ",")
+}
+
+// Stop closes the LISTEN connection and stops dispatching
+// Worker pools are owned by the caller and are not stopped
+func (d *Dispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.shutdown)
+		d.mu.RLock()
+		cancel := d.cancel
+		d.mu.RUnlock()
+		if cancel != nil {
+			cancel()
+		}
+		d.wg.Wait()
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.listening = false
+		if d.conn != nil {
+			d.conn.Close(context.Background())
+		}
+	})
+}
+
+// listenOn issues LISTEN for a channel
+func listenOn(ctx context.Context, conn *pgx.Conn, channel string) error {
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to LISTEN on channel %s: %w", channel, err)
+	}
+	return nil
+}
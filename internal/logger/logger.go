@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -16,19 +17,31 @@ import (
 const (
 	EventServiceStart       = "SERVICE_START"
 	EventServiceStop        = "SERVICE_STOP"
+	EventShutdownDrain      = "SHUTDOWN_DRAIN"
 	EventConfigLoaded       = "CONFIG_LOADED"
 	EventConfigError        = "CONFIG_ERROR"
+	EventConfigReload       = "CONFIG_RELOAD"
 	EventDBConnectSuccess   = "DB_CONNECT_SUCCESS"
 	EventDBConnectFail      = "DB_CONNECT_FAIL"
 	EventDBDisconnect       = "DB_DISCONNECT"
 	EventDBReconnect        = "DB_RECONNECT"
+	EventDBDegraded         = "DB_DEGRADED"
+	EventDBRecovered        = "DB_RECOVERED"
+	EventLeaderElected      = "LEADER_ELECTED"
+	EventLeaderLost         = "LEADER_LOST"
 	EventListenerStarted    = "LISTENER_STARTED"
 	EventListenerStopped    = "LISTENER_STOPPED"
 	EventListenerError      = "LISTENER_ERROR"
+	EventListenerReconnect  = "LISTENER_RECONNECT"
+	EventListenerRecovered  = "LISTENER_RECOVERED"
 	EventModuleInit         = "MODULE_INIT"
 	EventModuleStart        = "MODULE_START"
 	EventModuleStop         = "MODULE_STOP"
 	EventModuleError        = "MODULE_ERROR"
+	EventModulePaused       = "MODULE_PAUSED"
+	EventModuleResumed      = "MODULE_RESUMED"
+	EventSchemaDrift        = "SCHEMA_DRIFT"
+	EventSchemaRepaired     = "SCHEMA_REPAIRED"
 	EventNotificationRecv   = "NOTIFICATION_RECV"
 	EventNotificationProc   = "NOTIFICATION_PROC"
 	EventNotificationError  = "NOTIFICATION_ERROR"
@@ -72,6 +85,15 @@ type Logger struct {
 	mu           sync.RWMutex
 }
 
+// droppedEntries counts database log entries dropped by all loggers
+var droppedEntries atomic.Int64
+
+// DroppedEntries returns the number of database log entries dropped
+// because the log channel was full
+func DroppedEntries() int64 {
+	return droppedEntries.Load()
+}
+
 // NewLogger creates a new logger instance
 func NewLogger(serviceName string, dbPool *pgxpool.Pool) *Logger {
 	return &Logger{
@@ -89,6 +111,23 @@ func (l *Logger) Start(ctx context.Context) {
 	go l.databaseLogWriter(ctx)
 }
 
+// SetPool switches database logging to another connection pool
+func (l *Logger) SetPool(dbPool *pgxpool.Pool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dbPool = dbPool
+}
+
+// ReplacePool switches database logging to newPool if it writes to
+// oldPool, e.g. after the connection manager of its database reconnected
+func (l *Logger) ReplacePool(oldPool, newPool *pgxpool.Pool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dbPool == oldPool {
+		l.dbPool = newPool
+	}
+}
+
 // Shutdown gracefully stops the logger, flushing all pending logs
 func (l *Logger) Shutdown() {
 	l.shutdownOnce.Do(func() {
@@ -118,6 +157,7 @@ func (l *Logger) LogDatabase(entry *LogEntry) {
 		l.LogSystem(LevelWarn, "logger", "Cannot log to database during shutdown, logging to system")
 	default:
 		// Channel full, log to system as fallback
+		droppedEntries.Add(1)
 		l.LogSystem(LevelWarn, "logger", "Database log channel full, dropping log entry")
 	}
 }
@@ -204,7 +244,11 @@ func (l *Logger) flushLogs(ctx context.Context) {
 
 // writeLogEntry writes a single log entry to the database
 func (l *Logger) writeLogEntry(ctx context.Context, entry *LogEntry) error {
-	if l.dbPool == nil {
+	l.mu.RLock()
+	dbPool := l.dbPool
+	l.mu.RUnlock()
+
+	if dbPool == nil {
 		return fmt.Errorf("database pool is nil")
 	}
 
@@ -228,7 +272,7 @@ func (l *Logger) writeLogEntry(ctx context.Context, entry *LogEntry) error {
 		) VALUES ($1, $2, $3, $4, $5, $6)
 	`
 
-	_, err = l.dbPool.Exec(ctx, query,
+	_, err = dbPool.Exec(ctx, query,
 		l.serviceName,
 		entry.EventType,
 		nullStringIfEmpty(entry.DatabaseName),
@@ -273,6 +317,39 @@ func (l *Logger) LogConfigError(err error) {
 	})
 }
 
+// LogConfigReload logs the outcome of a configuration reload
+func (l *Logger) LogConfigReload(added, removed, changed int) {
+	l.Log(LevelInfo, "config", &LogEntry{
+		EventType: EventConfigReload,
+		Message:   fmt.Sprintf("Configuration reloaded: %d databases added, %d removed, %d changed", added, removed, changed),
+		Details: map[string]interface{}{
+			"added":   added,
+			"removed": removed,
+			"changed": changed,
+		},
+	})
+}
+
+// LogShutdownDrain logs how the notifications pending at shutdown ended;
+// modules maps "database/module" to its drained and aborted counts
+func (l *Logger) LogShutdownDrain(drained, aborted int, timeout time.Duration, modules map[string]interface{}) {
+	level := LevelInfo
+	if aborted > 0 {
+		level = LevelWarn
+	}
+
+	l.Log(level, "main", &LogEntry{
+		EventType: EventShutdownDrain,
+		Message:   fmt.Sprintf("Shutdown drain: %d notifications finished, %d aborted", drained, aborted),
+		Details: map[string]interface{}{
+			"drained": drained,
+			"aborted": aborted,
+			"timeout": timeout.String(),
+			"modules": modules,
+		},
+	})
+}
+
 // LogDBConnect logs successful database connection
 func (l *Logger) LogDBConnect(dbName string) {
 	l.Log(LevelInfo, "database", &LogEntry{
@@ -316,6 +393,57 @@ func (l *Logger) LogDBReconnect(dbName string, attempt int, delay time.Duration)
 	})
 }
 
+// LogDBDegraded logs that a database could not be started and is retried
+// in the background
+func (l *Logger) LogDBDegraded(dbName string, err error) {
+	l.Log(LevelWarn, "database", &LogEntry{
+		EventType:    EventDBDegraded,
+		DatabaseName: dbName,
+		Message:      fmt.Sprintf("Database %s is degraded, retrying in the background: %v", dbName, err),
+		Details: map[string]interface{}{
+			"error": err.Error(),
+		},
+	})
+}
+
+// LogDBRecovered logs that a degraded database has been started
+func (l *Logger) LogDBRecovered(dbName string, moduleCount int) {
+	l.Log(LevelInfo, "database", &LogEntry{
+		EventType:    EventDBRecovered,
+		DatabaseName: dbName,
+		Message:      fmt.Sprintf("Database %s recovered with %d modules", dbName, moduleCount),
+		Details: map[string]interface{}{
+			"module_count": moduleCount,
+		},
+	})
+}
+
+// LogLeaderElected logs that this instance became the leader for a database
+func (l *Logger) LogLeaderElected(dbName string, lockKey int64) {
+	l.Log(LevelInfo, "leader", &LogEntry{
+		EventType:    EventLeaderElected,
+		DatabaseName: dbName,
+		Message:      fmt.Sprintf("Became leader for database %s, starting processing", dbName),
+		Details: map[string]interface{}{
+			"lock_key": lockKey,
+		},
+	})
+}
+
+// LogLeaderLost logs that this instance stopped being the leader for a
+// database
+func (l *Logger) LogLeaderLost(dbName string, lockKey int64, err error) {
+	l.Log(LevelWarn, "leader", &LogEntry{
+		EventType:    EventLeaderLost,
+		DatabaseName: dbName,
+		Message:      fmt.Sprintf("Lost leadership for database %s, stopping processing: %v", dbName, err),
+		Details: map[string]interface{}{
+			"lock_key": lockKey,
+			"error":    err.Error(),
+		},
+	})
+}
+
 // LogModuleInit logs module initialization
 func (l *Logger) LogModuleInit(dbName, moduleName string) {
 	l.Log(LevelInfo, "module", &LogEntry{
@@ -336,6 +464,75 @@ func (l *Logger) LogModuleStart(dbName, moduleName string) {
 	})
 }
 
+// LogModuleStop logs module stop
+func (l *Logger) LogModuleStop(dbName, moduleName string) {
+	l.Log(LevelInfo, "module", &LogEntry{
+		EventType:    EventModuleStop,
+		DatabaseName: dbName,
+		ModuleName:   moduleName,
+		Message:      fmt.Sprintf("Stopped module %s for database %s", moduleName, dbName),
+	})
+}
+
+// LogModulePaused logs that a module defers its notifications
+func (l *Logger) LogModulePaused(dbName, moduleName, reason string) {
+	l.Log(LevelWarn, "module", &LogEntry{
+		EventType:    EventModulePaused,
+		DatabaseName: dbName,
+		ModuleName:   moduleName,
+		Message:      fmt.Sprintf("Paused module %s for database %s: %s", moduleName, dbName, reason),
+		Details: map[string]interface{}{
+			"reason": reason,
+		},
+	})
+}
+
+// LogModuleResumed logs that a paused module processes notifications again
+func (l *Logger) LogModuleResumed(dbName, moduleName string, deferred int) {
+	l.Log(LevelInfo, "module", &LogEntry{
+		EventType:    EventModuleResumed,
+		DatabaseName: dbName,
+		ModuleName:   moduleName,
+		Message:      fmt.Sprintf("Resumed module %s for database %s, processing its queue (%d notifications deferred)", moduleName, dbName, deferred),
+		Details: map[string]interface{}{
+			"deferred": deferred,
+		},
+	})
+}
+
+// LogSchemaDrift logs a difference between the schema a component
+// expects and the catalog of a database
+func (l *Logger) LogSchemaDrift(dbName, component, kind, object, detail string) {
+	message := fmt.Sprintf("Schema drift on %s: %s %s", dbName, kind, object)
+	if detail != "" {
+		message += ": " + detail
+	}
+	l.Log(LevelWarn, "schema", &LogEntry{
+		EventType:    EventSchemaDrift,
+		DatabaseName: dbName,
+		ModuleName:   component,
+		Message:      message,
+		Details: map[string]interface{}{
+			"kind":   kind,
+			"object": object,
+			"detail": detail,
+		},
+	})
+}
+
+// LogSchemaRepaired logs that schema drift of a database was repaired
+func (l *Logger) LogSchemaRepaired(dbName string, repaired, remaining int) {
+	l.Log(LevelInfo, "schema", &LogEntry{
+		EventType:    EventSchemaRepaired,
+		DatabaseName: dbName,
+		Message:      fmt.Sprintf("Repaired schema drift on %s: %d differences fixed, %d left", dbName, repaired, remaining),
+		Details: map[string]interface{}{
+			"repaired":  repaired,
+			"remaining": remaining,
+		},
+	})
+}
+
 // LogModuleError logs module errors
 func (l *Logger) LogModuleError(dbName, moduleName string, operation string, err error) {
 	l.Log(LevelError, "module", &LogEntry{
@@ -418,6 +615,18 @@ func (l *Logger) LogListenerStarted(dbName, channel string) {
 	})
 }
 
+// LogListenerStopped logs LISTEN stopped on a channel
+func (l *Logger) LogListenerStopped(dbName, channel string) {
+	l.Log(LevelInfo, "listener", &LogEntry{
+		EventType:    EventListenerStopped,
+		DatabaseName: dbName,
+		Message:      fmt.Sprintf("Stopped listening on channel %s", channel),
+		Details: map[string]interface{}{
+			"channel": channel,
+		},
+	})
+}
+
 // LogListenerError logs LISTEN connection errors
 func (l *Logger) LogListenerError(dbName, channel string, err error) {
 	l.Log(LevelError, "listener", &LogEntry{
@@ -431,6 +640,33 @@ func (l *Logger) LogListenerError(dbName, channel string, err error) {
 	})
 }
 
+// LogListenerReconnect logs a LISTEN connection reconnection attempt
+func (l *Logger) LogListenerReconnect(dbName, channel string, attempt int, delay time.Duration) {
+	l.Log(LevelInfo, "listener", &LogEntry{
+		EventType:    EventListenerReconnect,
+		DatabaseName: dbName,
+		Message:      fmt.Sprintf("Listener reconnection attempt %d on channel %s (delay: %v)", attempt, channel, delay),
+		Details: map[string]interface{}{
+			"channel": channel,
+			"attempt": attempt,
+			"delay":   delay.String(),
+		},
+	})
+}
+
+// LogListenerRecovered logs a LISTEN connection re-established after a failure
+func (l *Logger) LogListenerRecovered(dbName, channel string, attempts int) {
+	l.Log(LevelInfo, "listener", &LogEntry{
+		EventType:    EventListenerRecovered,
+		DatabaseName: dbName,
+		Message:      fmt.Sprintf("Listener on channel %s recovered after %d attempts", channel, attempts),
+		Details: map[string]interface{}{
+			"channel":  channel,
+			"attempts": attempts,
+		},
+	})
+}
+
 // LogHealthCheck logs successful health check
 func (l *Logger) LogHealthCheck(dbName string) {
 	l.Log(LevelDebug, "health", &LogEntry{
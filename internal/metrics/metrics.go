@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pgbridge"
+
+// Registry holds every pgbridge metric; it is served by Handler
+var Registry = prometheus.NewRegistry()
+
+// Module metrics
+var (
+	// NotificationsReceived counts notifications received by the listener
+	NotificationsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_received_total",
+		Help:      "Notifications received on the channel of a module.",
+	}, []string{"database", "module"})
+
+	// NotificationsProcessed counts notifications handled successfully
+	NotificationsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_processed_total",
+		Help:      "Notifications processed successfully by a module.",
+	}, []string{"database", "module"})
+
+	// NotificationsFailed counts notifications whose handler returned an error
+	NotificationsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_failed_total",
+		Help:      "Notifications a module failed to process.",
+	}, []string{"database", "module"})
+
+	// ProcessingDuration observes how long a module takes per notification
+	ProcessingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "notification_processing_seconds",
+		Help:      "Time spent processing a notification, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"database", "module"})
+
+	// QueueDepth is the number of unprocessed rows in a module's queue table
+	QueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Unprocessed rows in the queue table of a module, sampled periodically.",
+	}, []string{"database", "module"})
+)
+
+// Mail and notify metrics
+var (
+	// MailSent counts mails delivered to the SMTP server
+	MailSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_sent_total",
+		Help:      "Mails sent, by mail setting.",
+	}, []string{"database", "mail_setting_id"})
+
+	// MailFailed counts mails that could not be sent
+	MailFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_failed_total",
+		Help:      "Mails that failed to send, by mail setting.",
+	}, []string{"database", "mail_setting_id"})
+
+	// NotifyForwarded counts notifications forwarded to the central database
+	NotifyForwarded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notify_forwarded_total",
+		Help:      "Notifications forwarded to the central database.",
+	}, []string{"database"})
+
+	// NotifyFailed counts notifications that could not be forwarded
+	NotifyFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notify_failed_total",
+		Help:      "Notifications that failed to be forwarded.",
+	}, []string{"database"})
+)
+
+// Connection metrics
+var (
+	// DatabaseReconnects counts successful reconnections of a connection pool
+	DatabaseReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "database_reconnects_total",
+		Help:      "Times the connection pool of a database was re-established.",
+	}, []string{"database"})
+
+	// ListenerReconnects counts successful reconnections of a LISTEN connection
+	ListenerReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "listener_reconnects_total",
+		Help:      "Times the LISTEN connection of a database was re-established.",
+	}, []string{"database"})
+)
+
+func init() {
+	Registry.MustRegister(
+		NotificationsReceived,
+		NotificationsProcessed,
+		NotificationsFailed,
+		ProcessingDuration,
+		QueueDepth,
+		MailSent,
+		MailFailed,
+		NotifyForwarded,
+		NotifyFailed,
+		DatabaseReconnects,
+		ListenerReconnects,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Instrument wraps a notification handler to count processed and failed
+// notifications and observe their processing time
+func Instrument(database, module string, handler func(ctx context.Context, payload string) error) func(ctx context.Context, payload string) error {
+	processed := NotificationsProcessed.WithLabelValues(database, module)
+	failed := NotificationsFailed.WithLabelValues(database, module)
+	duration := ProcessingDuration.WithLabelValues(database, module)
+
+	return func(ctx context.Context, payload string) error {
+		start := time.Now()
+		err := handler(ctx, payload)
+		duration.Observe(time.Since(start).Seconds())
+
+		if err != nil {
+			failed.Inc()
+		} else {
+			processed.Inc()
+		}
+		return err
+	}
+}
+
+// ForgetModule removes the gauges of a module that stopped, so a stale
+// queue depth is not reported for it
+func ForgetModule(database, module string) {
+	QueueDepth.DeleteLabelValues(database, module)
+}
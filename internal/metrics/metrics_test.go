@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrument(t *testing.T) {
+	handler := Instrument("db_instrument", "pgb_test", func(ctx context.Context, payload string) error {
+		if payload == "bad" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	handler(context.Background(), "1")
+	handler(context.Background(), "2")
+	handler(context.Background(), "bad")
+
+	if got := testutil.ToFloat64(NotificationsProcessed.WithLabelValues("db_instrument", "pgb_test")); got != 2 {
+		t.Errorf("Expected 2 processed, got %v", got)
+	}
+	if got := testutil.ToFloat64(NotificationsFailed.WithLabelValues("db_instrument", "pgb_test")); got != 1 {
+		t.Errorf("Expected 1 failed, got %v", got)
+	}
+	if got := testutil.CollectAndCount(ProcessingDuration, "pgbridge_notification_processing_seconds"); got == 0 {
+		t.Error("Expected processing duration to be observed")
+	}
+}
+
+func TestQueueSampler(t *testing.T) {
+	depth := 0
+	sampler := NewQueueSampler("db_sampler", "pgb_test", func(ctx context.Context) (int, error) {
+		depth += 5
+		return depth, nil
+	}, time.Hour, nil)
+
+	if err := sampler.Sample(context.Background()); err != nil {
+		t.Fatalf("Sample failed: %v", err)
+	}
+	if got := testutil.ToFloat64(QueueDepth.WithLabelValues("db_sampler", "pgb_test")); got != 5 {
+		t.Errorf("Expected queue depth 5, got %v", got)
+	}
+
+	ForgetModule("db_sampler", "pgb_test")
+	if QueueDepth.DeleteLabelValues("db_sampler", "pgb_test") {
+		t.Error("Expected ForgetModule to remove the queue depth series")
+	}
+}
+
+func TestQueueSampler_KeepsLastValueOnError(t *testing.T) {
+	fail := false
+	sampler := NewQueueSampler("db_sampler_err", "pgb_test", func(ctx context.Context) (int, error) {
+		if fail {
+			return 0, errors.New("database unavailable")
+		}
+		return 3, nil
+	}, time.Hour, nil)
+
+	sampler.Sample(context.Background())
+	fail = true
+	if err := sampler.Sample(context.Background()); err == nil {
+		t.Error("Expected error from failing depth query")
+	}
+	if got := testutil.ToFloat64(QueueDepth.WithLabelValues("db_sampler_err", "pgb_test")); got != 3 {
+		t.Errorf("Expected last queue depth 3 to be kept, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	MailSent.WithLabelValues("db_handler", "1").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `pgbridge_mail_sent_total{database="db_handler",mail_setting_id="1"} 1`) {
+		t.Errorf("Expected mail counter in output, got:\n%s", rec.Body.String())
+	}
+}
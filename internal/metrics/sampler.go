@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"pgbridge/internal/logger"
+)
+
+// DepthFunc returns the number of unprocessed rows in a queue
+type DepthFunc func(ctx context.Context) (int, error)
+
+// sampleTimeout bounds a single depth query
+const sampleTimeout = 10 * time.Second
+
+// QueueSampler periodically records the depth of a module's queue
+type QueueSampler struct {
+	database string
+	module   string
+	depth    DepthFunc
+	interval time.Duration
+	gauge    prometheus.Gauge
+	logger   *logger.Logger
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewQueueSampler creates a sampler that queries the queue depth every
+// interval
+func NewQueueSampler(database, module string, depth DepthFunc, interval time.Duration, log *logger.Logger) *QueueSampler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &QueueSampler{
+		database: database,
+		module:   module,
+		depth:    depth,
+		interval: interval,
+		gauge:    QueueDepth.WithLabelValues(database, module),
+		logger:   log,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start samples once right away, then every interval
+func (s *QueueSampler) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// run samples on every tick until stopped
+func (s *QueueSampler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sample(s.ctx); err != nil && s.ctx.Err() == nil && s.logger != nil {
+			s.logger.LogSystemf(logger.LevelWarn, "metrics", "Queue depth of %s/%s unavailable: %v", s.database, s.module, err)
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample queries the queue depth once and records it
+func (s *QueueSampler) Sample(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, sampleTimeout)
+	defer cancel()
+
+	depth, err := s.depth(ctx)
+	if err != nil {
+		return err
+	}
+	s.gauge.Set(float64(depth))
+	return nil
+}
+
+// Stop stops sampling and waits for a running query to finish
+func (s *QueueSampler) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		s.wg.Wait()
+	})
+}
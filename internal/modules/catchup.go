@@ -0,0 +1,25 @@
+package modules
+
+import (
+	"context"
+
+	"pgbridge/internal/worker"
+)
+
+// CatchUp processes what accumulated in a module's queue, e.g. while its
+// notifications were missed, and returns how many items were handed to
+// its worker pool. Items of a QueuedModule go through the pool, so an
+// item that is also queued or in flight there is handled once; other
+// modules run ProcessQueue directly.
+func CatchUp(ctx context.Context, module Module, pool *worker.Pool) (int, error) {
+	queued, ok := module.(QueuedModule)
+	if !ok {
+		return 0, module.ProcessQueue(ctx)
+	}
+
+	payloads, err := queued.QueuedItems(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return pool.SubmitAll(ctx, payloads)
+}
@@ -0,0 +1,81 @@
+package modules
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"pgbridge/internal/worker"
+)
+
+// countingModule counts its ProcessQueue runs
+type countingModule struct {
+	testModule
+	processed int
+}
+
+func (m *countingModule) ProcessQueue(ctx context.Context) error {
+	m.processed++
+	return nil
+}
+
+// queuedModule lists a fixed queue
+type queuedModule struct {
+	countingModule
+	items []string
+}
+
+func (m *queuedModule) QueuedItems(ctx context.Context) ([]string, error) {
+	return m.items, nil
+}
+
+func TestCatchUp_SubmitsThroughPool(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	handled := map[string]int{}
+	pool := worker.NewPool("test", worker.Config{Workers: 1, Dedup: true, DedupKey: DedupKey}, func(ctx context.Context, payload string) error {
+		if payload == `{"id": 1}` {
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		handled[payload]++
+		mu.Unlock()
+		return nil
+	}, nil)
+	pool.Start()
+
+	// Item 1 is in flight through a notification
+	pool.Submit(context.Background(), worker.Job{Payload: `{"id": 1}`})
+	<-started
+
+	module := &queuedModule{items: []string{"1", "2", "3"}}
+	submitted, err := CatchUp(context.Background(), module, pool)
+	if err != nil {
+		t.Fatalf("CatchUp failed: %v", err)
+	}
+	close(release)
+	pool.Stop()
+
+	if submitted != 2 {
+		t.Errorf("Expected the items not in flight to be submitted, got %d", submitted)
+	}
+	if module.processed != 0 {
+		t.Errorf("Expected ProcessQueue not to run, got %d runs", module.processed)
+	}
+	if handled["1"]+handled[`{"id": 1}`] != 1 || handled["2"] != 1 || handled["3"] != 1 {
+		t.Errorf("Expected every item to be handled once, got %v", handled)
+	}
+}
+
+func TestCatchUp_ProcessQueue(t *testing.T) {
+	pool := worker.NewPool("test", worker.Config{}, func(ctx context.Context, payload string) error { return nil }, nil)
+	defer pool.Stop()
+
+	module := &countingModule{}
+	submitted, err := CatchUp(context.Background(), module, pool)
+	if err != nil || submitted != 0 || module.processed != 1 {
+		t.Errorf("Expected ProcessQueue to run directly, got %d runs and %d submitted (%v)", module.processed, submitted, err)
+	}
+}
@@ -0,0 +1,206 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/database"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/modules"
+)
+
+const (
+	moduleName  = "pgb_config"
+	channelName = "pgb_config"
+
+	// DefaultDebounce is how long the module waits after the last change
+	// notification before reloading, so a batch of edits causes one reload
+	DefaultDebounce = 2 * time.Second
+)
+
+const (
+	// Trigger function notifying the control channel with the operation
+	// and table that changed
+	createNotifyFunctionSQL = `
+		CREATE OR REPLACE FUNCTION public.trg_pgb_config_notify()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			PERFORM pg_notify('pgb_config', TG_OP || ' ' || TG_TABLE_NAME);
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;`
+
+	// Any change to sw_pgb can enable, disable or reconfigure services
+	dropPgbTriggerSQL   = `DROP TRIGGER IF EXISTS S01_pgb_config_notify ON public.sw_pgb;`
+	createPgbTriggerSQL = `
+		CREATE TRIGGER S01_pgb_config_notify
+		AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON public.sw_pgb
+		FOR EACH STATEMENT
+		EXECUTE FUNCTION public.trg_pgb_config_notify();`
+
+	// Updating or deleting an instance changes the name or connection
+	// string of its database
+	dropInstanceTriggerSQL   = `DROP TRIGGER IF EXISTS S02_pgb_config_notify ON public.sw_instance;`
+	createInstanceTriggerSQL = `
+		CREATE TRIGGER S02_pgb_config_notify
+		AFTER UPDATE OR DELETE ON public.sw_instance
+		FOR EACH STATEMENT
+		EXECUTE FUNCTION public.trg_pgb_config_notify();`
+)
+
+// schemaObjects are the objects installed by Initialize on the central
+// database, all of them replaced every time
+var schemaObjects = []database.SchemaObject{
+	{Kind: database.ObjectFunction, Schema: "public", Name: "trg_pgb_config_notify", Replaced: true},
+	{Kind: database.ObjectTrigger, Schema: "public", Table: "sw_pgb", Name: "S01_pgb_config_notify", Replaced: true},
+	{Kind: database.ObjectTrigger, Schema: "public", Table: "sw_instance", Name: "S02_pgb_config_notify", Replaced: true},
+}
+
+// ControlModule watches the central configuration tables and calls back
+// when they change. It runs on the central database: Initialize installs
+// the triggers that NOTIFY the control channel.
+type ControlModule struct {
+	debounce time.Duration
+	onChange func()
+	logger   *logger.Logger
+
+	timer   *time.Timer
+	stopped bool
+	running sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// NewControlModule creates a new control module; onChange is called once
+// the configuration has stopped changing for the debounce period
+func NewControlModule(debounce time.Duration, onChange func(), log *logger.Logger) *ControlModule {
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+
+	return &ControlModule{
+		debounce: debounce,
+		onChange: onChange,
+		logger:   log,
+	}
+}
+
+// Name returns the module name
+func (c *ControlModule) Name() string {
+	return moduleName
+}
+
+// GetChannelName returns the channel name to listen on
+func (c *ControlModule) GetChannelName() string {
+	return channelName
+}
+
+// Initialize installs the change triggers on the central configuration tables
+func (c *ControlModule) Initialize(ctx context.Context, pool *pgxpool.Pool) error {
+	if c.logger != nil {
+		c.logger.LogSystemf(logger.LevelInfo, moduleName, "Initializing %s module", moduleName)
+	}
+
+	statements := []string{
+		createNotifyFunctionSQL,
+		dropPgbTriggerSQL,
+		createPgbTriggerSQL,
+		dropInstanceTriggerSQL,
+		createInstanceTriggerSQL,
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, stmt := range statements {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to install configuration trigger: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit configuration trigger: %w", err)
+	}
+
+	if c.logger != nil {
+		c.logger.LogSystemf(logger.LevelInfo, moduleName, "Module %s initialized successfully", moduleName)
+	}
+
+	return nil
+}
+
+// Plan reports the triggers Initialize installs; the module has no queue
+func (c *ControlModule) Plan(ctx context.Context) (*modules.Plan, error) {
+	return &modules.Plan{Objects: schemaObjects}, nil
+}
+
+// Start begins the module's operation
+func (c *ControlModule) Start(ctx context.Context) error {
+	// Reloads are scheduled by notifications
+	return nil
+}
+
+// Stop cancels a pending reload and waits for a running one to finish
+func (c *ControlModule) Stop() error {
+	c.mu.Lock()
+	c.stopped = true
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.mu.Unlock()
+
+	c.running.Wait()
+	return nil
+}
+
+// ProcessNotification schedules a reload for a configuration change
+// The raw payload names the operation and table, e.g. 'UPDATE sw_pgb'
+func (c *ControlModule) ProcessNotification(ctx context.Context, n modules.Notification) error {
+	if c.logger != nil {
+		c.logger.LogSystemf(logger.LevelInfo, moduleName, "Configuration changed: %s", n.Raw)
+	}
+
+	c.schedule()
+	return nil
+}
+
+// ProcessQueue schedules a reload to pick up changes made while the
+// control channel was not being listened on
+func (c *ControlModule) ProcessQueue(ctx context.Context) error {
+	c.schedule()
+	return nil
+}
+
+// schedule (re)starts the debounce timer
+func (c *ControlModule) schedule() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return
+	}
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(c.debounce, c.fire)
+}
+
+// fire runs the change callback unless the module was stopped meanwhile
+func (c *ControlModule) fire() {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.running.Add(1)
+	c.mu.Unlock()
+
+	defer c.running.Done()
+	c.onChange()
+}
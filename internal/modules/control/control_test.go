@@ -0,0 +1,95 @@
+package control
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pgbridge/internal/modules"
+)
+
+func TestControlModule_Name(t *testing.T) {
+	module := NewControlModule(0, func() {}, nil)
+	if module.Name() != "pgb_config" {
+		t.Errorf("Expected name 'pgb_config', got '%s'", module.Name())
+	}
+	if module.GetChannelName() != "pgb_config" {
+		t.Errorf("Expected channel 'pgb_config', got '%s'", module.GetChannelName())
+	}
+	if module.debounce != DefaultDebounce {
+		t.Errorf("Expected default debounce %v, got %v", DefaultDebounce, module.debounce)
+	}
+}
+
+func TestControlModule_DebouncesNotifications(t *testing.T) {
+	var calls atomic.Int32
+	module := NewControlModule(50*time.Millisecond, func() { calls.Add(1) }, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		module.ProcessNotification(ctx, modules.Notification{Raw: "UPDATE sw_pgb"})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected 1 reload for a burst of changes, got %d", got)
+	}
+
+	module.ProcessQueue(ctx)
+	time.Sleep(150 * time.Millisecond)
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected ProcessQueue to schedule a reload, got %d reloads", got)
+	}
+}
+
+func TestControlModule_StopCancelsPendingReload(t *testing.T) {
+	var calls atomic.Int32
+	module := NewControlModule(50*time.Millisecond, func() { calls.Add(1) }, nil)
+	ctx := context.Background()
+
+	module.ProcessNotification(ctx, modules.Notification{Raw: "INSERT sw_pgb"})
+	module.Stop()
+	module.ProcessNotification(ctx, modules.Notification{Raw: "INSERT sw_pgb"})
+
+	time.Sleep(150 * time.Millisecond)
+	if got := calls.Load(); got != 0 {
+		t.Errorf("Expected no reload after Stop, got %d", got)
+	}
+}
+
+func TestControlModule_StopWaitsForRunningReload(t *testing.T) {
+	started := make(chan struct{})
+	var finished atomic.Bool
+	module := NewControlModule(10*time.Millisecond, func() {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+	}, nil)
+
+	module.ProcessNotification(context.Background(), modules.Notification{Raw: "DELETE sw_pgb"})
+	<-started
+	module.Stop()
+
+	if !finished.Load() {
+		t.Error("Expected Stop to wait for the running reload")
+	}
+}
+
+func TestControlModule_Plan(t *testing.T) {
+	module := NewControlModule(0, func() {}, nil)
+
+	plan, err := module.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(plan.Objects) != 3 || len(plan.Queued) != 0 {
+		t.Errorf("Expected the function and two triggers and no queue, got %+v", plan)
+	}
+	for _, object := range plan.Objects {
+		if !object.Replaced {
+			t.Errorf("Expected %s to be replaced on every initialization", object)
+		}
+	}
+}
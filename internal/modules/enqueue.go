@@ -0,0 +1,136 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Enqueuer is implemented by queues that accept new items from outside the
+// database, e.g. over the HTTP API
+type Enqueuer interface {
+	// Enqueue validates a JSON request and inserts it into the queue
+	// table, where the usual NOTIFY hands it to the listener. It returns
+	// the id of the new item, or a *ValidationError for invalid requests.
+	Enqueue(ctx context.Context, request []byte) (int, error)
+}
+
+// ValidationError lists why a request does not satisfy the constraints of
+// a queue table
+type ValidationError struct {
+	Problems []string
+}
+
+// Error joins the problems
+func (e *ValidationError) Error() string {
+	return "invalid request: " + strings.Join(e.Problems, "; ")
+}
+
+// Validator collects the problems of a request
+type Validator struct {
+	problems []string
+}
+
+// Addf records a problem
+func (v *Validator) Addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// Required checks that a field is set
+func (v *Validator) Required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.Addf("%s is required", field)
+	}
+}
+
+// MaxLength checks the length of a VARCHAR(n) field, counted in characters
+// as PostgreSQL does
+func (v *Validator) MaxLength(field, value string, n int) {
+	if utf8.RuneCountInString(value) > n {
+		v.Addf("%s must be at most %d characters", field, n)
+	}
+}
+
+// SingleLine checks that a field has no line breaks, e.g. a mail header
+func (v *Validator) SingleLine(field, value string) {
+	if strings.ContainsAny(value, "\r\n") {
+		v.Addf("%s must not contain line breaks", field)
+	}
+}
+
+// Address checks that a field is a single mail address and replaces it
+// with the bare address, its domain in lower case: display names and
+// comments are dropped, so addresses can be stored as comma-separated
+// lists. Anything after the address, e.g. a second one, is rejected.
+func (v *Validator) Address(field string, value *string) {
+	if *value == "" {
+		return
+	}
+
+	addr, err := mail.ParseAddress(*value)
+	if err != nil {
+		v.Addf("%s: invalid address '%s'", field, *value)
+		return
+	}
+	// A quoted local part may hold a comma
+	if strings.Contains(addr.Address, ",") {
+		v.Addf("%s: address '%s' must not contain a comma", field, *value)
+		return
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	*value = addr.Address[:at] + strings.ToLower(addr.Address[at:])
+}
+
+// Addresses checks a list of mail addresses, replacing each with the bare
+// address as Address does
+func (v *Validator) Addresses(field string, values []string) {
+	for i := range values {
+		v.Address(field, &values[i])
+	}
+}
+
+// Err returns the collected problems as a *ValidationError, or nil
+func (v *Validator) Err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// DecodeRequest decodes a JSON request into v, rejecting unknown fields
+// and trailing data
+func DecodeRequest(request []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(request))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return &ValidationError{Problems: []string{fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	if decoder.More() {
+		return &ValidationError{Problems: []string{"invalid JSON: unexpected data after the object"}}
+	}
+	return nil
+}
+
+// ConstraintError turns a constraint violation reported by PostgreSQL
+// into a *ValidationError; other errors are returned as they are
+func ConstraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	// Integrity constraint violations and data exceptions (class 23, 22)
+	if strings.HasPrefix(pgErr.Code, "23") || strings.HasPrefix(pgErr.Code, "22") {
+		return &ValidationError{Problems: []string{pgErr.Message}}
+	}
+	return err
+}
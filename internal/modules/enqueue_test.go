@@ -0,0 +1,97 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestValidator(t *testing.T) {
+	var v Validator
+	if v.Err() != nil {
+		t.Fatal("Expected no error without problems")
+	}
+
+	v.Required("from", " ")
+	v.MaxLength("subject", "äöü", 3)
+	v.MaxLength("subject", "äöüß", 3)
+	v.SingleLine("subject", "Hello\r\nBcc: x@example.com")
+	empty, from := "", "Jane <jane@example.com>"
+	v.Address("from", &empty)
+	v.Address("from", &from)
+	v.Addresses("to", []string{"a@example.com", "not an address"})
+
+	var invalid *ValidationError
+	if !errors.As(v.Err(), &invalid) {
+		t.Fatalf("Expected a ValidationError, got %v", v.Err())
+	}
+
+	expected := []string{
+		"from is required",
+		"subject must be at most 3 characters",
+		"subject must not contain line breaks",
+		"to: invalid address 'not an address'",
+	}
+	if !reflect.DeepEqual(invalid.Problems, expected) {
+		t.Errorf("Expected %q, got %q", expected, invalid.Problems)
+	}
+}
+
+func TestValidator_Address(t *testing.T) {
+	var v Validator
+	addresses := []string{
+		"Jane <jane@Example.COM>",
+		`"Doe, Jane" <Jane.Doe@example.com>`,
+		"jane@example.com (Jane)",
+		"a@example.com, b@example.com",
+		"<jane@example.com> Bcc: x@example.com",
+		`"a,b"@example.com`,
+	}
+	v.Addresses("to", addresses)
+
+	expected := []string{"jane@example.com", "Jane.Doe@example.com", "jane@example.com"}
+	if !reflect.DeepEqual(addresses[:3], expected) {
+		t.Errorf("Expected the bare addresses %q, got %q", expected, addresses[:3])
+	}
+
+	var invalid *ValidationError
+	if !errors.As(v.Err(), &invalid) || len(invalid.Problems) != 3 {
+		t.Fatalf("Expected the last three addresses to be rejected, got %v", v.Err())
+	}
+	if addresses[3] != "a@example.com, b@example.com" {
+		t.Errorf("Expected a rejected address to be kept, got %q", addresses[3])
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	var r struct {
+		Name string `json:"name"`
+	}
+
+	if err := DecodeRequest([]byte(`{"name": "x"}`), &r); err != nil || r.Name != "x" {
+		t.Errorf("Unexpected result %q, %v", r.Name, err)
+	}
+
+	for _, request := range []string{`{"nmae": "x"}`, `{"name": 1}`, `{"name": "x"} {}`, ``} {
+		var invalid *ValidationError
+		if err := DecodeRequest([]byte(request), &r); !errors.As(err, &invalid) {
+			t.Errorf("%q: expected a ValidationError, got %v", request, err)
+		}
+	}
+}
+
+func TestConstraintError(t *testing.T) {
+	check := fmt.Errorf("failed to insert: %w", &pgconn.PgError{Code: "23514", Message: "violates check constraint"})
+	var invalid *ValidationError
+	if !errors.As(ConstraintError(check), &invalid) || invalid.Problems[0] != "violates check constraint" {
+		t.Errorf("Expected a ValidationError, got %v", ConstraintError(check))
+	}
+
+	other := fmt.Errorf("failed to insert: %w", &pgconn.PgError{Code: "42P01", Message: "relation does not exist"})
+	if ConstraintError(other) != other {
+		t.Error("Expected other errors to be returned unchanged")
+	}
+}
@@ -0,0 +1,105 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"pgbridge/internal/modules"
+)
+
+// MailRequest is a mail enqueued over the HTTP API
+type MailRequest struct {
+	MailSettingID int      `json:"mail_setting_id"`
+	From          string   `json:"from"`
+	To            []string `json:"to"`
+	CC            []string `json:"cc"`
+	BCC           []string `json:"bcc"`
+	Subject       string   `json:"subject"`
+	Body          string   `json:"body"`
+}
+
+// Validate checks the request against the constraints of pgb.pgb_mail
+// Addresses are parsed so that nothing can be injected into the headers,
+// and reduced to the bare address, which is what is stored.
+func (r *MailRequest) Validate() error {
+	var v modules.Validator
+
+	if r.MailSettingID <= 0 {
+		v.Addf("mail_setting_id is required")
+	}
+
+	v.Required("from", r.From)
+	v.Address("from", &r.From)
+	v.MaxLength("from", r.From, 255)
+
+	if len(r.To) == 0 {
+		v.Addf("to needs at least one recipient")
+	}
+	v.Addresses("to", r.To)
+	v.Addresses("cc", r.CC)
+	v.Addresses("bcc", r.BCC)
+
+	v.Required("subject", r.Subject)
+	v.MaxLength("subject", r.Subject, 998)
+	v.SingleLine("subject", r.Subject)
+
+	return v.Err()
+}
+
+// Enqueue inserts a mail and notifies the mail channel in the same
+// transaction, as an application would
+func (m *MailModule) Enqueue(ctx context.Context, request []byte) (int, error) {
+	var r MailRequest
+	if err := modules.DecodeRequest(request, &r); err != nil {
+		return 0, err
+	}
+	if err := r.Validate(); err != nil {
+		return 0, err
+	}
+
+	tx, err := m.pool.Load().Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pgb.pgb_mail_settings WHERE id = $1)`, r.MailSettingID).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("failed to check mail settings: %w", err)
+	}
+	if !exists {
+		return 0, &modules.ValidationError{Problems: []string{fmt.Sprintf("mail_setting_id %d does not exist", r.MailSettingID)}}
+	}
+
+	query := `
+		INSERT INTO pgb.pgb_mail (
+			mail_setting_id, header_from, header_to, header_cc, header_bcc, subject, body_text
+		) VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+		RETURNING id
+	`
+
+	var id int
+	err = tx.QueryRow(ctx, query,
+		r.MailSettingID,
+		r.From,
+		strings.Join(r.To, ", "),
+		strings.Join(r.CC, ", "),
+		strings.Join(r.BCC, ", "),
+		r.Subject,
+		r.Body,
+	).Scan(&id)
+	if err != nil {
+		return 0, modules.ConstraintError(fmt.Errorf("failed to insert mail: %w", err))
+	}
+
+	if err := modules.Renotify(ctx, tx, channelName, []int{id}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit mail: %w", err)
+	}
+
+	return id, nil
+}
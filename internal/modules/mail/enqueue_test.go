@@ -0,0 +1,107 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pgbridge/internal/modules"
+)
+
+func TestMailRequest_Validate(t *testing.T) {
+	valid := MailRequest{
+		MailSettingID: 1,
+		From:          "App <app@example.com>",
+		To:            []string{"a@example.com", `"Doe, Jane" <jane@example.com>`},
+		Subject:       "Hello",
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected a valid request, got %v", err)
+	}
+	// Display names are dropped, so the joined list splits again
+	if valid.From != "app@example.com" || strings.Join(valid.To, ", ") != "a@example.com, jane@example.com" {
+		t.Errorf("Expected the bare addresses, got %q and %q", valid.From, valid.To)
+	}
+
+	invalid := []MailRequest{
+		{From: "app@example.com", To: []string{"a@example.com"}, Subject: "Hello"},
+		{MailSettingID: 1, To: []string{"a@example.com"}, Subject: "Hello"},
+		{MailSettingID: 1, From: "app@example.com", Subject: "Hello"},
+		{MailSettingID: 1, From: "app@example.com", To: []string{"a@example.com"}},
+		{MailSettingID: 1, From: "app@example.com", To: []string{"a@example.com"}, Subject: "Hi\nBcc: x@example.com"},
+		{MailSettingID: 1, From: "app@example.com", To: []string{"a@example.com"}, CC: []string{"nope"}, Subject: "Hello"},
+	}
+	for i, r := range invalid {
+		var verr *modules.ValidationError
+		if err := r.Validate(); !errors.As(err, &verr) {
+			t.Errorf("case %d: expected a ValidationError, got %v", i, err)
+		}
+	}
+}
+
+func TestMailModule_Enqueue(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+
+	cleanupTables(t, pool)
+	defer cleanupTables(t, pool)
+
+	module := NewMailModule(pool, "test_db", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := initialize(ctx, module, pool); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var settingID int
+	pool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_mail_settings (smtp_server, smtp_port)
+		VALUES ('smtp.example.com', 587) RETURNING id
+	`).Scan(&settingID)
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire connection: %v", err)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "LISTEN "+channelName); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	id, err := module.Enqueue(ctx, []byte(`{
+		"mail_setting_id": `+strconv.Itoa(settingID)+`,
+		"from": "app@example.com",
+		"to": ["a@example.com", "b@example.com"],
+		"subject": "Hello",
+		"body": "Body"
+	}`))
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	notification, err := conn.Conn().WaitForNotification(ctx)
+	if err != nil {
+		t.Fatalf("Expected a notification: %v", err)
+	}
+	if notification.Payload != strconv.Itoa(id) {
+		t.Errorf("Expected payload %d, got %s", id, notification.Payload)
+	}
+
+	var to string
+	var cc *string
+	pool.QueryRow(ctx, "SELECT header_to, header_cc FROM pgb.pgb_mail WHERE id = $1", id).Scan(&to, &cc)
+	if to != "a@example.com, b@example.com" || cc != nil {
+		t.Errorf("Unexpected recipients %q, %v", to, cc)
+	}
+
+	// An unknown mail setting is a validation error
+	_, err = module.Enqueue(ctx, []byte(`{"mail_setting_id": 999999, "from": "app@example.com", "to": ["a@example.com"], "subject": "Hello"}`))
+	var verr *modules.ValidationError
+	if !errors.As(err, &verr) {
+		t.Errorf("Expected a ValidationError, got %v", err)
+	}
+}
@@ -3,14 +3,22 @@ package mail
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/smtp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
 	"pgbridge/internal/logger"
+	"pgbridge/internal/metrics"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/tracing"
 )
 
 const (
@@ -18,11 +26,16 @@ const (
 	channelName  = "pgb_mail"
 	maxRetries   = 3
 	retryDelay   = 5 * time.Second
+	// claimTimeout outlasts sending with all retries; a claim older than
+	// that was left by a worker that stopped
+	claimTimeout = 15 * time.Minute
+	// recordTimeout bounds recording the outcome of a send
+	recordTimeout = 10 * time.Second
 )
 
 // MailModule handles asynchronous email sending from PostgreSQL
 type MailModule struct {
-	pool     *pgxpool.Pool
+	pool     atomic.Pointer[pgxpool.Pool]
 	dbName   string
 	logger   *logger.Logger
 	mu       sync.RWMutex
@@ -55,16 +68,33 @@ type MailMessage struct {
 	IsSent        bool
 	SentTS        *time.Time
 	ErrorMessage  string
+	CancelledTS   *time.Time
+}
+
+func init() {
+	modules.Register(moduleName, func(ctx context.Context, mc modules.Context) (modules.Module, error) {
+		return NewMailModule(mc.Pool, mc.DatabaseName, mc.Logger), nil
+	})
+	modules.RegisterQueue(moduleName, func(pool *pgxpool.Pool, dbName string) modules.Queue {
+		return NewMailModule(pool, dbName, nil)
+	})
+	modules.RegisterMigrations(moduleName, migrations)
 }
 
 // NewMailModule creates a new mail module instance
 func NewMailModule(pool *pgxpool.Pool, dbName string, log *logger.Logger) *MailModule {
-	return &MailModule{
-		pool:     pool,
+	m := &MailModule{
 		dbName:   dbName,
 		logger:   log,
 		shutdown: make(chan struct{}),
 	}
+	m.pool.Store(pool)
+	return m
+}
+
+// SetPool replaces the pool after the connection manager reconnected
+func (m *MailModule) SetPool(pool *pgxpool.Pool) {
+	m.pool.Store(pool)
 }
 
 // Name returns the module name
@@ -140,7 +170,7 @@ func (m *MailModule) createMailSettingsTable(ctx context.Context) error {
 		COMMENT ON COLUMN pgb.pgb_mail_settings.smtp_token IS 'API token for token-based authentication';
 	`
 
-	_, err := m.pool.Exec(ctx, query)
+	_, err := m.pool.Load().Exec(ctx, query)
 	return err
 }
 
@@ -177,7 +207,7 @@ func (m *MailModule) createMailTable(ctx context.Context) error {
 		COMMENT ON COLUMN pgb.pgb_mail.retry_count IS 'Number of send attempts';
 	`
 
-	_, err := m.pool.Exec(ctx, query)
+	_, err := m.pool.Load().Exec(ctx, query)
 	return err
 }
 
@@ -193,7 +223,7 @@ func (m *MailModule) createIndexes(ctx context.Context) error {
 	}
 
 	for _, index := range indexes {
-		if _, err := m.pool.Exec(ctx, index); err != nil {
+		if _, err := m.pool.Load().Exec(ctx, index); err != nil {
 			return err
 		}
 	}
@@ -214,30 +244,71 @@ func (m *MailModule) Stop() error {
 }
 
 // ProcessNotification handles incoming NOTIFY messages with mail IDs
-func (m *MailModule) ProcessNotification(ctx context.Context, payload string) error {
-	// Parse the payload as a mail ID
-	var mailID int
-	if _, err := fmt.Sscanf(payload, "%d", &mailID); err != nil {
-		return fmt.Errorf("invalid mail ID in payload '%s': %w", payload, err)
+// Insert and update send the mail, retry clears a previous failure first
+// and cancel marks an unsent mail so it is never sent.
+func (m *MailModule) ProcessNotification(ctx context.Context, n modules.Notification) error {
+	switch n.Op {
+	case modules.OpCancel:
+		return m.cancelMail(ctx, n.ID)
+	case modules.OpRetry:
+		if err := m.resetMail(ctx, n.ID); err != nil {
+			return err
+		}
 	}
 
-	// Send the mail
-	return m.sendMail(ctx, mailID)
+	return m.sendMail(ctx, n.ID)
+}
+
+// OrderingKey returns the recipient list of a mail, so that mails to the
+// same recipients are sent in order when per-key ordering is enabled
+func (m *MailModule) OrderingKey(ctx context.Context, payload string) (string, error) {
+	n, err := modules.ParseNotification(payload)
+	if err != nil {
+		return "", err
+	}
+
+	var headerTo string
+	err = m.pool.Load().QueryRow(ctx, `SELECT header_to FROM pgb.pgb_mail WHERE id = $1`, n.ID).Scan(&headerTo)
+	if err != nil {
+		return "", fmt.Errorf("failed to query mail recipient: %w", err)
+	}
+
+	return headerTo, nil
 }
 
 // ProcessQueue processes unsent emails from the queue (called at startup)
 func (m *MailModule) ProcessQueue(ctx context.Context) error {
+	mailIDs, err := m.queuedMailIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Process each unsent mail
+	for _, mailID := range mailIDs {
+		if err := m.sendMail(ctx, mailID); err != nil {
+			// Log error but continue processing other mails
+			// The error is already recorded in the database by sendMail
+			continue
+		}
+	}
+
+	return nil
+}
+
+// queuedMailIDs returns the unsent mails ProcessQueue sends, oldest first
+func (m *MailModule) queuedMailIDs(ctx context.Context) ([]int, error) {
 	// Find all unsent emails
 	query := `
 		SELECT id FROM pgb.pgb_mail
 		WHERE is_sent = false
+		AND cancelled_ts IS NULL
 		AND retry_count < $1
 		ORDER BY created_at ASC
 	`
 
-	rows, err := m.pool.Query(ctx, query, maxRetries)
+	rows, err := m.pool.Load().Query(ctx, query, maxRetries)
 	if err != nil {
-		return fmt.Errorf("failed to query unsent mails: %w", err)
+		return nil, fmt.Errorf("failed to query unsent mails: %w", err)
 	}
 	defer rows.Close()
 
@@ -245,44 +316,137 @@ func (m *MailModule) ProcessQueue(ctx context.Context) error {
 	for rows.Next() {
 		var id int
 		if err := rows.Scan(&id); err != nil {
-			return fmt.Errorf("failed to scan mail ID: %w", err)
+			return nil, fmt.Errorf("failed to scan mail ID: %w", err)
 		}
 		mailIDs = append(mailIDs, id)
 	}
 
 	if err := rows.Err(); err != nil {
-		return fmt.Errorf("error iterating mail rows: %w", err)
+		return nil, fmt.Errorf("error iterating mail rows: %w", err)
 	}
 
-	// Process each unsent mail
-	for _, mailID := range mailIDs {
-		if err := m.sendMail(ctx, mailID); err != nil {
-			// Log error but continue processing other mails
-			// The error is already recorded in the database by sendMail
-			continue
+	return mailIDs, nil
+}
+
+// QueuedItems returns the payloads of the mails ProcessQueue would send,
+// so they can be handed to the worker pool instead
+func (m *MailModule) QueuedItems(ctx context.Context) ([]string, error) {
+	mailIDs, err := m.queuedMailIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make([]string, 0, len(mailIDs))
+	for _, id := range mailIDs {
+		payloads = append(payloads, strconv.Itoa(id))
+	}
+	return payloads, nil
+}
+
+// PendingItems returns the IDs of unsent mails created more than olderThan
+// ago that were never attempted; failed mails carry an error message and
+// are left to ProcessQueue at startup
+func (m *MailModule) PendingItems(ctx context.Context, olderThan time.Duration) ([]string, error) {
+	query := `
+		SELECT id FROM pgb.pgb_mail
+		WHERE is_sent = false
+		AND cancelled_ts IS NULL
+		AND retry_count < $1
+		AND error_message IS NULL
+		AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $2)
+		ORDER BY created_at ASC
+	`
+
+	rows, err := m.pool.Load().Query(ctx, query, maxRetries, olderThan.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending mails: %w", err)
+	}
+	defer rows.Close()
+
+	var payloads []string
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan mail ID: %w", err)
 		}
+		payloads = append(payloads, strconv.Itoa(id))
 	}
 
-	return nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating mail rows: %w", err)
+	}
+
+	return payloads, nil
 }
 
-// sendMail retrieves a mail message and sends it
+// QueueDepth returns the number of unsent mails that were not cancelled
+func (m *MailModule) QueueDepth(ctx context.Context) (int, error) {
+	var depth int
+	err := m.pool.Load().QueryRow(ctx, `
+		SELECT COUNT(*) FROM pgb.pgb_mail
+		WHERE is_sent = false
+		AND cancelled_ts IS NULL
+	`).Scan(&depth)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unsent mails: %w", err)
+	}
+
+	return depth, nil
+}
+
+// sendMail claims a mail, sends it and records the outcome. The claim is
+// committed before the SMTP conversation, so no row lock or transaction is
+// held while sending, and a mail that another worker or instance is sending
+// is skipped instead of sent twice.
 func (m *MailModule) sendMail(ctx context.Context, mailID int) error {
-	// Retrieve mail message
-	mail, err := m.getMailMessage(ctx, mailID)
+	mail, err := m.claimMail(ctx, mailID)
 	if err != nil {
-		mailErr := fmt.Errorf("failed to retrieve mail %d: %w", mailID, err)
+		mailErr := fmt.Errorf("failed to claim mail %d: %w", mailID, err)
+		metrics.MailFailed.WithLabelValues(m.dbName, "unknown").Inc()
 		if m.logger != nil {
 			m.logger.LogMailFailed(m.dbName, mailID, mailErr)
 		}
 		return mailErr
 	}
 
+	// Not claimed: sent, cancelled or being sent
+	if mail == nil {
+		mail, err = m.getMailMessage(ctx, mailID)
+		if err != nil {
+			mailErr := fmt.Errorf("failed to retrieve mail %d: %w", mailID, err)
+			metrics.MailFailed.WithLabelValues(m.dbName, "unknown").Inc()
+			if m.logger != nil {
+				m.logger.LogMailFailed(m.dbName, mailID, mailErr)
+			}
+			return mailErr
+		}
+
+		switch {
+		case mail.IsSent:
+		case mail.CancelledTS != nil:
+			// Cancelled mails are never sent
+			if m.logger != nil {
+				m.logger.LogSystemf(logger.LevelInfo, "mail", "Skipping cancelled mail_id=%d", mailID)
+			}
+		default:
+			// e.g. by both the listener and the queue sweep
+			if m.logger != nil {
+				m.logger.LogSystemf(logger.LevelDebug, "mail", "Skipping mail_id=%d, it is being sent already", mailID)
+			}
+		}
+		return nil
+	}
+
+	settingLabel := strconv.Itoa(mail.MailSettingID)
+
 	// Retrieve mail settings
 	settings, err := m.getMailSettings(ctx, mail.MailSettingID)
 	if err != nil {
 		settingsErr := fmt.Errorf("failed to retrieve mail settings: %w", err)
-		m.recordError(ctx, mailID, fmt.Sprintf("Failed to retrieve mail settings: %v", err))
+		m.recordOutcome(ctx, func(ctx context.Context, q modules.Querier) error {
+			return m.recordError(ctx, q, mailID, fmt.Sprintf("Failed to retrieve mail settings: %v", err))
+		})
+		metrics.MailFailed.WithLabelValues(m.dbName, settingLabel).Inc()
 		if m.logger != nil {
 			m.logger.LogMailFailed(m.dbName, mailID, settingsErr)
 		}
@@ -298,6 +462,9 @@ func (m *MailModule) sendMail(ctx context.Context, mailID int) error {
 			}
 			select {
 			case <-ctx.Done():
+				m.recordOutcome(ctx, func(ctx context.Context, q modules.Querier) error {
+					return m.releaseMail(ctx, q, mailID)
+				})
 				return ctx.Err()
 			case <-time.After(retryDelay):
 			}
@@ -305,39 +472,103 @@ func (m *MailModule) sendMail(ctx context.Context, mailID int) error {
 
 		if err := m.sendSMTP(ctx, mail, settings); err != nil {
 			lastErr = err
-			m.incrementRetryCount(ctx, mailID)
+			m.recordOutcome(ctx, func(ctx context.Context, q modules.Querier) error {
+				return m.incrementRetryCount(ctx, q, mailID)
+			})
 			continue
 		}
 
 		// Success!
+		metrics.MailSent.WithLabelValues(m.dbName, settingLabel).Inc()
 		if m.logger != nil {
 			m.logger.LogMailSent(m.dbName, mailID, mail.HeaderTo)
 		}
-		return m.markAsSent(ctx, mailID)
+		return m.recordOutcome(ctx, func(ctx context.Context, q modules.Querier) error {
+			return m.markAsSent(ctx, q, mailID)
+		})
 	}
 
 	// All retries failed
 	errMsg := fmt.Sprintf("Failed after %d attempts: %v", maxRetries, lastErr)
-	m.recordError(ctx, mailID, errMsg)
+	m.recordOutcome(ctx, func(ctx context.Context, q modules.Querier) error {
+		return m.recordError(ctx, q, mailID, errMsg)
+	})
 	finalErr := fmt.Errorf("failed to send mail %d: %w", mailID, lastErr)
+	metrics.MailFailed.WithLabelValues(m.dbName, settingLabel).Inc()
 	if m.logger != nil {
 		m.logger.LogMailFailed(m.dbName, mailID, finalErr)
 	}
 	return finalErr
 }
 
+// recordOutcome records what came of a send attempt with its own deadline:
+// the job's context may have ended meanwhile, and an attempt that is not
+// recorded is repeated without end
+func (m *MailModule) recordOutcome(ctx context.Context, record func(ctx context.Context, q modules.Querier) error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+
+	if err := record(ctx, m.pool.Load()); err != nil {
+		if m.logger != nil {
+			m.logger.LogSystemf(logger.LevelError, "mail", "Failed to record the outcome of a send: %v", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// mailColumns are the columns scanned by queryMail
+const mailColumns = `
+		id, mail_setting_id, header_from, header_to,
+		COALESCE(header_cc, ''), COALESCE(header_bcc, ''),
+		subject, body_text, is_sent, sent_ts, COALESCE(error_message, ''),
+		cancelled_ts`
+
+// mailQuery selects a mail message by id
+const mailQuery = `SELECT` + mailColumns + `
+		FROM pgb.pgb_mail
+		WHERE id = $1`
+
+// claimMailQuery marks an unsent mail as being sent and returns it, unless
+// another claim younger than claimTimeout ($2 seconds) exists or another
+// transaction holds the row
+const claimMailQuery = `
+		UPDATE pgb.pgb_mail
+		SET claimed_ts = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM pgb.pgb_mail
+			WHERE id = $1
+			AND is_sent = false
+			AND cancelled_ts IS NULL
+			AND (claimed_ts IS NULL OR claimed_ts < CURRENT_TIMESTAMP - make_interval(secs => $2))
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING` + mailColumns
+
 // getMailMessage retrieves a mail message from the database
 func (m *MailModule) getMailMessage(ctx context.Context, mailID int) (*MailMessage, error) {
-	query := `
-		SELECT id, mail_setting_id, header_from, header_to,
-		       COALESCE(header_cc, ''), COALESCE(header_bcc, ''),
-		       subject, body_text, is_sent, sent_ts, COALESCE(error_message, '')
-		FROM pgb.pgb_mail
-		WHERE id = $1
-	`
+	return m.queryMail(ctx, m.pool.Load(), mailQuery, mailID)
+}
+
+// claimMail marks a mail as being sent and returns it. It returns nil
+// without an error if the mail is missing, sent, cancelled or claimed by
+// another worker or instance. Claims of workers that stopped while sending
+// expire after claimTimeout.
+func (m *MailModule) claimMail(ctx context.Context, mailID int) (*MailMessage, error) {
+	mail, err := m.queryMail(ctx, m.pool.Load(), claimMailQuery, mailID, claimTimeout.Seconds())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return mail, err
+}
+
+// queryMail runs a mail query and scans the message
+func (m *MailModule) queryMail(ctx context.Context, q modules.Querier, query string, mailID int, args ...interface{}) (*MailMessage, error) {
+	ctx, span := tracing.Start(ctx, "pgb_mail getMailMessage", tracing.Database(m.dbName), tracing.Module(moduleName), tracing.RowID(mailID))
+	defer span.End()
 
 	mail := &MailMessage{}
-	err := m.pool.QueryRow(ctx, query, mailID).Scan(
+	err := q.QueryRow(ctx, query, append([]interface{}{mailID}, args...)...).Scan(
 		&mail.ID,
 		&mail.MailSettingID,
 		&mail.HeaderFrom,
@@ -349,10 +580,11 @@ func (m *MailModule) getMailMessage(ctx context.Context, mailID int) (*MailMessa
 		&mail.IsSent,
 		&mail.SentTS,
 		&mail.ErrorMessage,
+		&mail.CancelledTS,
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to query mail: %w", err)
+		return nil, tracing.Fail(span, fmt.Errorf("failed to query mail: %w", err))
 	}
 
 	return mail, nil
@@ -360,6 +592,9 @@ func (m *MailModule) getMailMessage(ctx context.Context, mailID int) (*MailMessa
 
 // getMailSettings retrieves SMTP settings from the database
 func (m *MailModule) getMailSettings(ctx context.Context, settingID int) (*MailSettings, error) {
+	ctx, span := tracing.Start(ctx, "pgb_mail getMailSettings", tracing.Database(m.dbName), tracing.Module(moduleName), attribute.Int("pgbridge.mail_setting_id", settingID))
+	defer span.End()
+
 	query := `
 		SELECT id, smtp_server, smtp_port, is_tls, is_ssl,
 		       COALESCE(smtp_user, ''), COALESCE(smtp_password, ''), COALESCE(smtp_token, '')
@@ -368,7 +603,7 @@ func (m *MailModule) getMailSettings(ctx context.Context, settingID int) (*MailS
 	`
 
 	settings := &MailSettings{}
-	err := m.pool.QueryRow(ctx, query, settingID).Scan(
+	err := m.pool.Load().QueryRow(ctx, query, settingID).Scan(
 		&settings.ID,
 		&settings.SMTPServer,
 		&settings.SMTPPort,
@@ -380,14 +615,26 @@ func (m *MailModule) getMailSettings(ctx context.Context, settingID int) (*MailS
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to query mail settings: %w", err)
+		return nil, tracing.Fail(span, fmt.Errorf("failed to query mail settings: %w", err))
 	}
 
 	return settings, nil
 }
 
 // sendSMTP sends an email via SMTP
-func (m *MailModule) sendSMTP(ctx context.Context, mail *MailMessage, settings *MailSettings) error {
+func (m *MailModule) sendSMTP(ctx context.Context, mail *MailMessage, settings *MailSettings) (err error) {
+	_, span := tracing.Start(ctx, "pgb_mail SMTP send",
+		tracing.Database(m.dbName),
+		tracing.Module(moduleName),
+		tracing.RowID(mail.ID),
+		attribute.String("server.address", settings.SMTPServer),
+		attribute.Int("server.port", settings.SMTPPort),
+	)
+	defer func() {
+		tracing.Fail(span, err)
+		span.End()
+	}()
+
 	// Build the email message
 	message := m.buildMessage(mail)
 
@@ -567,17 +814,18 @@ func (m *MailModule) parseEmailList(emailList string) []string {
 }
 
 // markAsSent updates the mail record as successfully sent
-func (m *MailModule) markAsSent(ctx context.Context, mailID int) error {
+func (m *MailModule) markAsSent(ctx context.Context, q modules.Querier, mailID int) error {
 	query := `
 		UPDATE pgb.pgb_mail
 		SET is_sent = true,
 		    sent_ts = CURRENT_TIMESTAMP,
 		    error_message = NULL,
+		    claimed_ts = NULL,
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
 	`
 
-	_, err := m.pool.Exec(ctx, query, mailID)
+	_, err := q.Exec(ctx, query, mailID)
 	if err != nil {
 		return fmt.Errorf("failed to mark mail as sent: %w", err)
 	}
@@ -585,21 +833,106 @@ func (m *MailModule) markAsSent(ctx context.Context, mailID int) error {
 	return nil
 }
 
+// resetMail clears the failure state of an unsent mail so it is attempted
+// again with a full set of retries
+func (m *MailModule) resetMail(ctx context.Context, mailID int) error {
+	if _, err := m.resetMails(ctx, m.pool.Load(), []int{mailID}); err != nil {
+		return fmt.Errorf("failed to reset mail %d for retry: %w", mailID, err)
+	}
+
+	return nil
+}
+
+// resetMails clears the failure state of the unsent mails among ids and
+// returns the ids that were reset
+func (m *MailModule) resetMails(ctx context.Context, q modules.Querier, ids []int) ([]int, error) {
+	query := `
+		UPDATE pgb.pgb_mail
+		SET retry_count = 0,
+		    error_message = NULL,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($1)
+		AND is_sent = false
+		AND cancelled_ts IS NULL
+		RETURNING id
+	`
+
+	rows, err := q.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return modules.CollectIDs(rows)
+}
+
+// cancelMail marks an unsent mail as cancelled; mails already sent are
+// left untouched
+func (m *MailModule) cancelMail(ctx context.Context, mailID int) error {
+	cancelled, err := m.cancelMails(ctx, []int{mailID})
+	if err != nil {
+		return fmt.Errorf("failed to cancel mail %d: %w", mailID, err)
+	}
+
+	if m.logger != nil {
+		if len(cancelled) == 0 {
+			m.logger.LogSystemf(logger.LevelWarn, "mail", "Mail mail_id=%d not cancelled: already sent, cancelled or missing", mailID)
+		} else {
+			m.logger.LogSystemf(logger.LevelInfo, "mail", "Cancelled mail_id=%d", mailID)
+		}
+	}
+
+	return nil
+}
+
+// cancelMails marks the unsent mails among ids as cancelled and returns
+// the ids that were cancelled
+func (m *MailModule) cancelMails(ctx context.Context, ids []int) ([]int, error) {
+	query := `
+		UPDATE pgb.pgb_mail
+		SET cancelled_ts = CURRENT_TIMESTAMP,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($1)
+		AND is_sent = false
+		AND cancelled_ts IS NULL
+		RETURNING id
+	`
+
+	rows, err := m.pool.Load().Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return modules.CollectIDs(rows)
+}
+
 // recordError records an error message for a mail
-func (m *MailModule) recordError(ctx context.Context, mailID int, errorMsg string) error {
+func (m *MailModule) recordError(ctx context.Context, q modules.Querier, mailID int, errorMsg string) error {
 	query := `
 		UPDATE pgb.pgb_mail
 		SET error_message = $2,
+		    claimed_ts = NULL,
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
 	`
 
-	_, err := m.pool.Exec(ctx, query, mailID, errorMsg)
+	_, err := q.Exec(ctx, query, mailID, errorMsg)
+	return err
+}
+
+// releaseMail drops the claim of a mail whose sending was interrupted
+func (m *MailModule) releaseMail(ctx context.Context, q modules.Querier, mailID int) error {
+	query := `
+		UPDATE pgb.pgb_mail
+		SET claimed_ts = NULL
+		WHERE id = $1
+	`
+
+	_, err := q.Exec(ctx, query, mailID)
 	return err
 }
 
 // incrementRetryCount increments the retry counter
-func (m *MailModule) incrementRetryCount(ctx context.Context, mailID int) error {
+func (m *MailModule) incrementRetryCount(ctx context.Context, q modules.Querier, mailID int) error {
 	query := `
 		UPDATE pgb.pgb_mail
 		SET retry_count = retry_count + 1,
@@ -607,6 +940,6 @@ func (m *MailModule) incrementRetryCount(ctx context.Context, mailID int) error
 		WHERE id = $1
 	`
 
-	_, err := m.pool.Exec(ctx, query, mailID)
+	_, err := q.Exec(ctx, query, mailID)
 	return err
 }
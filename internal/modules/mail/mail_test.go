@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/database"
+	"pgbridge/internal/modules"
 )
 
 func getTestPool(t *testing.T) *pgxpool.Pool {
@@ -31,6 +33,7 @@ func cleanupTables(t *testing.T, pool *pgxpool.Pool) {
 	queries := []string{
 		"DROP TABLE IF EXISTS pgb.pgb_mail CASCADE",
 		"DROP TABLE IF EXISTS pgb.pgb_mail_settings CASCADE",
+		"DELETE FROM pgb.pgb_schema_version WHERE component = 'pgb_mail'",
 	}
 
 	for _, query := range queries {
@@ -40,6 +43,16 @@ func cleanupTables(t *testing.T, pool *pgxpool.Pool) {
 	}
 }
 
+// initialize creates the module's tables as addModule does: Initialize,
+// then the migrations
+func initialize(ctx context.Context, module *MailModule, pool *pgxpool.Pool) error {
+	if err := module.Initialize(ctx, pool); err != nil {
+		return err
+	}
+	_, err := database.NewMigrator(pool, "test_db", nil).Up(ctx, moduleName, migrations)
+	return err
+}
+
 func TestMailModule_Initialize(t *testing.T) {
 	pool := getTestPool(t)
 	defer pool.Close()
@@ -136,7 +149,7 @@ func TestMailModule_CreateMailSettings(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := module.Initialize(ctx, pool)
+	err := initialize(ctx, module, pool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -185,7 +198,7 @@ func TestMailModule_CreateMail(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := module.Initialize(ctx, pool)
+	err := initialize(ctx, module, pool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -371,7 +384,7 @@ func TestMailModule_MarkAsSent(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := module.Initialize(ctx, pool)
+	err := initialize(ctx, module, pool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -390,7 +403,7 @@ func TestMailModule_MarkAsSent(t *testing.T) {
 	`, settingID).Scan(&mailID)
 
 	// Mark as sent
-	err = module.markAsSent(ctx, mailID)
+	err = module.markAsSent(ctx, pool, mailID)
 	if err != nil {
 		t.Fatalf("markAsSent failed: %v", err)
 	}
@@ -415,6 +428,80 @@ func TestMailModule_MarkAsSent(t *testing.T) {
 	}
 }
 
+func TestMailModule_SendMailSkipsClaimed(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+
+	cleanupTables(t, pool)
+	defer cleanupTables(t, pool)
+
+	module := NewMailModule(pool, "test_db", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := initialize(ctx, module, pool); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var settingID, mailID int
+	pool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_mail_settings (smtp_server, smtp_port)
+		VALUES ('localhost', 1) RETURNING id
+	`).Scan(&settingID)
+	pool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_mail (mail_setting_id, header_from, header_to, subject, body_text)
+		VALUES ($1, 'from@example.com', 'to@example.com', 'Subject', 'Body')
+		RETURNING id
+	`, settingID).Scan(&mailID)
+
+	// Another sender holds the mail
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "SELECT id FROM pgb.pgb_mail WHERE id = $1 FOR UPDATE", mailID); err != nil {
+		t.Fatalf("Failed to lock mail: %v", err)
+	}
+
+	// Skipped right away: no attempt is made or recorded
+	begin := time.Now()
+	if err := module.sendMail(ctx, mailID); err != nil {
+		t.Errorf("Expected a claimed mail to be skipped, got: %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > retryDelay {
+		t.Errorf("Expected no send attempt, took %s", elapsed)
+	}
+	tx.Rollback(ctx)
+
+	var retries int
+	pool.QueryRow(ctx, "SELECT retry_count FROM pgb.pgb_mail WHERE id = $1", mailID).Scan(&retries)
+	if retries != 0 {
+		t.Errorf("Expected no retries to be recorded, got %d", retries)
+	}
+
+	// A claimed mail is skipped as well, once committed by the other sender
+	if _, err := pool.Exec(ctx, "UPDATE pgb.pgb_mail SET claimed_ts = CURRENT_TIMESTAMP WHERE id = $1", mailID); err != nil {
+		t.Fatalf("Failed to claim mail: %v", err)
+	}
+	if mail, err := module.claimMail(ctx, mailID); err != nil || mail != nil {
+		t.Errorf("Expected a claimed mail to be skipped, got %v, %v", mail, err)
+	}
+
+	// The claim of a sender that stopped expires
+	if _, err := pool.Exec(ctx, "UPDATE pgb.pgb_mail SET claimed_ts = CURRENT_TIMESTAMP - make_interval(secs => $2) WHERE id = $1", mailID, (claimTimeout + time.Minute).Seconds()); err != nil {
+		t.Fatalf("Failed to age claim: %v", err)
+	}
+	if mail, err := module.claimMail(ctx, mailID); err != nil || mail == nil {
+		t.Errorf("Expected an expired claim to be taken over, got %v, %v", mail, err)
+	}
+
+	// Missing mails are still reported
+	if err := module.sendMail(ctx, mailID+1000); err == nil {
+		t.Error("Expected an error for a missing mail")
+	}
+}
+
 func TestMailModule_RecordError(t *testing.T) {
 	pool := getTestPool(t)
 	defer pool.Close()
@@ -426,7 +513,7 @@ func TestMailModule_RecordError(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := module.Initialize(ctx, pool)
+	err := initialize(ctx, module, pool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -446,7 +533,7 @@ func TestMailModule_RecordError(t *testing.T) {
 
 	// Record error
 	errMsg := "Test error message"
-	err = module.recordError(ctx, mailID, errMsg)
+	err = module.recordError(ctx, pool, mailID, errMsg)
 	if err != nil {
 		t.Fatalf("recordError failed: %v", err)
 	}
@@ -477,7 +564,7 @@ func TestMailModule_ProcessQueue(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second) // Short timeout per mail
 	defer cancel()
 
-	err := module.Initialize(ctx, pool)
+	err := initialize(ctx, module, pool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -533,7 +620,7 @@ func TestMailModule_ProcessNotification(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second) // Short timeout
 	defer cancel()
 
-	err := module.Initialize(ctx, pool)
+	err := initialize(ctx, module, pool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -553,7 +640,7 @@ func TestMailModule_ProcessNotification(t *testing.T) {
 
 	// Process notification (will fail SMTP but should parse ID correctly)
 	payload := fmt.Sprintf("%d", mailID)
-	err = module.ProcessNotification(ctx, payload)
+	err = modules.Handler(module)(ctx, payload)
 	// Error expected because no real SMTP server
 
 	// Verify that retry_count was incremented
@@ -570,18 +657,69 @@ func TestMailModule_ProcessNotification(t *testing.T) {
 func TestMailModule_ProcessNotificationInvalidPayload(t *testing.T) {
 	module := NewMailModule(nil, "test_db", nil)
 	ctx := context.Background()
+	handler := modules.Handler(module)
 
-	err := module.ProcessNotification(ctx, "invalid")
+	err := handler(ctx, "invalid")
 	if err == nil {
 		t.Error("Expected error for invalid payload")
 	}
 
-	err = module.ProcessNotification(ctx, "not_a_number")
+	err = handler(ctx, "not_a_number")
 	if err == nil {
 		t.Error("Expected error for non-numeric payload")
 	}
 }
 
+func TestMailModule_ProcessNotificationCancel(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+
+	cleanupTables(t, pool)
+	defer cleanupTables(t, pool)
+
+	module := NewMailModule(pool, "test_db", nil)
+	ctx := context.Background()
+
+	if err := initialize(ctx, module, pool); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var settingID, mailID int
+	pool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_mail_settings (smtp_server, smtp_port)
+		VALUES ('smtp.example.com', 587) RETURNING id
+	`).Scan(&settingID)
+
+	pool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_mail (mail_setting_id, header_from, header_to, subject, body_text)
+		VALUES ($1, 'from@example.com', 'to@example.com', 'Subject', 'Body')
+		RETURNING id
+	`, settingID).Scan(&mailID)
+
+	handler := modules.Handler(module)
+	if err := handler(ctx, fmt.Sprintf(`{"id": %d, "op": "cancel"}`, mailID)); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	// A later insert notification must not attempt to send the mail
+	if err := handler(ctx, fmt.Sprintf("%d", mailID)); err != nil {
+		t.Fatalf("Expected cancelled mail to be skipped, got: %v", err)
+	}
+
+	var cancelled bool
+	var retryCount int
+	pool.QueryRow(ctx, `
+		SELECT cancelled_ts IS NOT NULL, retry_count FROM pgb.pgb_mail WHERE id = $1
+	`, mailID).Scan(&cancelled, &retryCount)
+
+	if !cancelled {
+		t.Error("Expected cancelled_ts to be set")
+	}
+	if retryCount != 0 {
+		t.Errorf("Expected no send attempt for a cancelled mail, got retry_count=%d", retryCount)
+	}
+}
+
 // Helper function
 func containsString(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || containsSubstring(s, substr)))
@@ -0,0 +1,28 @@
+package mail
+
+import "pgbridge/internal/database"
+
+// migrations bring pgb.pgb_mail of existing installations up to date;
+// Initialize creates the baseline
+var migrations = []database.Migration{
+	{
+		Version: 1,
+		Name:    "add cancelled_ts",
+		// Databases set up by the versions that added the column in
+		// Initialize have it already
+		Up: `
+			ALTER TABLE pgb.pgb_mail ADD COLUMN IF NOT EXISTS cancelled_ts TIMESTAMP;
+			COMMENT ON COLUMN pgb.pgb_mail.cancelled_ts IS 'Set when the mail was cancelled before being sent';
+		`,
+		Down: `ALTER TABLE pgb.pgb_mail DROP COLUMN IF EXISTS cancelled_ts;`,
+	},
+	{
+		Version: 2,
+		Name:    "add claimed_ts",
+		Up: `
+			ALTER TABLE pgb.pgb_mail ADD COLUMN IF NOT EXISTS claimed_ts TIMESTAMP;
+			COMMENT ON COLUMN pgb.pgb_mail.claimed_ts IS 'Set while a worker is sending the mail';
+		`,
+		Down: `ALTER TABLE pgb.pgb_mail DROP COLUMN IF EXISTS claimed_ts;`,
+	},
+}
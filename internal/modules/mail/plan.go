@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+
+	"pgbridge/internal/database"
+	"pgbridge/internal/modules"
+)
+
+// mailTable is the queue table
+var mailTable = database.SchemaObject{Kind: database.ObjectTable, Schema: "pgb", Name: "pgb_mail"}
+
+// schemaObjects are the objects created by Initialize and the migrations
+var schemaObjects = []database.SchemaObject{
+	{Kind: database.ObjectTable, Schema: "pgb", Name: "pgb_mail_settings"},
+	mailTable,
+	{Kind: database.ObjectColumn, Schema: "pgb", Table: "pgb_mail", Name: "cancelled_ts"},
+	{Kind: database.ObjectColumn, Schema: "pgb", Table: "pgb_mail", Name: "claimed_ts"},
+	{Kind: database.ObjectIndex, Schema: "pgb", Table: "pgb_mail", Name: "idx_pgb_mail_is_sent"},
+	{Kind: database.ObjectIndex, Schema: "pgb", Table: "pgb_mail", Name: "idx_pgb_mail_created_at"},
+	{Kind: database.ObjectIndex, Schema: "pgb", Table: "pgb_mail", Name: "idx_pgb_mail_setting_id"},
+}
+
+// Plan reports the objects Initialize creates and the mails ProcessQueue
+// would send
+func (m *MailModule) Plan(ctx context.Context) (*modules.Plan, error) {
+	plan := &modules.Plan{Objects: schemaObjects}
+
+	// Nothing is queued before the table exists
+	exists, err := database.ObjectExists(ctx, m.pool.Load(), mailTable)
+	if err != nil || !exists {
+		return plan, err
+	}
+
+	if plan.Queued, err = m.QueuedItems(ctx); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
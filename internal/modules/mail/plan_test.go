@@ -0,0 +1,76 @@
+package mail
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"pgbridge/internal/database"
+)
+
+func TestMailModule_Plan(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+
+	cleanupTables(t, pool)
+	defer cleanupTables(t, pool)
+
+	module := NewMailModule(pool, "test_db", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Before Initialize every table is to be created and nothing is queued
+	plan, err := module.Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(plan.Queued) != 0 {
+		t.Errorf("Expected nothing queued, got %v", plan.Queued)
+	}
+	changes, err := database.PlanSchema(ctx, pool, plan.Objects)
+	if err != nil {
+		t.Fatalf("PlanSchema failed: %v", err)
+	}
+	for _, change := range changes {
+		if change.Action != database.ActionCreate {
+			t.Errorf("Expected %s to be created, got %s", change.Object, change.Action)
+		}
+	}
+
+	if err := initialize(ctx, module, pool); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// After Initialize and the migrations every object exists
+	changes, _ = database.PlanSchema(ctx, pool, plan.Objects)
+	for _, change := range changes {
+		if change.Action != database.ActionNone {
+			t.Errorf("Expected %s to exist, got %s", change.Object, change.Action)
+		}
+	}
+
+	var settingID, unsentID int
+	pool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_mail_settings (smtp_server, smtp_port)
+		VALUES ('smtp.example.com', 587) RETURNING id
+	`).Scan(&settingID)
+	pool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_mail (mail_setting_id, header_from, header_to, subject, body_text)
+		VALUES ($1, 'from@example.com', 'to@example.com', 'Subject', 'Body')
+		RETURNING id
+	`, settingID).Scan(&unsentID)
+	pool.Exec(ctx, `
+		INSERT INTO pgb.pgb_mail (mail_setting_id, header_from, header_to, subject, body_text, is_sent)
+		VALUES ($1, 'from@example.com', 'to@example.com', 'Subject', 'Body', true)
+	`, settingID)
+
+	plan, err = module.Plan(ctx)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if expected := []string{strconv.Itoa(unsentID)}; !reflect.DeepEqual(plan.Queued, expected) {
+		t.Errorf("Expected queued %v, got %v", expected, plan.Queued)
+	}
+}
@@ -0,0 +1,166 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"pgbridge/internal/modules"
+)
+
+// mailStatusConditions maps each queue status to its condition on pgb.pgb_mail
+var mailStatusConditions = map[string]string{
+	modules.QueueStatusPending:   "is_sent = false AND cancelled_ts IS NULL AND error_message IS NULL",
+	modules.QueueStatusFailed:    "is_sent = false AND cancelled_ts IS NULL AND error_message IS NOT NULL",
+	modules.QueueStatusSent:      "is_sent = true",
+	modules.QueueStatusCancelled: "is_sent = false AND cancelled_ts IS NOT NULL",
+}
+
+// mailItemColumns selects a pgb.pgb_mail row in the order scanned by scanMailItem
+const mailItemColumns = `
+	id,
+	CASE
+		WHEN is_sent THEN 'sent'
+		WHEN cancelled_ts IS NOT NULL THEN 'cancelled'
+		WHEN error_message IS NOT NULL THEN 'failed'
+		ELSE 'pending'
+	END,
+	header_to, subject, COALESCE(retry_count, 0), COALESCE(error_message, ''),
+	created_at, sent_ts, cancelled_ts,
+	mail_setting_id, header_from, COALESCE(header_cc, ''), COALESCE(header_bcc, '')
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMailItem reads a row selected with mailItemColumns
+func scanMailItem(row rowScanner) (*modules.QueueItem, error) {
+	item := &modules.QueueItem{}
+	var settingID int
+	var from, cc, bcc string
+
+	err := row.Scan(
+		&item.ID,
+		&item.Status,
+		&item.Recipient,
+		&item.Summary,
+		&item.RetryCount,
+		&item.ErrorMessage,
+		&item.CreatedAt,
+		&item.SentAt,
+		&item.CancelledAt,
+		&settingID,
+		&from,
+		&cc,
+		&bcc,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Details = map[string]string{
+		"mail_setting_id": strconv.Itoa(settingID),
+		"header_from":     from,
+	}
+	if cc != "" {
+		item.Details["header_cc"] = cc
+	}
+	if bcc != "" {
+		item.Details["header_bcc"] = bcc
+	}
+
+	return item, nil
+}
+
+// ListItems returns the mails matching the filter
+func (m *MailModule) ListItems(ctx context.Context, filter modules.QueueFilter) ([]modules.QueueItem, error) {
+	clause, args, err := filter.Where(mailStatusConditions, "header_to")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.pool.Load().Query(ctx, "SELECT"+mailItemColumns+"FROM pgb.pgb_mail"+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mails: %w", err)
+	}
+	defer rows.Close()
+
+	items := []modules.QueueItem{}
+	for rows.Next() {
+		item, err := scanMailItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mail: %w", err)
+		}
+		items = append(items, *item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list mails: %w", err)
+	}
+
+	return items, nil
+}
+
+// GetItem returns one mail
+func (m *MailModule) GetItem(ctx context.Context, id int) (*modules.QueueItem, error) {
+	row := m.pool.Load().QueryRow(ctx, "SELECT"+mailItemColumns+"FROM pgb.pgb_mail WHERE id = $1", id)
+
+	item, err := scanMailItem(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mail %d: %w", id, err)
+	}
+
+	return item, nil
+}
+
+// RequeueItems resets the unsent mails among ids and notifies the mail
+// channel in the same transaction, so the running service sends them again
+func (m *MailModule) RequeueItems(ctx context.Context, ids []int) ([]int, error) {
+	tx, err := m.pool.Load().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	requeued, err := m.resetMails(ctx, tx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset mails: %w", err)
+	}
+
+	if err := modules.Renotify(ctx, tx, channelName, requeued); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit requeue: %w", err)
+	}
+
+	return requeued, nil
+}
+
+// CancelItems cancels the unsent mails among ids
+func (m *MailModule) CancelItems(ctx context.Context, ids []int) ([]int, error) {
+	cancelled, err := m.cancelMails(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel mails: %w", err)
+	}
+
+	return cancelled, nil
+}
+
+// PurgeSent deletes mails sent more than days ago
+func (m *MailModule) PurgeSent(ctx context.Context, days int) (int64, error) {
+	query := `
+		DELETE FROM pgb.pgb_mail
+		WHERE is_sent = true
+		AND sent_ts < CURRENT_TIMESTAMP - make_interval(days => $1)
+	`
+
+	tag, err := m.pool.Load().Exec(ctx, query, days)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge sent mails: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,130 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pgbridge/internal/modules"
+)
+
+func TestMailModule_Queue(t *testing.T) {
+	pool := getTestPool(t)
+	defer pool.Close()
+
+	cleanupTables(t, pool)
+	defer cleanupTables(t, pool)
+
+	module := NewMailModule(pool, "test_db", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := initialize(ctx, module, pool); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var settingID int
+	pool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_mail_settings (smtp_server, smtp_port)
+		VALUES ('smtp.example.com', 587) RETURNING id
+	`).Scan(&settingID)
+
+	insert := func(to, errorMessage string, sentDaysAgo int) int {
+		var id int
+		err := pool.QueryRow(ctx, `
+			INSERT INTO pgb.pgb_mail (mail_setting_id, header_from, header_to, subject, body_text,
+			                          error_message, retry_count, is_sent, sent_ts)
+			VALUES ($1, 'from@example.com', $2, 'Subject', 'Body',
+			        NULLIF($3, ''), CASE WHEN $3 = '' THEN 0 ELSE 3 END,
+			        $4 > 0, CASE WHEN $4 > 0 THEN CURRENT_TIMESTAMP - make_interval(days => $4) END)
+			RETURNING id
+		`, settingID, to, errorMessage, sentDaysAgo).Scan(&id)
+		if err != nil {
+			t.Fatalf("Failed to insert mail: %v", err)
+		}
+		return id
+	}
+
+	pendingID := insert("alice@example.com", "", 0)
+	failedID := insert("bob@example.com", "connection refused", 0)
+	oldSentID := insert("carol@example.com", "", 40)
+	recentSentID := insert("carol@example.com", "", 1)
+
+	// Filters
+	failed, err := module.ListItems(ctx, modules.QueueFilter{Status: modules.QueueStatusFailed})
+	if err != nil {
+		t.Fatalf("ListItems failed: %v", err)
+	}
+	if len(failed) != 1 || failed[0].ID != failedID || failed[0].ErrorMessage != "connection refused" || failed[0].RetryCount != 3 {
+		t.Errorf("Expected the failed mail, got %+v", failed)
+	}
+
+	byRecipient, _ := module.ListItems(ctx, modules.QueueFilter{Recipient: "CAROL"})
+	if len(byRecipient) != 2 {
+		t.Errorf("Expected 2 mails for carol, got %d", len(byRecipient))
+	}
+
+	// Wildcards of LIKE are matched literally
+	wildcard, _ := module.ListItems(ctx, modules.QueueFilter{Status: modules.QueueStatusAll, Recipient: "_"})
+	if len(wildcard) != 0 {
+		t.Errorf("Expected no mail to contain '_', got %d", len(wildcard))
+	}
+
+	limited, _ := module.ListItems(ctx, modules.QueueFilter{Status: modules.QueueStatusAll, Limit: 3})
+	if len(limited) != 3 {
+		t.Errorf("Expected the limit to apply, got %d items", len(limited))
+	}
+
+	item, err := module.GetItem(ctx, pendingID)
+	if err != nil {
+		t.Fatalf("GetItem failed: %v", err)
+	}
+	if item.Status != modules.QueueStatusPending || item.Recipient != "alice@example.com" || item.Details["header_from"] != "from@example.com" {
+		t.Errorf("Unexpected item: %+v", item)
+	}
+
+	// Requeue resets the failure state; sent mails are left alone
+	requeued, err := module.RequeueItems(ctx, []int{failedID, oldSentID})
+	if err != nil {
+		t.Fatalf("RequeueItems failed: %v", err)
+	}
+	if len(requeued) != 1 || requeued[0] != failedID {
+		t.Errorf("Expected only the failed mail to be requeued, got %v", requeued)
+	}
+	item, _ = module.GetItem(ctx, failedID)
+	if item.Status != modules.QueueStatusPending || item.RetryCount != 0 || item.ErrorMessage != "" {
+		t.Errorf("Expected the requeued mail to be pending with no retries, got %+v", item)
+	}
+
+	cancelled, err := module.CancelItems(ctx, []int{pendingID, recentSentID})
+	if err != nil {
+		t.Fatalf("CancelItems failed: %v", err)
+	}
+	if len(cancelled) != 1 || cancelled[0] != pendingID {
+		t.Errorf("Expected only the pending mail to be cancelled, got %v", cancelled)
+	}
+
+	purged, err := module.PurgeSent(ctx, 30)
+	if err != nil {
+		t.Fatalf("PurgeSent failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 mail purged, got %d", purged)
+	}
+	if _, err := module.GetItem(ctx, oldSentID); err == nil {
+		t.Error("Expected the old sent mail to be deleted")
+	}
+	if _, err := module.GetItem(ctx, recentSentID); err != nil {
+		t.Errorf("Expected the recent sent mail to be kept: %v", err)
+	}
+}
+
+func TestMailModule_QueueInvalidStatus(t *testing.T) {
+	module := NewMailModule(nil, "test_db", nil)
+
+	_, err := module.ListItems(context.Background(), modules.QueueFilter{Status: "stuck"})
+	if err == nil || errors.Is(err, modules.ErrUnsupportedStatus) {
+		t.Errorf("Expected an invalid status error, got %v", err)
+	}
+}
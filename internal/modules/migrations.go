@@ -0,0 +1,54 @@
+package modules
+
+import (
+	"sort"
+	"sync"
+
+	"pgbridge/internal/database"
+)
+
+var (
+	migrationRegistry   = make(map[string][]database.Migration)
+	migrationRegistryMu sync.RWMutex
+)
+
+// RegisterMigrations makes the schema migrations of a module available
+// under the module's name. They are applied after Initialize, so changes
+// to the module's tables reach existing installations. It panics if the
+// name is empty or already registered, or the versions are not 1, 2, 3, …
+func RegisterMigrations(name string, migrations []database.Migration) {
+	migrationRegistryMu.Lock()
+	defer migrationRegistryMu.Unlock()
+
+	if name == "" {
+		panic("modules: RegisterMigrations with empty name")
+	}
+	if err := database.CheckMigrations(name, migrations); err != nil {
+		panic("modules: RegisterMigrations: " + err.Error())
+	}
+	if _, dup := migrationRegistry[name]; dup {
+		panic("modules: RegisterMigrations called twice for " + name)
+	}
+	migrationRegistry[name] = migrations
+}
+
+// Migrations returns the migrations of a module, nil if it has none
+func Migrations(name string) []database.Migration {
+	migrationRegistryMu.RLock()
+	defer migrationRegistryMu.RUnlock()
+
+	return migrationRegistry[name]
+}
+
+// MigrationNames returns the names of the modules with migrations, sorted
+func MigrationNames() []string {
+	migrationRegistryMu.RLock()
+	defer migrationRegistryMu.RUnlock()
+
+	names := make([]string, 0, len(migrationRegistry))
+	for name := range migrationRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
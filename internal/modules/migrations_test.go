@@ -0,0 +1,47 @@
+package modules
+
+import (
+	"slices"
+	"testing"
+
+	"pgbridge/internal/database"
+)
+
+func TestRegisterMigrations(t *testing.T) {
+	migrations := []database.Migration{{Version: 1, Name: "first", Up: "SELECT 1"}}
+	RegisterMigrations("test_migrations", migrations)
+
+	if got := Migrations("test_migrations"); len(got) != 1 || got[0].Name != "first" {
+		t.Errorf("Expected the registered migrations, got %v", got)
+	}
+	if !slices.Contains(MigrationNames(), "test_migrations") {
+		t.Errorf("Expected MigrationNames to include test_migrations, got %v", MigrationNames())
+	}
+	if Migrations("test_no_migrations") != nil {
+		t.Error("Expected no migrations for an unknown module")
+	}
+}
+
+func TestRegisterMigrations_Invalid(t *testing.T) {
+	cases := map[string]func(){
+		"empty name": func() { RegisterMigrations("", nil) },
+		"gap": func() {
+			RegisterMigrations("test_migrations_gap", []database.Migration{{Version: 2, Name: "second", Up: "SELECT 2"}})
+		},
+		"duplicate": func() {
+			RegisterMigrations("test_migrations_dup", nil)
+			RegisterMigrations("test_migrations_dup", nil)
+		},
+	}
+
+	for name, register := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
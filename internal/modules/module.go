@@ -2,8 +2,10 @@ package modules
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/database"
 )
 
 // Module defines the interface that all pgbridge modules must implement
@@ -26,14 +28,75 @@ type Module interface {
 	GetChannelName() string
 
 	// ProcessNotification handles an incoming NOTIFY message
-	// The payload is the content sent via NOTIFY
-	ProcessNotification(ctx context.Context, payload string) error
+	// The payload sent via NOTIFY has already been decoded (see ParseNotification)
+	ProcessNotification(ctx context.Context, n Notification) error
 
 	// ProcessQueue processes any pending items that accumulated while offline
 	// Called during initialization to handle messages that arrived when service was down
 	ProcessQueue(ctx context.Context) error
 }
 
+// KeyedModule is implemented by modules that can derive an ordering key
+// from a notification payload. When per-key ordering is enabled for a
+// module, notifications sharing a key are processed one at a time in the
+// order they were received.
+type KeyedModule interface {
+	// OrderingKey returns the key for the item referenced by the payload
+	OrderingKey(ctx context.Context, payload string) (string, error)
+}
+
+// SweepableModule is implemented by modules with a queue table that can be
+// swept periodically for items whose notification was missed
+type SweepableModule interface {
+	// PendingItems returns the notification payloads of items that were
+	// never processed and were created more than olderThan ago
+	PendingItems(ctx context.Context, olderThan time.Duration) ([]string, error)
+}
+
+// QueuedModule is implemented by modules that can list what ProcessQueue
+// would process. Catching up then hands the items to the module's worker
+// pool, where they are deduplicated against the notifications being
+// handled, instead of processing them next to the workers.
+type QueuedModule interface {
+	// QueuedItems returns the notification payloads of the items
+	// ProcessQueue would process
+	QueuedItems(ctx context.Context) ([]string, error)
+}
+
+// QueueDepthModule is implemented by modules with a queue table whose
+// backlog is exported as a metric
+type QueueDepthModule interface {
+	// QueueDepth returns the number of unsent, uncancelled rows
+	QueueDepth(ctx context.Context) (int, error)
+}
+
+// PoolModule is implemented by modules that keep the pool of their
+// database. The connection manager replaces the pool when it reconnects;
+// SetPool is then called with the new one, so the module never queries
+// the closed pool.
+type PoolModule interface {
+	// SetPool replaces the pool of the module's database
+	SetPool(pool *pgxpool.Pool)
+}
+
+// Plan describes what a module would do on startup
+type Plan struct {
+	// Objects are the schema objects Initialize creates or replaces on the
+	// module's database
+	Objects []database.SchemaObject
+
+	// Queued are the payloads of the items ProcessQueue would process
+	Queued []string
+}
+
+// PlannedModule is implemented by modules that can report what Initialize
+// and ProcessQueue would do. Plan must not change anything: it may only
+// read, and it runs on read-only connections during a dry run.
+type PlannedModule interface {
+	// Plan returns the startup plan of the module
+	Plan(ctx context.Context) (*Plan, error)
+}
+
 // ModuleConfig holds common configuration for all modules
 type ModuleConfig struct {
 	DatabaseName string
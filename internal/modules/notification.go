@@ -0,0 +1,102 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"pgbridge/internal/tracing"
+)
+
+// Notification operations
+const (
+	// OpInsert processes a new item (the default, and the meaning of a
+	// bare integer payload)
+	OpInsert = "insert"
+	// OpUpdate processes an item that was changed
+	OpUpdate = "update"
+	// OpRetry processes an item again now, clearing a previous failure
+	OpRetry = "retry"
+	// OpCancel marks an unprocessed item so it is never processed
+	OpCancel = "cancel"
+)
+
+// Notification is a decoded NOTIFY payload
+// Payloads are either a bare item id ('42') or a JSON envelope:
+//
+//	{"id": 42, "op": "retry", "priority": 5, "meta": {"requested_by": "alice"}}
+type Notification struct {
+	// ID of the item in the module's queue table
+	ID int `json:"id"`
+	// Op is one of OpInsert, OpUpdate, OpRetry or OpCancel
+	Op string `json:"op"`
+	// Priority above 0 has the notification handled before the others
+	// waiting in the module's worker queue
+	Priority int `json:"priority"`
+	// Meta holds free-form application data
+	Meta map[string]interface{} `json:"meta"`
+	// Raw is the payload as received
+	Raw string `json:"-"`
+}
+
+// ParseNotification decodes a NOTIFY payload
+// Unknown fields of an envelope are ignored, so senders may add their own
+func ParseNotification(payload string) (Notification, error) {
+	trimmed := strings.TrimSpace(payload)
+
+	if !strings.HasPrefix(trimmed, "{") {
+		id, err := strconv.Atoi(trimmed)
+		if err != nil {
+			return Notification{}, fmt.Errorf("invalid payload '%s': expected an id or a JSON object", payload)
+		}
+		return Notification{ID: id, Op: OpInsert, Raw: payload}, nil
+	}
+
+	var n Notification
+	if err := json.NewDecoder(strings.NewReader(trimmed)).Decode(&n); err != nil {
+		return Notification{}, fmt.Errorf("invalid JSON payload '%s': %w", payload, err)
+	}
+	n.Raw = payload
+
+	if n.ID <= 0 {
+		return Notification{}, fmt.Errorf("invalid payload '%s': missing or invalid id", payload)
+	}
+
+	n.Op = strings.ToLower(strings.TrimSpace(n.Op))
+	switch n.Op {
+	case "":
+		n.Op = OpInsert
+	case OpInsert, OpUpdate, OpRetry, OpCancel:
+	default:
+		return Notification{}, fmt.Errorf("invalid payload '%s': unknown op '%s'", payload, n.Op)
+	}
+
+	return n, nil
+}
+
+// Handler returns a function that decodes payloads and passes them to the
+// module's ProcessNotification, for use as a worker pool handler
+func Handler(module Module) func(ctx context.Context, payload string) error {
+	return func(ctx context.Context, payload string) error {
+		n, err := ParseNotification(payload)
+		if err != nil {
+			return err
+		}
+		trace.SpanFromContext(ctx).SetAttributes(tracing.RowID(n.ID), tracing.OpKey.String(n.Op))
+		return module.ProcessNotification(ctx, n)
+	}
+}
+
+// DedupKey identifies the work a payload asks for, so a bare '42' and
+// '{"id": 42}' count as the same pending job while a cancel of 42 does
+// not. Unparseable payloads are their own key.
+func DedupKey(payload string) string {
+	n, err := ParseNotification(payload)
+	if err != nil {
+		return payload
+	}
+	return n.Op + ":" + strconv.Itoa(n.ID)
+}
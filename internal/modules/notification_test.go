@@ -0,0 +1,86 @@
+package modules
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseNotification_BareID(t *testing.T) {
+	n, err := ParseNotification("42")
+	if err != nil {
+		t.Fatalf("ParseNotification failed: %v", err)
+	}
+	if n.ID != 42 || n.Op != OpInsert || n.Raw != "42" {
+		t.Errorf("Unexpected notification: %+v", n)
+	}
+}
+
+func TestParseNotification_JSON(t *testing.T) {
+	n, err := ParseNotification(`{"id": 7, "op": "Retry", "priority": 5, "meta": {"requested_by": "alice"}}`)
+	if err != nil {
+		t.Fatalf("ParseNotification failed: %v", err)
+	}
+	if n.ID != 7 || n.Op != OpRetry || n.Priority != 5 {
+		t.Errorf("Unexpected notification: %+v", n)
+	}
+	if n.Meta["requested_by"] != "alice" {
+		t.Errorf("Expected meta to be decoded, got %v", n.Meta)
+	}
+}
+
+func TestParseNotification_DefaultOp(t *testing.T) {
+	n, err := ParseNotification(`{"id": 3}`)
+	if err != nil {
+		t.Fatalf("ParseNotification failed: %v", err)
+	}
+	if n.Op != OpInsert {
+		t.Errorf("Expected op %q, got %q", OpInsert, n.Op)
+	}
+}
+
+func TestParseNotification_UnknownFields(t *testing.T) {
+	n, err := ParseNotification(`{"id": 5, "op": "retry", "source": "billing", "version": 2}`)
+	if err != nil {
+		t.Fatalf("Expected unknown fields to be ignored, got: %v", err)
+	}
+	if n.ID != 5 || n.Op != OpRetry {
+		t.Errorf("Unexpected notification: %+v", n)
+	}
+}
+
+func TestParseNotification_Invalid(t *testing.T) {
+	payloads := []string{
+		"",
+		"not_a_number",
+		`{"op": "insert"}`,
+		`{"id": 0}`,
+		`{"id": 1, "op": "delete"}`,
+		`{"id": "1"}`,
+		`{"id": 1`,
+	}
+
+	for _, payload := range payloads {
+		if _, err := ParseNotification(payload); err == nil {
+			t.Errorf("Expected error for payload %q", payload)
+		}
+	}
+}
+
+func TestHandler_RejectsInvalidPayload(t *testing.T) {
+	module := &testModule{name: "test"}
+	if err := Handler(module)(context.Background(), "invalid"); err == nil {
+		t.Error("Expected error for invalid payload")
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	if DedupKey("42") != DedupKey(`{"id": 42}`) {
+		t.Error("Expected a bare id and the equivalent envelope to share a key")
+	}
+	if DedupKey("42") == DedupKey(`{"id": 42, "op": "cancel"}`) {
+		t.Error("Expected a cancel to have its own key")
+	}
+	if DedupKey("garbage") != "garbage" {
+		t.Error("Expected an unparseable payload to be its own key")
+	}
+}
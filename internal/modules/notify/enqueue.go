@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"pgbridge/internal/modules"
+)
+
+// NotifyRequest is a notification enqueued over the HTTP API
+type NotifyRequest struct {
+	UserEmail   string `json:"user_email"`
+	SenderDB    string `json:"sender_db"`
+	Message     string `json:"message"`
+	MessageLink string `json:"message_link"`
+	Criticality int    `json:"criticality"`
+}
+
+// Validate checks the request against the constraints of pgb.pgb_notify
+// after applying the defaults: the sender is the configured database name
+// and the criticality is 1 (info). user_email is reduced to the bare
+// address.
+func (r *NotifyRequest) Validate(dbName string) error {
+	if r.SenderDB == "" {
+		r.SenderDB = dbName
+	}
+	if r.Criticality == 0 {
+		r.Criticality = 1
+	}
+
+	var v modules.Validator
+
+	v.Required("user_email", r.UserEmail)
+	v.Address("user_email", &r.UserEmail)
+	v.MaxLength("user_email", r.UserEmail, 255)
+
+	v.MaxLength("sender_db", r.SenderDB, 100)
+	v.MaxLength("message_link", r.MessageLink, 500)
+
+	if r.Criticality < 1 || r.Criticality > 5 {
+		v.Addf("criticality must be between 1 and 5")
+	}
+
+	return v.Err()
+}
+
+// Enqueue inserts a notification; the S01_send_notification trigger
+// notifies the channel
+func (n *NotifyModule) Enqueue(ctx context.Context, request []byte) (int, error) {
+	var r NotifyRequest
+	if err := modules.DecodeRequest(request, &r); err != nil {
+		return 0, err
+	}
+	if err := r.Validate(n.sourceName); err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO pgb.pgb_notify (user_email, sender_db, message, message_link, criticality)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5)
+		RETURNING id
+	`
+
+	var id int
+	err := n.sourcePool.Load().QueryRow(ctx, query, r.UserEmail, r.SenderDB, r.Message, r.MessageLink, r.Criticality).Scan(&id)
+	if err != nil {
+		return 0, modules.ConstraintError(fmt.Errorf("failed to insert notification: %w", err))
+	}
+
+	return id, nil
+}
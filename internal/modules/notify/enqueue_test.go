@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pgbridge/internal/modules"
+)
+
+func TestNotifyRequest_Validate(t *testing.T) {
+	r := NotifyRequest{UserEmail: "User <user@Example.com>", Message: "Hello"}
+	if err := r.Validate("test_db"); err != nil {
+		t.Fatalf("Expected a valid request, got %v", err)
+	}
+	if r.SenderDB != "test_db" || r.Criticality != 1 {
+		t.Errorf("Expected the defaults, got sender %q criticality %d", r.SenderDB, r.Criticality)
+	}
+	if r.UserEmail != "user@example.com" {
+		t.Errorf("Expected the bare address, got %q", r.UserEmail)
+	}
+
+	invalid := []NotifyRequest{
+		{},
+		{UserEmail: "not an address"},
+		{UserEmail: "user@example.com, other@example.com"},
+		{UserEmail: "user@example.com", Criticality: 6},
+		{UserEmail: "user@example.com", Criticality: -1},
+	}
+	for i, r := range invalid {
+		var verr *modules.ValidationError
+		if err := r.Validate("test_db"); !errors.As(err, &verr) {
+			t.Errorf("case %d: expected a ValidationError, got %v", i, err)
+		}
+	}
+}
+
+func TestNotifyModule_Enqueue(t *testing.T) {
+	sourcePool, centralPool := getTestPools(t)
+	defer sourcePool.Close()
+	defer centralPool.Close()
+
+	cleanupTables(t, sourcePool, centralPool)
+	defer cleanupTables(t, sourcePool, centralPool)
+
+	module := NewNotifyModule(sourcePool, centralPool, "test_db", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := initialize(ctx, module, sourcePool); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	id, err := module.Enqueue(ctx, []byte(`{"user_email": "user@example.com", "message": "Hello", "criticality": 3}`))
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	var sender string
+	var criticality int
+	sourcePool.QueryRow(ctx, "SELECT sender_db, criticality FROM pgb.pgb_notify WHERE id = $1", id).Scan(&sender, &criticality)
+	if sender != "test_db" || criticality != 3 {
+		t.Errorf("Unexpected row: sender %q criticality %d", sender, criticality)
+	}
+
+	_, err = module.Enqueue(ctx, []byte(`{"user_email": "user@example.com", "priority": 3}`))
+	var verr *modules.ValidationError
+	if !errors.As(err, &verr) {
+		t.Errorf("Expected a ValidationError for an unknown field, got %v", err)
+	}
+}
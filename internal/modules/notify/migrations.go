@@ -0,0 +1,62 @@
+package notify
+
+import "pgbridge/internal/database"
+
+// migrations bring pgb.pgb_notify of existing installations up to date;
+// Initialize creates the baseline
+var migrations = []database.Migration{
+	{
+		// Existing databases carry a quoted "S01_send_notification" BEFORE
+		// INSERT trigger next to s01_send_notification: the NOTIFY fired
+		// twice, once before the row was visible
+		Version: 1,
+		Name:    "drop duplicate send notification triggers",
+		Up: `
+			DO $$
+			DECLARE
+				t record;
+			BEGIN
+				FOR t IN
+					SELECT tgname FROM pg_trigger
+					WHERE tgrelid = 'pgb.pgb_notify'::regclass
+					AND tgfoid = 'pgb.trg_pgb_send_notification'::regproc
+					AND tgname <> 's01_send_notification'
+					AND NOT tgisinternal
+				LOOP
+					EXECUTE format('DROP TRIGGER %I ON pgb.pgb_notify', t.tgname);
+				END LOOP;
+			END
+			$$;
+
+			DROP TRIGGER IF EXISTS S01_send_notification ON pgb.pgb_notify;
+
+			CREATE TRIGGER S01_send_notification
+			AFTER INSERT ON pgb.pgb_notify
+			FOR EACH ROW
+			EXECUTE FUNCTION pgb.trg_pgb_send_notification();
+
+			COMMENT ON TRIGGER S01_send_notification ON pgb.pgb_notify IS 'Automatically triggers notification forwarding on insert';
+		`,
+		// The duplicates were a bug; there is nothing to restore
+	},
+	{
+		Version: 2,
+		Name:    "add cancelled_ts",
+		// Databases set up by the versions that added the column in
+		// Initialize have it already
+		Up: `
+			ALTER TABLE pgb.pgb_notify ADD COLUMN IF NOT EXISTS cancelled_ts TIMESTAMP;
+			COMMENT ON COLUMN pgb.pgb_notify.cancelled_ts IS 'Set when the notification was cancelled before being forwarded';
+		`,
+		Down: `ALTER TABLE pgb.pgb_notify DROP COLUMN IF EXISTS cancelled_ts;`,
+	},
+	{
+		Version: 3,
+		Name:    "add claimed_ts",
+		Up: `
+			ALTER TABLE pgb.pgb_notify ADD COLUMN IF NOT EXISTS claimed_ts TIMESTAMP;
+			COMMENT ON COLUMN pgb.pgb_notify.claimed_ts IS 'Set while a worker is forwarding the notification';
+		`,
+		Down: `ALTER TABLE pgb.pgb_notify DROP COLUMN IF EXISTS claimed_ts;`,
+	},
+}
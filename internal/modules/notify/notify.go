@@ -2,25 +2,38 @@ package notify
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"pgbridge/internal/logger"
+	"pgbridge/internal/metrics"
+	"pgbridge/internal/modules"
+	"pgbridge/internal/tracing"
 )
 
 const (
 	moduleName  = "pgb_notify"
 	channelName = "pgb_notify"
+
+	// claimTimeout outlasts forwarding a notification; a claim older than
+	// that was left by a worker that stopped
+	claimTimeout = 5 * time.Minute
+	// recordTimeout bounds marking a notification after forwarding
+	recordTimeout = 10 * time.Second
 )
 
 // NotifyModule handles notification forwarding between databases
 type NotifyModule struct {
-	sourcePool  *pgxpool.Pool  // Connection to source database
-	centralPool *pgxpool.Pool  // Connection to central notification database
-	sourceName  string         // Name of the source database
-	logger      *logger.Logger // Logger instance
+	sourcePool  atomic.Pointer[pgxpool.Pool] // Connection to source database
+	centralPool *pgxpool.Pool                // Connection to central notification database
+	sourceName  string                       // Name of the source database
+	logger      *logger.Logger               // Logger instance
 	mu          sync.RWMutex
 	shutdown    chan struct{}
 	wg          sync.WaitGroup
@@ -37,17 +50,41 @@ type Notification struct {
 	IsSent      bool
 	SentTS      *time.Time
 	CreatedAt   time.Time
+	CancelledTS *time.Time
+}
+
+func init() {
+	modules.Register(moduleName, func(ctx context.Context, mc modules.Context) (modules.Module, error) {
+		// Notifications are forwarded to the central database
+		centralPool, err := mc.CentralPool(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to central database: %w", err)
+		}
+		return NewNotifyModule(mc.Pool, centralPool, mc.DatabaseName, mc.Logger), nil
+	})
+	// The queue lives in the source database only
+	modules.RegisterQueue(moduleName, func(pool *pgxpool.Pool, dbName string) modules.Queue {
+		return NewNotifyModule(pool, nil, dbName, nil)
+	})
+	modules.RegisterMigrations(moduleName, migrations)
 }
 
 // NewNotifyModule creates a new notify module instance
 func NewNotifyModule(sourcePool *pgxpool.Pool, centralPool *pgxpool.Pool, sourceName string, log *logger.Logger) *NotifyModule {
-	return &NotifyModule{
-		sourcePool:  sourcePool,
+	n := &NotifyModule{
 		centralPool: centralPool,
 		sourceName:  sourceName,
 		logger:      log,
 		shutdown:    make(chan struct{}),
 	}
+	n.sourcePool.Store(sourcePool)
+	return n
+}
+
+// SetPool replaces the source pool after the connection manager
+// reconnected; the central pool is not managed per database
+func (n *NotifyModule) SetPool(pool *pgxpool.Pool) {
+	n.sourcePool.Store(pool)
 }
 
 // Name returns the module name
@@ -131,7 +168,7 @@ func (n *NotifyModule) createNotificationTable(ctx context.Context) error {
 		COMMENT ON COLUMN pgb.pgb_notify.is_sent IS 'Whether notification was sent to central database';
 	`
 
-	_, err := n.sourcePool.Exec(ctx, query)
+	_, err := n.sourcePool.Load().Exec(ctx, query)
 	return err
 }
 
@@ -147,7 +184,7 @@ func (n *NotifyModule) createIndexes(ctx context.Context) error {
 	}
 
 	for _, index := range indexes {
-		if _, err := n.sourcePool.Exec(ctx, index); err != nil {
+		if _, err := n.sourcePool.Load().Exec(ctx, index); err != nil {
 			return err
 		}
 	}
@@ -175,7 +212,7 @@ func (n *NotifyModule) createTriggers(ctx context.Context) error {
 		COMMENT ON FUNCTION pgb.trg_pgb_send_notification() IS 'Automatically sends NOTIFY when notification is inserted';
 	`
 
-	if _, err := n.sourcePool.Exec(ctx, functionSQL); err != nil {
+	if _, err := n.sourcePool.Load().Exec(ctx, functionSQL); err != nil {
 		return fmt.Errorf("failed to create trigger function: %w", err)
 	}
 
@@ -191,7 +228,7 @@ func (n *NotifyModule) createTriggers(ctx context.Context) error {
 		COMMENT ON TRIGGER S01_send_notification ON pgb.pgb_notify IS 'Automatically triggers notification forwarding on insert';
 	`
 
-	if _, err := n.sourcePool.Exec(ctx, triggerSQL); err != nil {
+	if _, err := n.sourcePool.Load().Exec(ctx, triggerSQL); err != nil {
 		return fmt.Errorf("failed to create trigger: %w", err)
 	}
 
@@ -235,29 +272,66 @@ func (n *NotifyModule) Stop() error {
 }
 
 // ProcessNotification handles incoming NOTIFY messages with notification IDs
-func (n *NotifyModule) ProcessNotification(ctx context.Context, payload string) error {
-	// Parse the payload as a notification ID
-	var notifyID int
-	if _, err := fmt.Sscanf(payload, "%d", &notifyID); err != nil {
-		return fmt.Errorf("invalid notification ID in payload '%s': %w", payload, err)
+// Cancel marks an unsent notification so it is never forwarded; every
+// other operation forwards it.
+func (n *NotifyModule) ProcessNotification(ctx context.Context, msg modules.Notification) error {
+	if msg.Op == modules.OpCancel {
+		return n.cancelNotification(ctx, msg.ID)
 	}
 
-	// Forward the notification
-	return n.forwardNotification(ctx, notifyID)
+	return n.forwardNotification(ctx, msg.ID)
+}
+
+// OrderingKey returns the user email of a notification, so that
+// notifications for the same user are forwarded in order when per-key
+// ordering is enabled
+func (n *NotifyModule) OrderingKey(ctx context.Context, payload string) (string, error) {
+	msg, err := modules.ParseNotification(payload)
+	if err != nil {
+		return "", err
+	}
+
+	var userEmail string
+	err = n.sourcePool.Load().QueryRow(ctx, `SELECT user_email FROM pgb.pgb_notify WHERE id = $1`, msg.ID).Scan(&userEmail)
+	if err != nil {
+		return "", fmt.Errorf("failed to query notification user: %w", err)
+	}
+
+	return userEmail, nil
 }
 
 // ProcessQueue processes unsent notifications from the queue (called at startup)
 func (n *NotifyModule) ProcessQueue(ctx context.Context) error {
+	notifyIDs, err := n.queuedNotificationIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Process each unsent notification
+	for _, notifyID := range notifyIDs {
+		if err := n.forwardNotification(ctx, notifyID); err != nil {
+			// Log error but continue processing other notifications
+			continue
+		}
+	}
+
+	return nil
+}
+
+// queuedNotificationIDs returns the unsent notifications ProcessQueue
+// forwards, oldest first
+func (n *NotifyModule) queuedNotificationIDs(ctx context.Context) ([]int, error) {
 	// Find all unsent notifications
 	query := `
 		SELECT id FROM pgb.pgb_notify
 		WHERE is_sent = false
+		AND cancelled_ts IS NULL
 		ORDER BY created_at ASC
 	`
 
-	rows, err := n.sourcePool.Query(ctx, query)
+	rows, err := n.sourcePool.Load().Query(ctx, query)
 	if err != nil {
-		return fmt.Errorf("failed to query unsent notifications: %w", err)
+		return nil, fmt.Errorf("failed to query unsent notifications: %w", err)
 	}
 	defer rows.Close()
 
@@ -265,47 +339,134 @@ func (n *NotifyModule) ProcessQueue(ctx context.Context) error {
 	for rows.Next() {
 		var id int
 		if err := rows.Scan(&id); err != nil {
-			return fmt.Errorf("failed to scan notification ID: %w", err)
+			return nil, fmt.Errorf("failed to scan notification ID: %w", err)
 		}
 		notifyIDs = append(notifyIDs, id)
 	}
 
 	if err := rows.Err(); err != nil {
-		return fmt.Errorf("error iterating notification rows: %w", err)
+		return nil, fmt.Errorf("error iterating notification rows: %w", err)
 	}
 
-	// Process each unsent notification
-	for _, notifyID := range notifyIDs {
-		if err := n.forwardNotification(ctx, notifyID); err != nil {
-			// Log error but continue processing other notifications
-			continue
+	return notifyIDs, nil
+}
+
+// QueuedItems returns the payloads of the notifications ProcessQueue would
+// forward, so they can be handed to the worker pool instead
+func (n *NotifyModule) QueuedItems(ctx context.Context) ([]string, error) {
+	notifyIDs, err := n.queuedNotificationIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := make([]string, 0, len(notifyIDs))
+	for _, id := range notifyIDs {
+		payloads = append(payloads, strconv.Itoa(id))
+	}
+	return payloads, nil
+}
+
+// PendingItems returns the IDs of unsent notifications created more than
+// olderThan ago
+func (n *NotifyModule) PendingItems(ctx context.Context, olderThan time.Duration) ([]string, error) {
+	query := `
+		SELECT id FROM pgb.pgb_notify
+		WHERE is_sent = false
+		AND cancelled_ts IS NULL
+		AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+		ORDER BY created_at ASC
+	`
+
+	rows, err := n.sourcePool.Load().Query(ctx, query, olderThan.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var payloads []string
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan notification ID: %w", err)
 		}
+		payloads = append(payloads, strconv.Itoa(id))
 	}
 
-	return nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notification rows: %w", err)
+	}
+
+	return payloads, nil
 }
 
-// forwardNotification retrieves a notification and sends it to central database
+// QueueDepth returns the number of unsent notifications that were not
+// cancelled
+func (n *NotifyModule) QueueDepth(ctx context.Context) (int, error) {
+	var depth int
+	err := n.sourcePool.Load().QueryRow(ctx, `
+		SELECT COUNT(*) FROM pgb.pgb_notify
+		WHERE is_sent = false
+		AND cancelled_ts IS NULL
+	`).Scan(&depth)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unsent notifications: %w", err)
+	}
+
+	return depth, nil
+}
+
+// forwardNotification claims a notification, inserts it into the central
+// database and marks it as sent. The claim is committed before the insert,
+// so no row lock or transaction is held on the source meanwhile, and a
+// notification that another worker or instance is forwarding is skipped
+// instead of forwarded twice.
 func (n *NotifyModule) forwardNotification(ctx context.Context, notifyID int) error {
-	// Retrieve notification from source database
-	notification, err := n.getNotification(ctx, notifyID)
+	notification, err := n.claimNotification(ctx, notifyID)
 	if err != nil {
-		notifyErr := fmt.Errorf("failed to retrieve notification %d: %w", notifyID, err)
+		notifyErr := fmt.Errorf("failed to claim notification %d: %w", notifyID, err)
+		metrics.NotifyFailed.WithLabelValues(n.sourceName).Inc()
 		if n.logger != nil {
 			n.logger.LogNotifyFailed(n.sourceName, notifyID, notifyErr)
 		}
 		return notifyErr
 	}
 
-	// Check if already sent
-	if notification.IsSent {
-		return nil // Already sent
+	// Not claimed: sent, cancelled or being forwarded
+	if notification == nil {
+		notification, err = n.getNotification(ctx, notifyID)
+		if err != nil {
+			notifyErr := fmt.Errorf("failed to retrieve notification %d: %w", notifyID, err)
+			metrics.NotifyFailed.WithLabelValues(n.sourceName).Inc()
+			if n.logger != nil {
+				n.logger.LogNotifyFailed(n.sourceName, notifyID, notifyErr)
+			}
+			return notifyErr
+		}
+
+		switch {
+		case notification.IsSent:
+		case notification.CancelledTS != nil:
+			// Cancelled notifications are never forwarded
+			if n.logger != nil {
+				n.logger.LogSystemf(logger.LevelInfo, "notify", "Skipping cancelled notification_id=%d", notifyID)
+			}
+		default:
+			// e.g. by both the listener and the queue sweep
+			if n.logger != nil {
+				n.logger.LogSystemf(logger.LevelDebug, "notify", "Skipping notification_id=%d, it is being forwarded already", notifyID)
+			}
+		}
+		return nil
 	}
 
 	// Insert into central database
 	centralID, err := n.insertToCentral(ctx, notification)
 	if err != nil {
 		insertErr := fmt.Errorf("failed to insert to central database: %w", err)
+		n.recordOutcome(ctx, func(ctx context.Context, q modules.Querier) error {
+			return n.releaseNotification(ctx, q, notifyID)
+		})
+		metrics.NotifyFailed.WithLabelValues(n.sourceName).Inc()
 		if n.logger != nil {
 			n.logger.LogNotifyFailed(n.sourceName, notifyID, insertErr)
 		}
@@ -313,14 +474,19 @@ func (n *NotifyModule) forwardNotification(ctx context.Context, notifyID int) er
 	}
 
 	// Mark as sent in source database
-	if err := n.markAsSent(ctx, notifyID); err != nil {
+	err = n.recordOutcome(ctx, func(ctx context.Context, q modules.Querier) error {
+		return n.markAsSent(ctx, q, notifyID)
+	})
+	if err != nil {
 		markErr := fmt.Errorf("failed to mark as sent: %w", err)
+		metrics.NotifyFailed.WithLabelValues(n.sourceName).Inc()
 		if n.logger != nil {
 			n.logger.LogNotifyFailed(n.sourceName, notifyID, markErr)
 		}
 		return markErr
 	}
 
+	metrics.NotifyForwarded.WithLabelValues(n.sourceName).Inc()
 	if n.logger != nil {
 		n.logger.LogNotifyForwarded(n.sourceName, notifyID, centralID)
 	}
@@ -328,18 +494,67 @@ func (n *NotifyModule) forwardNotification(ctx context.Context, notifyID int) er
 	return nil
 }
 
+// recordOutcome records what came of forwarding on the source database
+// with its own deadline: the job's context may have ended meanwhile, and a
+// forwarded notification that is not marked is forwarded again
+func (n *NotifyModule) recordOutcome(ctx context.Context, record func(ctx context.Context, q modules.Querier) error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+
+	return record(ctx, n.sourcePool.Load())
+}
+
+// notificationColumns are the columns scanned by queryNotification
+const notificationColumns = `
+		id, user_email, sender_db, COALESCE(message, ''),
+		COALESCE(message_link, ''), criticality,
+		is_sent, sent_ts, created_at, cancelled_ts`
+
+// notificationQuery selects a notification by id
+const notificationQuery = `SELECT` + notificationColumns + `
+		FROM pgb.pgb_notify
+		WHERE id = $1`
+
+// claimNotificationQuery marks an unsent notification as being forwarded
+// and returns it, unless another claim younger than claimTimeout ($2
+// seconds) exists or another transaction holds the row
+const claimNotificationQuery = `
+		UPDATE pgb.pgb_notify
+		SET claimed_ts = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM pgb.pgb_notify
+			WHERE id = $1
+			AND is_sent = false
+			AND cancelled_ts IS NULL
+			AND (claimed_ts IS NULL OR claimed_ts < CURRENT_TIMESTAMP - make_interval(secs => $2))
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING` + notificationColumns
+
 // getNotification retrieves a notification from the source database
 func (n *NotifyModule) getNotification(ctx context.Context, notifyID int) (*Notification, error) {
-	query := `
-		SELECT id, user_email, sender_db, COALESCE(message, ''),
-		       COALESCE(message_link, ''), criticality,
-		       is_sent, sent_ts, created_at
-		FROM pgb.pgb_notify
-		WHERE id = $1
-	`
+	return n.queryNotification(ctx, n.sourcePool.Load(), notificationQuery, notifyID)
+}
+
+// claimNotification marks a notification as being forwarded and returns
+// it. It returns nil without an error if the notification is missing,
+// sent, cancelled or claimed by another worker or instance. Claims of
+// workers that stopped while forwarding expire after claimTimeout.
+func (n *NotifyModule) claimNotification(ctx context.Context, notifyID int) (*Notification, error) {
+	notification, err := n.queryNotification(ctx, n.sourcePool.Load(), claimNotificationQuery, notifyID, claimTimeout.Seconds())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return notification, err
+}
+
+// queryNotification runs a notification query and scans the result
+func (n *NotifyModule) queryNotification(ctx context.Context, q modules.Querier, query string, notifyID int, args ...interface{}) (*Notification, error) {
+	ctx, span := tracing.Start(ctx, "pgb_notify getNotification", tracing.Database(n.sourceName), tracing.Module(moduleName), tracing.RowID(notifyID))
+	defer span.End()
 
 	notification := &Notification{}
-	err := n.sourcePool.QueryRow(ctx, query, notifyID).Scan(
+	err := q.QueryRow(ctx, query, append([]interface{}{notifyID}, args...)...).Scan(
 		&notification.ID,
 		&notification.UserEmail,
 		&notification.SenderDB,
@@ -349,10 +564,11 @@ func (n *NotifyModule) getNotification(ctx context.Context, notifyID int) (*Noti
 		&notification.IsSent,
 		&notification.SentTS,
 		&notification.CreatedAt,
+		&notification.CancelledTS,
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to query notification: %w", err)
+		return nil, tracing.Fail(span, fmt.Errorf("failed to query notification: %w", err))
 	}
 
 	return notification, nil
@@ -360,6 +576,9 @@ func (n *NotifyModule) getNotification(ctx context.Context, notifyID int) (*Noti
 
 // insertToCentral inserts a notification into the central database
 func (n *NotifyModule) insertToCentral(ctx context.Context, notification *Notification) (int, error) {
+	ctx, span := tracing.Start(ctx, "pgb_notify insertToCentral", tracing.Database(n.sourceName), tracing.Module(moduleName), tracing.RowID(notification.ID))
+	defer span.End()
+
 	query := `
 		INSERT INTO public.ps_notifications (
 			user_email,
@@ -384,23 +603,24 @@ func (n *NotifyModule) insertToCentral(ctx context.Context, notification *Notifi
 	).Scan(&centralID)
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert into central database: %w", err)
+		return 0, tracing.Fail(span, fmt.Errorf("failed to insert into central database: %w", err))
 	}
 
 	return centralID, nil
 }
 
 // markAsSent updates the notification record as successfully sent
-func (n *NotifyModule) markAsSent(ctx context.Context, notifyID int) error {
+func (n *NotifyModule) markAsSent(ctx context.Context, q modules.Querier, notifyID int) error {
 	query := `
 		UPDATE pgb.pgb_notify
 		SET is_sent = true,
 		    sent_ts = CURRENT_TIMESTAMP,
+		    claimed_ts = NULL,
 		    updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1
 	`
 
-	_, err := n.sourcePool.Exec(ctx, query, notifyID)
+	_, err := q.Exec(ctx, query, notifyID)
 	if err != nil {
 		return fmt.Errorf("failed to mark notification as sent: %w", err)
 	}
@@ -408,3 +628,55 @@ func (n *NotifyModule) markAsSent(ctx context.Context, notifyID int) error {
 	return nil
 }
 
+// releaseNotification drops the claim of a notification that could not be
+// forwarded
+func (n *NotifyModule) releaseNotification(ctx context.Context, q modules.Querier, notifyID int) error {
+	query := `
+		UPDATE pgb.pgb_notify
+		SET claimed_ts = NULL
+		WHERE id = $1
+	`
+
+	_, err := q.Exec(ctx, query, notifyID)
+	return err
+}
+
+// cancelNotification marks an unsent notification as cancelled;
+// notifications already forwarded are left untouched
+func (n *NotifyModule) cancelNotification(ctx context.Context, notifyID int) error {
+	cancelled, err := n.cancelNotifications(ctx, []int{notifyID})
+	if err != nil {
+		return fmt.Errorf("failed to cancel notification %d: %w", notifyID, err)
+	}
+
+	if n.logger != nil {
+		if len(cancelled) == 0 {
+			n.logger.LogSystemf(logger.LevelWarn, "notify", "Notification notification_id=%d not cancelled: already sent, cancelled or missing", notifyID)
+		} else {
+			n.logger.LogSystemf(logger.LevelInfo, "notify", "Cancelled notification_id=%d", notifyID)
+		}
+	}
+
+	return nil
+}
+
+// cancelNotifications marks the unsent notifications among ids as
+// cancelled and returns the ids that were cancelled
+func (n *NotifyModule) cancelNotifications(ctx context.Context, ids []int) ([]int, error) {
+	query := `
+		UPDATE pgb.pgb_notify
+		SET cancelled_ts = CURRENT_TIMESTAMP,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($1)
+		AND is_sent = false
+		AND cancelled_ts IS NULL
+		RETURNING id
+	`
+
+	rows, err := n.sourcePool.Load().Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return modules.CollectIDs(rows)
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/database"
+	"pgbridge/internal/modules"
 )
 
 func getTestPools(t *testing.T) (*pgxpool.Pool, *pgxpool.Pool) {
@@ -39,6 +41,7 @@ func cleanupTables(t *testing.T, sourcePool, centralPool *pgxpool.Pool) {
 	queries := []string{
 		"DROP TABLE IF EXISTS pgb.pgb_notify CASCADE",
 		"DROP TABLE IF EXISTS public.ps_notifications CASCADE",
+		"DELETE FROM pgb.pgb_schema_version WHERE component = 'pgb_notify'",
 	}
 
 	for _, query := range queries {
@@ -47,6 +50,22 @@ func cleanupTables(t *testing.T, sourcePool, centralPool *pgxpool.Pool) {
 	}
 }
 
+// migrate applies the module's migrations, as addModule does after
+// Initialize
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := database.NewMigrator(pool, "test_db", nil).Up(ctx, moduleName, migrations)
+	return err
+}
+
+// initialize creates the module's tables as addModule does: Initialize,
+// then the migrations
+func initialize(ctx context.Context, module *NotifyModule, pool *pgxpool.Pool) error {
+	if err := module.Initialize(ctx, pool); err != nil {
+		return err
+	}
+	return migrate(ctx, pool)
+}
+
 func createCentralTable(t *testing.T, centralPool *pgxpool.Pool) {
 	ctx := context.Background()
 	query := `
@@ -160,7 +179,7 @@ func TestNotifyModule_CreateNotification(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := module.Initialize(ctx, sourcePool)
+	err := initialize(ctx, module, sourcePool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -215,7 +234,7 @@ func TestNotifyModule_ForwardNotification(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := module.Initialize(ctx, sourcePool)
+	err := initialize(ctx, module, sourcePool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -277,6 +296,80 @@ func TestNotifyModule_ForwardNotification(t *testing.T) {
 	}
 }
 
+func TestNotifyModule_ForwardSkipsClaimed(t *testing.T) {
+	sourcePool, centralPool := getTestPools(t)
+	defer sourcePool.Close()
+	defer centralPool.Close()
+
+	cleanupTables(t, sourcePool, centralPool)
+	defer cleanupTables(t, sourcePool, centralPool)
+
+	createCentralTable(t, centralPool)
+
+	module := NewNotifyModule(sourcePool, centralPool, "test_db", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := initialize(ctx, module, sourcePool); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var notifyID int
+	err := sourcePool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_notify (user_email, sender_db, message)
+		VALUES ('user@example.com', 'test_db', 'Test notification')
+		RETURNING id
+	`).Scan(&notifyID)
+	if err != nil {
+		t.Fatalf("Failed to insert notification: %v", err)
+	}
+
+	// Another worker holds the notification
+	tx, err := sourcePool.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "SELECT id FROM pgb.pgb_notify WHERE id = $1 FOR UPDATE", notifyID); err != nil {
+		t.Fatalf("Failed to lock notification: %v", err)
+	}
+
+	if err := module.forwardNotification(ctx, notifyID); err != nil {
+		t.Errorf("Expected a claimed notification to be skipped, got: %v", err)
+	}
+	tx.Rollback(ctx)
+
+	var forwarded int
+	centralPool.QueryRow(ctx, "SELECT count(*) FROM public.ps_notifications WHERE original_id = $1", notifyID).Scan(&forwarded)
+	if forwarded != 0 {
+		t.Errorf("Expected the claimed notification not to be forwarded, got %d rows", forwarded)
+	}
+
+	// A committed claim of another worker is skipped as well
+	if _, err := sourcePool.Exec(ctx, "UPDATE pgb.pgb_notify SET claimed_ts = CURRENT_TIMESTAMP WHERE id = $1", notifyID); err != nil {
+		t.Fatalf("Failed to claim notification: %v", err)
+	}
+	if err := module.forwardNotification(ctx, notifyID); err != nil {
+		t.Errorf("Expected a claimed notification to be skipped, got: %v", err)
+	}
+	centralPool.QueryRow(ctx, "SELECT count(*) FROM public.ps_notifications WHERE original_id = $1", notifyID).Scan(&forwarded)
+	if forwarded != 0 {
+		t.Errorf("Expected the claimed notification not to be forwarded, got %d rows", forwarded)
+	}
+
+	// Once the claim expired it is forwarded
+	if _, err := sourcePool.Exec(ctx, "UPDATE pgb.pgb_notify SET claimed_ts = CURRENT_TIMESTAMP - make_interval(secs => $2) WHERE id = $1", notifyID, (claimTimeout + time.Minute).Seconds()); err != nil {
+		t.Fatalf("Failed to age claim: %v", err)
+	}
+	if err := module.forwardNotification(ctx, notifyID); err != nil {
+		t.Fatalf("forwardNotification failed: %v", err)
+	}
+	centralPool.QueryRow(ctx, "SELECT count(*) FROM public.ps_notifications WHERE original_id = $1", notifyID).Scan(&forwarded)
+	if forwarded != 1 {
+		t.Errorf("Expected the notification to be forwarded once, got %d rows", forwarded)
+	}
+}
+
 func TestNotifyModule_ProcessQueue(t *testing.T) {
 	sourcePool, centralPool := getTestPools(t)
 	defer sourcePool.Close()
@@ -291,7 +384,7 @@ func TestNotifyModule_ProcessQueue(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := module.Initialize(ctx, sourcePool)
+	err := initialize(ctx, module, sourcePool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -356,7 +449,7 @@ func TestNotifyModule_ProcessNotification(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := module.Initialize(ctx, sourcePool)
+	err := initialize(ctx, module, sourcePool)
 	if err != nil {
 		t.Fatalf("Initialize failed: %v", err)
 	}
@@ -375,7 +468,7 @@ func TestNotifyModule_ProcessNotification(t *testing.T) {
 
 	// Process the notification via NOTIFY simulation
 	payload := fmt.Sprintf("%d", notifyID)
-	err = module.ProcessNotification(ctx, payload)
+	err = modules.Handler(module)(ctx, payload)
 	if err != nil {
 		t.Fatalf("ProcessNotification failed: %v", err)
 	}
@@ -398,14 +491,64 @@ func TestNotifyModule_ProcessNotification(t *testing.T) {
 func TestNotifyModule_ProcessNotificationInvalidPayload(t *testing.T) {
 	module := NewNotifyModule(nil, nil, "test_db", nil)
 	ctx := context.Background()
+	handler := modules.Handler(module)
 
-	err := module.ProcessNotification(ctx, "invalid")
+	err := handler(ctx, "invalid")
 	if err == nil {
 		t.Error("Expected error for invalid payload")
 	}
 
-	err = module.ProcessNotification(ctx, "not_a_number")
+	err = handler(ctx, "not_a_number")
 	if err == nil {
 		t.Error("Expected error for non-numeric payload")
 	}
 }
+
+func TestNotifyModule_ProcessNotificationCancel(t *testing.T) {
+	sourcePool, centralPool := getTestPools(t)
+	defer sourcePool.Close()
+	defer centralPool.Close()
+
+	cleanupTables(t, sourcePool, centralPool)
+	defer cleanupTables(t, sourcePool, centralPool)
+
+	createCentralTable(t, centralPool)
+
+	module := NewNotifyModule(sourcePool, centralPool, "test_db", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := initialize(ctx, module, sourcePool); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	var notifyID int
+	err := sourcePool.QueryRow(ctx, `
+		INSERT INTO pgb.pgb_notify (user_email, sender_db, message, criticality)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, "user@example.com", "test_db", "Test notification", 1).Scan(&notifyID)
+	if err != nil {
+		t.Fatalf("Failed to insert notification: %v", err)
+	}
+
+	handler := modules.Handler(module)
+	if err := handler(ctx, fmt.Sprintf(`{"id": %d, "op": "cancel"}`, notifyID)); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if err := handler(ctx, fmt.Sprintf(`{"id": %d, "op": "update"}`, notifyID)); err != nil {
+		t.Fatalf("Update of a cancelled notification failed: %v", err)
+	}
+
+	var isSent bool
+	sourcePool.QueryRow(ctx, `SELECT is_sent FROM pgb.pgb_notify WHERE id = $1`, notifyID).Scan(&isSent)
+	if isSent {
+		t.Error("Expected a cancelled notification not to be forwarded")
+	}
+
+	var centralCount int
+	centralPool.QueryRow(ctx, `SELECT COUNT(*) FROM public.ps_notifications WHERE original_id = $1`, notifyID).Scan(&centralCount)
+	if centralCount != 0 {
+		t.Errorf("Expected no central notification, got %d", centralCount)
+	}
+}
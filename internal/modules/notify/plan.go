@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"pgbridge/internal/database"
+	"pgbridge/internal/modules"
+)
+
+// notifyTable is the queue table
+var notifyTable = database.SchemaObject{Kind: database.ObjectTable, Schema: "pgb", Name: "pgb_notify"}
+
+// schemaObjects are the objects created by Initialize and the migrations
+// on the source database
+var schemaObjects = []database.SchemaObject{
+	notifyTable,
+	{Kind: database.ObjectColumn, Schema: "pgb", Table: "pgb_notify", Name: "cancelled_ts"},
+	{Kind: database.ObjectColumn, Schema: "pgb", Table: "pgb_notify", Name: "claimed_ts"},
+	{Kind: database.ObjectIndex, Schema: "pgb", Table: "pgb_notify", Name: "idx_pgb_notify_is_sent"},
+	{Kind: database.ObjectIndex, Schema: "pgb", Table: "pgb_notify", Name: "idx_pgb_notify_user_email"},
+	{Kind: database.ObjectIndex, Schema: "pgb", Table: "pgb_notify", Name: "idx_pgb_notify_created_at"},
+	{Kind: database.ObjectFunction, Schema: "pgb", Name: "trg_pgb_send_notification", Replaced: true},
+	{
+		Kind: database.ObjectTrigger, Schema: "pgb", Table: "pgb_notify", Name: "S01_send_notification", Replaced: true,
+		Timing: "AFTER", Events: "INSERT", Function: "pgb.trg_pgb_send_notification",
+	},
+}
+
+// Plan reports the objects Initialize creates and the notifications
+// ProcessQueue would forward. Like Initialize it fails if the central
+// table is missing.
+func (n *NotifyModule) Plan(ctx context.Context) (*modules.Plan, error) {
+	if err := n.verifyCentralTable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to verify central table: %w", err)
+	}
+
+	plan := &modules.Plan{Objects: schemaObjects}
+
+	// Nothing is queued before the table exists
+	exists, err := database.ObjectExists(ctx, n.sourcePool.Load(), notifyTable)
+	if err != nil || !exists {
+		return plan, err
+	}
+
+	if plan.Queued, err = n.QueuedItems(ctx); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,173 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"pgbridge/internal/modules"
+)
+
+// notifyStatusConditions maps each queue status to its condition on
+// pgb.pgb_notify. Forwarding failures are not recorded in the table, so
+// there is no failed status.
+var notifyStatusConditions = map[string]string{
+	modules.QueueStatusPending:   "is_sent = false AND cancelled_ts IS NULL",
+	modules.QueueStatusSent:      "is_sent = true",
+	modules.QueueStatusCancelled: "is_sent = false AND cancelled_ts IS NOT NULL",
+}
+
+// notifyItemColumns selects a pgb.pgb_notify row in the order scanned by
+// scanNotifyItem
+const notifyItemColumns = `
+	id,
+	CASE
+		WHEN is_sent THEN 'sent'
+		WHEN cancelled_ts IS NOT NULL THEN 'cancelled'
+		ELSE 'pending'
+	END,
+	user_email, COALESCE(message, ''), created_at, sent_ts, cancelled_ts,
+	sender_db, COALESCE(message_link, ''), criticality
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanNotifyItem reads a row selected with notifyItemColumns
+func scanNotifyItem(row rowScanner) (*modules.QueueItem, error) {
+	item := &modules.QueueItem{}
+	var senderDB, link string
+	var criticality int
+
+	err := row.Scan(
+		&item.ID,
+		&item.Status,
+		&item.Recipient,
+		&item.Summary,
+		&item.CreatedAt,
+		&item.SentAt,
+		&item.CancelledAt,
+		&senderDB,
+		&link,
+		&criticality,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Details = map[string]string{
+		"sender_db":   senderDB,
+		"criticality": strconv.Itoa(criticality),
+	}
+	if link != "" {
+		item.Details["message_link"] = link
+	}
+
+	return item, nil
+}
+
+// ListItems returns the notifications matching the filter
+func (n *NotifyModule) ListItems(ctx context.Context, filter modules.QueueFilter) ([]modules.QueueItem, error) {
+	clause, args, err := filter.Where(notifyStatusConditions, "user_email")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := n.sourcePool.Load().Query(ctx, "SELECT"+notifyItemColumns+"FROM pgb.pgb_notify"+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	items := []modules.QueueItem{}
+	for rows.Next() {
+		item, err := scanNotifyItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read notification: %w", err)
+		}
+		items = append(items, *item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+
+	return items, nil
+}
+
+// GetItem returns one notification
+func (n *NotifyModule) GetItem(ctx context.Context, id int) (*modules.QueueItem, error) {
+	row := n.sourcePool.Load().QueryRow(ctx, "SELECT"+notifyItemColumns+"FROM pgb.pgb_notify WHERE id = $1", id)
+
+	item, err := scanNotifyItem(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification %d: %w", id, err)
+	}
+
+	return item, nil
+}
+
+// RequeueItems notifies the channel again for the unsent notifications
+// among ids; there is no failure state to reset
+func (n *NotifyModule) RequeueItems(ctx context.Context, ids []int) ([]int, error) {
+	tx, err := n.sourcePool.Load().Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT id FROM pgb.pgb_notify
+		WHERE id = ANY($1)
+		AND is_sent = false
+		AND cancelled_ts IS NULL
+		ORDER BY id
+		FOR UPDATE
+	`
+
+	rows, err := tx.Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select notifications: %w", err)
+	}
+	requeued, err := modules.CollectIDs(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select notifications: %w", err)
+	}
+
+	if err := modules.Renotify(ctx, tx, channelName, requeued); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit requeue: %w", err)
+	}
+
+	return requeued, nil
+}
+
+// CancelItems cancels the unsent notifications among ids
+func (n *NotifyModule) CancelItems(ctx context.Context, ids []int) ([]int, error) {
+	cancelled, err := n.cancelNotifications(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel notifications: %w", err)
+	}
+
+	return cancelled, nil
+}
+
+// PurgeSent deletes notifications forwarded more than days ago
+func (n *NotifyModule) PurgeSent(ctx context.Context, days int) (int64, error) {
+	query := `
+		DELETE FROM pgb.pgb_notify
+		WHERE is_sent = true
+		AND sent_ts < CURRENT_TIMESTAMP - make_interval(days => $1)
+	`
+
+	tag, err := n.sourcePool.Load().Exec(ctx, query, days)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge sent notifications: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
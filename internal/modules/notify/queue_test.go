@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"pgbridge/internal/modules"
+)
+
+func TestNotifyModule_Queue(t *testing.T) {
+	sourcePool, centralPool := getTestPools(t)
+	defer sourcePool.Close()
+	defer centralPool.Close()
+
+	cleanupTables(t, sourcePool, centralPool)
+	defer cleanupTables(t, sourcePool, centralPool)
+
+	// The queue only needs the source database
+	module := NewNotifyModule(sourcePool, nil, "test_db", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := module.createNotificationTable(ctx); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := migrate(ctx, sourcePool); err != nil {
+		t.Fatalf("Failed to migrate table: %v", err)
+	}
+
+	insert := func(email string, sentDaysAgo int) int {
+		var id int
+		err := sourcePool.QueryRow(ctx, `
+			INSERT INTO pgb.pgb_notify (user_email, sender_db, message, criticality, is_sent, sent_ts)
+			VALUES ($1, 'test_db', 'Test notification', 2,
+			        $2 > 0, CASE WHEN $2 > 0 THEN CURRENT_TIMESTAMP - make_interval(days => $2) END)
+			RETURNING id
+		`, email, sentDaysAgo).Scan(&id)
+		if err != nil {
+			t.Fatalf("Failed to insert notification: %v", err)
+		}
+		return id
+	}
+
+	pendingID := insert("alice@example.com", 0)
+	otherID := insert("bob@example.com", 0)
+	oldSentID := insert("alice@example.com", 10)
+
+	pending, err := module.ListItems(ctx, modules.QueueFilter{Status: modules.QueueStatusPending, Recipient: "alice"})
+	if err != nil {
+		t.Fatalf("ListItems failed: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != pendingID || pending[0].Details["criticality"] != "2" {
+		t.Errorf("Expected alice's pending notification, got %+v", pending)
+	}
+
+	requeued, err := module.RequeueItems(ctx, []int{pendingID, oldSentID})
+	if err != nil {
+		t.Fatalf("RequeueItems failed: %v", err)
+	}
+	if len(requeued) != 1 || requeued[0] != pendingID {
+		t.Errorf("Expected only the pending notification to be requeued, got %v", requeued)
+	}
+
+	cancelled, err := module.CancelItems(ctx, []int{otherID})
+	if err != nil {
+		t.Fatalf("CancelItems failed: %v", err)
+	}
+	if len(cancelled) != 1 {
+		t.Errorf("Expected the notification to be cancelled, got %v", cancelled)
+	}
+	item, err := module.GetItem(ctx, otherID)
+	if err != nil {
+		t.Fatalf("GetItem failed: %v", err)
+	}
+	if item.Status != modules.QueueStatusCancelled || item.CancelledAt == nil {
+		t.Errorf("Expected a cancelled item, got %+v", item)
+	}
+
+	purged, err := module.PurgeSent(ctx, 7)
+	if err != nil {
+		t.Fatalf("PurgeSent failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected 1 notification purged, got %d", purged)
+	}
+}
+
+func TestNotifyModule_QueueNoFailedStatus(t *testing.T) {
+	module := NewNotifyModule(nil, nil, "test_db", nil)
+
+	_, err := module.ListItems(context.Background(), modules.QueueFilter{Status: modules.QueueStatusFailed})
+	if !errors.Is(err, modules.ErrUnsupportedStatus) {
+		t.Errorf("Expected ErrUnsupportedStatus, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package pause
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/database"
+	"pgbridge/internal/logger"
+	"pgbridge/internal/modules"
+)
+
+const (
+	moduleName  = "pgb_control"
+	channelName = "pgb_control"
+)
+
+const (
+	// Pause state per module; rows survive restarts
+	createControlTableSQL = `
+		CREATE TABLE IF NOT EXISTS pgb.pgb_control (
+			module_name VARCHAR(50) PRIMARY KEY,
+			is_paused BOOLEAN DEFAULT false NOT NULL,
+			reason TEXT,
+			changed_by VARCHAR(100),
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		COMMENT ON TABLE pgb.pgb_control IS 'Runtime control of pgbridge modules';
+		COMMENT ON COLUMN pgb.pgb_control.is_paused IS 'Whether notifications of the module are deferred until it is resumed';`
+
+	// Trigger function notifying the control channel with the module whose
+	// state changed
+	createNotifyFunctionSQL = `
+		CREATE OR REPLACE FUNCTION pgb.trg_pgb_control_notify()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				PERFORM pg_notify('pgb_control', OLD.module_name);
+			ELSE
+				PERFORM pg_notify('pgb_control', NEW.module_name);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;`
+
+	dropTriggerSQL   = `DROP TRIGGER IF EXISTS S01_pgb_control_notify ON pgb.pgb_control;`
+	createTriggerSQL = `
+		CREATE TRIGGER S01_pgb_control_notify
+		AFTER INSERT OR UPDATE OR DELETE ON pgb.pgb_control
+		FOR EACH ROW
+		EXECUTE FUNCTION pgb.trg_pgb_control_notify();`
+
+	upsertStateSQL = `
+		INSERT INTO pgb.pgb_control (module_name, is_paused, reason, changed_by, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), CURRENT_TIMESTAMP)
+		ON CONFLICT (module_name) DO UPDATE SET
+			is_paused = EXCLUDED.is_paused,
+			reason = EXCLUDED.reason,
+			changed_by = EXCLUDED.changed_by,
+			updated_at = EXCLUDED.updated_at;`
+)
+
+// controlTable is the table holding the pause state
+var controlTable = database.SchemaObject{Kind: database.ObjectTable, Schema: "pgb", Name: "pgb_control"}
+
+// schemaObjects are the objects created by Initialize
+var schemaObjects = []database.SchemaObject{
+	controlTable,
+	{Kind: database.ObjectFunction, Schema: "pgb", Name: "trg_pgb_control_notify", Replaced: true},
+	{
+		Kind: database.ObjectTrigger, Schema: "pgb", Table: "pgb_control", Name: "S01_pgb_control_notify", Replaced: true,
+		Timing: "AFTER", Events: "INSERT OR UPDATE OR DELETE", Function: "pgb.trg_pgb_control_notify",
+	},
+}
+
+// State is the pause state of a module on one database
+type State struct {
+	Module    string    `json:"module"`
+	Paused    bool      `json:"paused"`
+	Reason    string    `json:"reason,omitempty"`
+	ChangedBy string    `json:"changed_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PauseModule owns pgb.pgb_control on a source database and calls back
+// when a module is paused or resumed there. It is started with every
+// database, whatever its configured modules.
+type PauseModule struct {
+	onChange func(ctx context.Context)
+	logger   *logger.Logger
+}
+
+// NewPauseModule creates a new pause module; onChange is called with the
+// notification's context for every change of the control table and must
+// reload the states with Load
+func NewPauseModule(onChange func(ctx context.Context), log *logger.Logger) *PauseModule {
+	return &PauseModule{
+		onChange: onChange,
+		logger:   log,
+	}
+}
+
+// Name returns the module name
+func (p *PauseModule) Name() string {
+	return moduleName
+}
+
+// GetChannelName returns the channel name to listen on
+func (p *PauseModule) GetChannelName() string {
+	return channelName
+}
+
+// Initialize creates the control table and its change trigger
+func (p *PauseModule) Initialize(ctx context.Context, pool *pgxpool.Pool) error {
+	statements := []string{
+		createControlTableSQL,
+		createNotifyFunctionSQL,
+		dropTriggerSQL,
+		createTriggerSQL,
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, stmt := range statements {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create control table: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit control table: %w", err)
+	}
+
+	return nil
+}
+
+// Plan reports the objects Initialize creates; the module has no queue
+func (p *PauseModule) Plan(ctx context.Context) (*modules.Plan, error) {
+	return &modules.Plan{Objects: schemaObjects}, nil
+}
+
+// Start begins the module's operation
+func (p *PauseModule) Start(ctx context.Context) error {
+	// Changes are picked up from notifications
+	return nil
+}
+
+// Stop stops the module
+func (p *PauseModule) Stop() error {
+	return nil
+}
+
+// ProcessNotification reports a change of the control table
+// The raw payload is the name of the paused or resumed module.
+func (p *PauseModule) ProcessNotification(ctx context.Context, n modules.Notification) error {
+	if p.logger != nil {
+		p.logger.LogSystemf(logger.LevelDebug, moduleName, "Control state changed for %s", n.Raw)
+	}
+
+	p.onChange(ctx)
+	return nil
+}
+
+// ProcessQueue reports changes made while the channel was not listened on
+func (p *PauseModule) ProcessQueue(ctx context.Context) error {
+	p.onChange(ctx)
+	return nil
+}
+
+// Load returns the pause state of every module with a row in the control
+// table, by module name; nothing is paused before the table exists
+func Load(ctx context.Context, pool *pgxpool.Pool) (map[string]State, error) {
+	states := make(map[string]State)
+
+	exists, err := database.ObjectExists(ctx, pool, controlTable)
+	if err != nil || !exists {
+		return states, err
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT module_name, is_paused, COALESCE(reason, ''), COALESCE(changed_by, ''), updated_at
+		FROM pgb.pgb_control
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load control state: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s State
+		if err := rows.Scan(&s.Module, &s.Paused, &s.Reason, &s.ChangedBy, &s.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan control state: %w", err)
+		}
+		states[s.Module] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load control state: %w", err)
+	}
+
+	return states, nil
+}
+
+// Set pauses or resumes a module; the trigger tells running instances
+func Set(ctx context.Context, pool *pgxpool.Pool, module string, paused bool, reason, changedBy string) error {
+	if _, err := pool.Exec(ctx, upsertStateSQL, module, paused, reason, changedBy); err != nil {
+		return fmt.Errorf("failed to update control state: %w", err)
+	}
+	return nil
+}
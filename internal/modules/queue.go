@@ -0,0 +1,237 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Queue item statuses
+const (
+	QueueStatusPending   = "pending"
+	QueueStatusFailed    = "failed"
+	QueueStatusSent      = "sent"
+	QueueStatusCancelled = "cancelled"
+	QueueStatusAll       = "all"
+)
+
+// QueueStatuses lists the statuses accepted by QueueFilter
+var QueueStatuses = []string{QueueStatusPending, QueueStatusFailed, QueueStatusSent, QueueStatusCancelled, QueueStatusAll}
+
+// ErrUnsupportedStatus is returned when a queue has no rows of the
+// requested status, such as failed notifications
+var ErrUnsupportedStatus = errors.New("status is not supported by this queue")
+
+// QueueItem is one row of a module's queue table
+type QueueItem struct {
+	ID           int               `json:"id"`
+	Status       string            `json:"status"`
+	Recipient    string            `json:"recipient"`
+	Summary      string            `json:"summary"`
+	RetryCount   int               `json:"retry_count"`
+	ErrorMessage string            `json:"error_message,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	SentAt       *time.Time        `json:"sent_at,omitempty"`
+	CancelledAt  *time.Time        `json:"cancelled_at,omitempty"`
+	Details      map[string]string `json:"details,omitempty"`
+}
+
+// QueueFilter selects the items returned by Queue.ListItems
+type QueueFilter struct {
+	// Status is one of QueueStatuses; empty means all
+	Status string
+
+	// Recipient matches items whose recipient contains the text
+	Recipient string
+
+	// OlderThan matches items created at least this long ago
+	OlderThan time.Duration
+
+	// Limit caps the number of items; zero means no limit
+	Limit int
+}
+
+// Queue gives access to the rows of a module's queue table, for inspecting
+// and repairing the queue from the command line
+type Queue interface {
+	// ListItems returns the items matching the filter, newest first
+	ListItems(ctx context.Context, filter QueueFilter) ([]QueueItem, error)
+
+	// GetItem returns one item, or an error if it does not exist
+	GetItem(ctx context.Context, id int) (*QueueItem, error)
+
+	// RequeueItems resets unsent items and notifies the module again;
+	// it returns the ids that were requeued
+	RequeueItems(ctx context.Context, ids []int) ([]int, error)
+
+	// CancelItems cancels unsent items; it returns the ids that were
+	// cancelled
+	CancelItems(ctx context.Context, ids []int) ([]int, error)
+
+	// PurgeSent deletes items sent more than the given number of days ago
+	// and returns how many were deleted
+	PurgeSent(ctx context.Context, days int) (int64, error)
+}
+
+// QueueFactory creates the queue of a module for one database. Unlike a
+// Factory it only needs the database's own pool, so queues can be opened
+// without starting the module.
+type QueueFactory func(pool *pgxpool.Pool, dbName string) Queue
+
+// Querier is implemented by both pgxpool.Pool and pgx.Tx
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+var (
+	queueRegistry   = make(map[string]QueueFactory)
+	queueRegistryMu sync.RWMutex
+)
+
+// RegisterQueue makes the queue of a module available under the module's
+// name. It panics under the same conditions as Register.
+func RegisterQueue(name string, factory QueueFactory) {
+	queueRegistryMu.Lock()
+	defer queueRegistryMu.Unlock()
+
+	if name == "" {
+		panic("modules: RegisterQueue with empty name")
+	}
+	if factory == nil {
+		panic("modules: RegisterQueue factory is nil for " + name)
+	}
+	if _, dup := queueRegistry[name]; dup {
+		panic("modules: RegisterQueue called twice for " + name)
+	}
+	queueRegistry[name] = factory
+}
+
+// QueueNames returns the names of the modules with a queue, sorted
+func QueueNames() []string {
+	queueRegistryMu.RLock()
+	defer queueRegistryMu.RUnlock()
+
+	names := make([]string, 0, len(queueRegistry))
+	for name := range queueRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasQueue returns whether a queue is registered for the module
+func HasQueue(name string) bool {
+	queueRegistryMu.RLock()
+	defer queueRegistryMu.RUnlock()
+
+	_, ok := queueRegistry[name]
+	return ok
+}
+
+// NewQueue opens the queue of the named module on a database
+func NewQueue(name string, pool *pgxpool.Pool, dbName string) (Queue, error) {
+	queueRegistryMu.RLock()
+	factory, ok := queueRegistry[name]
+	queueRegistryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("module '%s' has no queue (modules with a queue: %s)", name, strings.Join(QueueNames(), ", "))
+	}
+
+	return factory(pool, dbName), nil
+}
+
+// ValidateQueueStatus checks that status is one of QueueStatuses or empty
+func ValidateQueueStatus(status string) error {
+	if status == "" {
+		return nil
+	}
+	for _, s := range QueueStatuses {
+		if status == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid status '%s' (valid statuses: %s)", status, strings.Join(QueueStatuses, ", "))
+}
+
+// Where builds the WHERE, ORDER BY and LIMIT clauses for the filter.
+// conditions maps each status to its SQL condition on the queue table; a
+// status missing from the map is not supported by the table.
+func (f QueueFilter) Where(conditions map[string]string, recipientColumn string) (string, []interface{}, error) {
+	if err := ValidateQueueStatus(f.Status); err != nil {
+		return "", nil, err
+	}
+
+	var where []string
+	var args []interface{}
+
+	if f.Status != "" && f.Status != QueueStatusAll {
+		condition, ok := conditions[f.Status]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s", ErrUnsupportedStatus, f.Status)
+		}
+		where = append(where, condition)
+	}
+	if f.Recipient != "" {
+		// A plain substring match: % and _ in the filter are no wildcards
+		args = append(args, f.Recipient)
+		where = append(where, fmt.Sprintf("strpos(lower(%s), lower($%d)) > 0", recipientColumn, len(args)))
+	}
+	if f.OlderThan > 0 {
+		args = append(args, f.OlderThan.Seconds())
+		where = append(where, fmt.Sprintf("created_at < CURRENT_TIMESTAMP - make_interval(secs => $%d)", len(args)))
+	}
+
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+	clause += " ORDER BY created_at DESC, id DESC"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		clause += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	return clause, args, nil
+}
+
+// Renotify sends a notification with each id on the module's channel so
+// the running service processes the items again. Inside a transaction the
+// notifications are only delivered on commit.
+func Renotify(ctx context.Context, q Querier, channel string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := q.Exec(ctx, "SELECT pg_notify($1, id::text) FROM unnest($2::int[]) AS id", channel, ids)
+	if err != nil {
+		return fmt.Errorf("failed to notify channel %s: %w", channel, err)
+	}
+
+	return nil
+}
+
+// CollectIDs reads a single integer column from rows
+func CollectIDs(rows pgx.Rows) ([]int, error) {
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
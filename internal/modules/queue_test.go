@@ -0,0 +1,100 @@
+package modules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type testQueue struct {
+	Queue
+	dbName string
+}
+
+func TestQueueRegistry(t *testing.T) {
+	RegisterQueue("test_queue", func(pool *pgxpool.Pool, dbName string) Queue {
+		return &testQueue{dbName: dbName}
+	})
+
+	if !HasQueue("test_queue") {
+		t.Fatal("Expected test_queue to have a queue")
+	}
+
+	q, err := NewQueue("test_queue", nil, "db1")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if q.(*testQueue).dbName != "db1" {
+		t.Errorf("Expected the database name to be passed to the factory")
+	}
+
+	if _, err := NewQueue("test_queue_unknown", nil, "db1"); err == nil || !strings.Contains(err.Error(), "test_queue") {
+		t.Errorf("Expected an error listing the queues, got %v", err)
+	}
+}
+
+func TestQueueRegistry_Duplicate(t *testing.T) {
+	factory := func(pool *pgxpool.Pool, dbName string) Queue { return nil }
+	RegisterQueue("test_queue_duplicate", factory)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected RegisterQueue to panic on a duplicate name")
+		}
+	}()
+	RegisterQueue("test_queue_duplicate", factory)
+}
+
+func TestQueueFilter_Where(t *testing.T) {
+	conditions := map[string]string{
+		QueueStatusPending: "is_sent = false",
+		QueueStatusSent:    "is_sent = true",
+	}
+
+	clause, args, err := QueueFilter{}.Where(conditions, "header_to")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if clause != " ORDER BY created_at DESC, id DESC" || len(args) != 0 {
+		t.Errorf("Unexpected clause for an empty filter: %q %v", clause, args)
+	}
+
+	clause, args, err = QueueFilter{
+		Status:    QueueStatusPending,
+		Recipient: "alice",
+		OlderThan: time.Hour,
+		Limit:     10,
+	}.Where(conditions, "header_to")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := " WHERE is_sent = false AND strpos(lower(header_to), lower($1)) > 0" +
+		" AND created_at < CURRENT_TIMESTAMP - make_interval(secs => $2)" +
+		" ORDER BY created_at DESC, id DESC LIMIT $3"
+	if clause != expected {
+		t.Errorf("Expected %q, got %q", expected, clause)
+	}
+	if len(args) != 3 || args[0] != "alice" || args[1] != 3600.0 || args[2] != 10 {
+		t.Errorf("Unexpected args: %v", args)
+	}
+
+	// All statuses add no condition
+	clause, _, _ = QueueFilter{Status: QueueStatusAll}.Where(conditions, "header_to")
+	if strings.Contains(clause, "WHERE") {
+		t.Errorf("Expected no condition for all statuses, got %q", clause)
+	}
+}
+
+func TestQueueFilter_WhereStatusErrors(t *testing.T) {
+	conditions := map[string]string{QueueStatusPending: "is_sent = false"}
+
+	if _, _, err := (QueueFilter{Status: QueueStatusFailed}).Where(conditions, "to"); !errors.Is(err, ErrUnsupportedStatus) {
+		t.Errorf("Expected ErrUnsupportedStatus, got %v", err)
+	}
+	if _, _, err := (QueueFilter{Status: "stuck"}).Where(conditions, "to"); err == nil || errors.Is(err, ErrUnsupportedStatus) {
+		t.Errorf("Expected an invalid status error, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/config"
+	"pgbridge/internal/logger"
+)
+
+// Context carries everything a factory needs to create a module for one
+// database
+type Context struct {
+	// DatabaseName is the configured name of the database
+	DatabaseName string
+
+	// Pool is the connection pool of the database
+	Pool *pgxpool.Pool
+
+	// Logger is the service logger
+	Logger *logger.Logger
+
+	// CentralPool returns the shared connection pool to the central
+	// database, connecting on first use
+	CentralPool func(ctx context.Context) (*pgxpool.Pool, error)
+
+	// Options are the options configured for the module
+	Options config.ModuleOptions
+}
+
+// Factory creates a module for one database
+type Factory func(ctx context.Context, mc Context) (Module, error)
+
+var (
+	registry   = make(map[string]Factory)
+	registryMu sync.RWMutex
+)
+
+// Register makes a module available under a name, usually from the init
+// function of the module's package. It panics if the name is empty, the
+// factory is nil or the name is already registered.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" {
+		panic("modules: Register with empty name")
+	}
+	if factory == nil {
+		panic("modules: Register factory is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("modules: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// Names returns the registered module names, sorted
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsRegistered returns whether a module is registered under name
+func IsRegistered(name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	_, ok := registry[name]
+	return ok
+}
+
+// New creates a module with the factory registered under name
+func New(ctx context.Context, name string, mc Context) (Module, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown module '%s' (registered modules: %s)", name, strings.Join(Names(), ", "))
+	}
+
+	if mc.Options == nil {
+		mc.Options = config.ModuleOptions{}
+	}
+
+	module, err := factory(ctx, mc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create module %s: %w", name, err)
+	}
+
+	return module, nil
+}
+
+// Validate checks that every module of the configuration is registered
+func Validate(cfg *config.Config) error {
+	for _, db := range cfg.Databases {
+		for _, name := range db.ActiveModules {
+			if !IsRegistered(name) {
+				return fmt.Errorf("unknown module '%s' for database %s (registered modules: %s)", name, db.Name, strings.Join(Names(), ", "))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"pgbridge/internal/config"
+)
+
+type testModule struct {
+	name string
+	mc   Context
+}
+
+func (m *testModule) Name() string                                             { return m.name }
+func (m *testModule) Initialize(ctx context.Context, pool *pgxpool.Pool) error { return nil }
+func (m *testModule) Start(ctx context.Context) error                          { return nil }
+func (m *testModule) Stop() error                                              { return nil }
+func (m *testModule) GetChannelName() string                                   { return m.name }
+func (m *testModule) ProcessNotification(ctx context.Context, n Notification) error {
+	return nil
+}
+func (m *testModule) ProcessQueue(ctx context.Context) error { return nil }
+
+func TestRegistry_RegisterAndNew(t *testing.T) {
+	Register("test_registry_new", func(ctx context.Context, mc Context) (Module, error) {
+		return &testModule{name: "test_registry_new", mc: mc}, nil
+	})
+
+	if !IsRegistered("test_registry_new") {
+		t.Fatal("Expected test_registry_new to be registered")
+	}
+
+	found := false
+	for _, name := range Names() {
+		if name == "test_registry_new" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected Names to include test_registry_new, got %v", Names())
+	}
+
+	module, err := New(context.Background(), "test_registry_new", Context{
+		DatabaseName: "db1",
+		Options:      config.ModuleOptions{"workers": "2"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	mc := module.(*testModule).mc
+	if mc.DatabaseName != "db1" {
+		t.Errorf("Expected database name 'db1', got '%s'", mc.DatabaseName)
+	}
+	if mc.Options["workers"] != "2" {
+		t.Errorf("Expected options to be passed to the factory, got %v", mc.Options)
+	}
+}
+
+func TestRegistry_NewNilOptions(t *testing.T) {
+	Register("test_registry_nil_options", func(ctx context.Context, mc Context) (Module, error) {
+		if mc.Options == nil {
+			t.Error("Expected non-nil options")
+		}
+		return &testModule{name: "test_registry_nil_options"}, nil
+	})
+
+	if _, err := New(context.Background(), "test_registry_nil_options", Context{}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+}
+
+func TestRegistry_NewUnknown(t *testing.T) {
+	Register("test_registry_known", func(ctx context.Context, mc Context) (Module, error) {
+		return &testModule{name: "test_registry_known"}, nil
+	})
+
+	_, err := New(context.Background(), "pgb_calendar", Context{})
+	if err == nil {
+		t.Fatal("Expected error for unknown module")
+	}
+	if !strings.Contains(err.Error(), "pgb_calendar") || !strings.Contains(err.Error(), "test_registry_known") {
+		t.Errorf("Expected error to name the module and list registered modules, got: %v", err)
+	}
+}
+
+func TestRegistry_FactoryError(t *testing.T) {
+	Register("test_registry_error", func(ctx context.Context, mc Context) (Module, error) {
+		return nil, errors.New("no central database")
+	})
+
+	_, err := New(context.Background(), "test_registry_error", Context{})
+	if err == nil || !strings.Contains(err.Error(), "no central database") {
+		t.Errorf("Expected factory error to be returned, got: %v", err)
+	}
+}
+
+func TestRegistry_RegisterTwicePanics(t *testing.T) {
+	factory := func(ctx context.Context, mc Context) (Module, error) {
+		return &testModule{name: "test_registry_dup"}, nil
+	}
+	Register("test_registry_dup", factory)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected Register to panic on duplicate name")
+		}
+	}()
+	Register("test_registry_dup", factory)
+}
+
+func TestValidate(t *testing.T) {
+	Register("test_validate_known", func(ctx context.Context, mc Context) (Module, error) {
+		return &testModule{name: "test_validate_known"}, nil
+	})
+
+	cfg := &config.Config{Databases: []config.DatabaseConfig{
+		{Name: "River", ConnectionString: "postgres://localhost/river", ActiveModules: []string{"test_validate_known"}},
+	}}
+	if err := Validate(cfg); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	cfg.Databases[0].ActiveModules = append(cfg.Databases[0].ActiveModules, "pgb_calendar")
+	err := Validate(cfg)
+	if err == nil {
+		t.Fatal("Expected error for unknown module")
+	}
+	for _, want := range []string{"pgb_calendar", "River", "test_validate_known"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain '%s', got: %v", want, err)
+		}
+	}
+}
@@ -3,11 +3,12 @@ package roles
 import (
 	"context"
 	"fmt"
-	"strconv"
+	"sync/atomic"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"pgbridge/internal/logger"
+	"pgbridge/internal/modules"
 )
 
 const (
@@ -17,16 +18,29 @@ const (
 
 // RolesModule manages automatic role discovery for database instances
 type RolesModule struct {
-	centralPool *pgxpool.Pool
+	centralPool atomic.Pointer[pgxpool.Pool]
 	logger      *logger.Logger
 }
 
+func init() {
+	modules.Register(moduleName, func(ctx context.Context, mc modules.Context) (modules.Module, error) {
+		// Enabled on the central database itself, so its pool is the central one
+		return NewRolesModule(mc.Pool, mc.Logger), nil
+	})
+}
+
 // NewRolesModule creates a new instance roles module
 func NewRolesModule(centralPool *pgxpool.Pool, log *logger.Logger) *RolesModule {
-	return &RolesModule{
-		centralPool: centralPool,
-		logger:      log,
+	r := &RolesModule{
+		logger: log,
 	}
+	r.centralPool.Store(centralPool)
+	return r
+}
+
+// SetPool replaces the pool after the connection manager reconnected
+func (r *RolesModule) SetPool(pool *pgxpool.Pool) {
+	r.centralPool.Store(pool)
 }
 
 // Name returns the module name
@@ -55,6 +69,11 @@ func (r *RolesModule) Initialize(ctx context.Context, pool *pgxpool.Pool) error
 	return nil
 }
 
+// Plan reports that the module creates nothing and has no queue
+func (r *RolesModule) Plan(ctx context.Context) (*modules.Plan, error) {
+	return &modules.Plan{}, nil
+}
+
 // Start begins the module's background operations
 func (r *RolesModule) Start(ctx context.Context) error {
 	// No background tasks needed - role discovery happens on-demand via LISTEN/NOTIFY
@@ -68,12 +87,8 @@ func (r *RolesModule) Stop() error {
 }
 
 // ProcessNotification processes a notification containing an instance_id
-func (r *RolesModule) ProcessNotification(ctx context.Context, payload string) error {
-	// Parse instance_id from payload
-	instanceID, err := strconv.Atoi(payload)
-	if err != nil {
-		return fmt.Errorf("invalid instance_id in payload: %w", err)
-	}
+func (r *RolesModule) ProcessNotification(ctx context.Context, n modules.Notification) error {
+	instanceID := n.ID
 
 	if r.logger != nil {
 		r.logger.LogSystemf(logger.LevelInfo, moduleName, "Processing role discovery for instance_id: %d", instanceID)
@@ -131,7 +146,7 @@ func (r *RolesModule) getInstance(ctx context.Context, instanceID int) (*Instanc
 	`
 
 	instance := &Instance{}
-	err := r.centralPool.QueryRow(ctx, query, instanceID).Scan(
+	err := r.centralPool.Load().QueryRow(ctx, query, instanceID).Scan(
 		&instance.ID,
 		&instance.Name,
 		&instance.ConnectionString,
@@ -201,7 +216,7 @@ func (r *RolesModule) insertRoles(ctx context.Context, instanceID int, roles []s
 
 	inserted := 0
 	for _, role := range roles {
-		result, err := r.centralPool.Exec(ctx, insertQuery, instanceID, role)
+		result, err := r.centralPool.Load().Exec(ctx, insertQuery, instanceID, role)
 		if err != nil {
 			if r.logger != nil {
 				r.logger.LogSystemf(logger.LevelWarn, moduleName, "Failed to insert role %s for instance %d: %v", role, instanceID, err)
@@ -0,0 +1,86 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Service states of the sd_notify protocol
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// Notifier sends state changes to the service manager with the sd_notify
+// protocol: newline-separated KEY=VALUE assignments in one datagram on the
+// unix socket named by $NOTIFY_SOCKET. Without a socket every call is a
+// no-op, so the service runs the same outside of systemd.
+type Notifier struct {
+	socket string
+}
+
+// NewNotifier creates a notifier for socket, usually $NOTIFY_SOCKET; names
+// starting with @ are in the abstract namespace
+func NewNotifier(socket string) *Notifier {
+	return &Notifier{socket: socket}
+}
+
+// Enabled returns whether a service manager is listening
+func (n *Notifier) Enabled() bool {
+	return n != nil && n.socket != ""
+}
+
+// Notify sends state assignments such as READY=1 in a single datagram
+func (n *Notifier) Notify(states ...string) error {
+	if !n.Enabled() {
+		return nil
+	}
+
+	name := n.socket
+	if strings.HasPrefix(name, "@") {
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return fmt.Errorf("failed to notify service manager: %w", err)
+	}
+	return nil
+}
+
+// Status sends a free-form status line shown by systemctl status
+func (n *Notifier) Status(format string, args ...interface{}) error {
+	// A status is a single line
+	status := strings.ReplaceAll(fmt.Sprintf(format, args...), "\n", " ")
+	return n.Notify("STATUS=" + status)
+}
+
+// WatchdogInterval returns how often systemd expects WATCHDOG=1, read from
+// $WATCHDOG_USEC, or 0 if the watchdog is disabled. $WATCHDOG_PID, when
+// set, must name this process.
+func WatchdogInterval() (time.Duration, error) {
+	value := os.Getenv("WATCHDOG_USEC")
+	if value == "" {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	usec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC '%s'", value)
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
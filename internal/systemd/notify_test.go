@@ -0,0 +1,97 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listen opens a notify socket like the one systemd passes in
+// $NOTIFY_SOCKET
+func listen(t *testing.T) (string, *net.UnixConn) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return path, conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to receive: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	path, conn := listen(t)
+	n := NewNotifier(path)
+
+	if err := n.Notify(StateReady, "STATUS=2 databases"); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if got := receive(t, conn); got != "READY=1\nSTATUS=2 databases" {
+		t.Errorf("Unexpected datagram %q", got)
+	}
+
+	if err := n.Status("line one\nline two"); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if got := receive(t, conn); got != "STATUS=line one line two" {
+		t.Errorf("Expected a single status line, got %q", got)
+	}
+}
+
+func TestNotifier_Disabled(t *testing.T) {
+	var n *Notifier
+	if n.Enabled() || NewNotifier("").Enabled() {
+		t.Error("Expected notifier without socket to be disabled")
+	}
+	if err := NewNotifier("").Notify(StateReady); err != nil {
+		t.Errorf("Expected no-op without socket, got %v", err)
+	}
+}
+
+func TestNotifier_MissingSocket(t *testing.T) {
+	n := NewNotifier(filepath.Join(t.TempDir(), "missing.sock"))
+	if err := n.Notify(StateReady); err == nil {
+		t.Error("Expected error for a missing socket")
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	if d, err := WatchdogInterval(); d != 0 || err != nil {
+		t.Errorf("Expected disabled watchdog, got %s, %v", d, err)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if d, err := WatchdogInterval(); d != 30*time.Second || err != nil {
+		t.Errorf("Expected 30s, got %s, %v", d, err)
+	}
+
+	// Meant for another process
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if d, _ := WatchdogInterval(); d != 0 {
+		t.Errorf("Expected watchdog of another process to be ignored, got %s", d)
+	}
+
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "soon")
+	if _, err := WatchdogInterval(); err == nil {
+		t.Error("Expected error for invalid WATCHDOG_USEC")
+	}
+}
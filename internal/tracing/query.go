@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// querySpanKey marks the span started for a query in its context
+type querySpanKey struct{}
+
+// QueryTracer creates a span for every query run inside a traced
+// operation, such as processing a notification. Queries without a
+// recording span in their context (health checks, log writes) are not
+// traced.
+type QueryTracer struct {
+	database string
+}
+
+// NewQueryTracer creates a query tracer for a configured database
+func NewQueryTracer(database string) *QueryTracer {
+	return &QueryTracer{database: database}
+}
+
+// TracePool traces the queries of a pool
+func TracePool(poolConfig *pgxpool.Config, database string) {
+	poolConfig.ConnConfig.Tracer = NewQueryTracer(database)
+}
+
+// TraceQueryStart starts the span of a query
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx
+	}
+
+	statement := strings.Join(strings.Fields(data.SQL), " ")
+	ctx, span := Start(ctx, "postgresql "+operation(statement),
+		Database(t.database),
+		attribute.String("db.system.name", "postgresql"),
+		attribute.String("db.namespace", conn.Config().Database),
+		attribute.String("db.query.text", statement),
+	)
+
+	return context.WithValue(ctx, querySpanKey{}, span)
+}
+
+// TraceQueryEnd ends the span of a query
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span, ok := ctx.Value(querySpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	if data.Err == nil {
+		span.SetAttributes(attribute.Int64("db.response.returned_rows", data.CommandTag.RowsAffected()))
+	}
+	Fail(span, data.Err)
+	span.End()
+}
+
+// operation returns the first keyword of a statement, e.g. SELECT
+func operation(statement string) string {
+	if i := strings.IndexByte(statement, ' '); i > 0 {
+		return strings.ToUpper(statement[:i])
+	}
+	return strings.ToUpper(statement)
+}
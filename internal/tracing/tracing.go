@@ -0,0 +1,170 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span exporters
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Exporters lists the supported span exporters
+var Exporters = []string{ExporterNone, ExporterOTLP, ExporterStdout, ExporterFile}
+
+// tracerName identifies the spans created by pgbridge
+const tracerName = "pgbridge"
+
+// Attribute keys shared by all spans
+const (
+	DatabaseKey = attribute.Key("pgbridge.database")
+	ModuleKey   = attribute.Key("pgbridge.module")
+	RowIDKey    = attribute.Key("pgbridge.row_id")
+	OpKey       = attribute.Key("pgbridge.op")
+)
+
+// Database is the configured name of the database a span works on
+func Database(name string) attribute.KeyValue { return DatabaseKey.String(name) }
+
+// Module is the module a span belongs to
+func Module(name string) attribute.KeyValue { return ModuleKey.String(name) }
+
+// RowID is the id of the queue row a span processes
+func RowID(id int) attribute.KeyValue { return RowIDKey.Int(id) }
+
+// Config selects where spans are exported
+type Config struct {
+	// Exporter is one of Exporters; empty means none
+	Exporter string
+
+	// Endpoint is the OTLP/HTTP endpoint URL, e.g.
+	// http://collector:4318; the OTEL_EXPORTER_OTLP_* environment
+	// variables apply when empty
+	Endpoint string
+
+	// File receives the spans of the file exporter as JSON, one per line
+	File string
+
+	ServiceName    string
+	ServiceVersion string
+}
+
+// Check validates the configuration without opening anything
+func (c Config) Check() error {
+	switch c.Exporter {
+	case "", ExporterNone, ExporterOTLP, ExporterStdout:
+	case ExporterFile:
+		if c.File == "" {
+			return fmt.Errorf("the file exporter needs a trace file")
+		}
+	default:
+		return fmt.Errorf("unknown trace exporter '%s': expected one of %s", c.Exporter, strings.Join(Exporters, ", "))
+	}
+	return nil
+}
+
+// Setup installs the global tracer provider for the configured exporter.
+// The returned function flushes pending spans and closes the exporter.
+// Without an exporter spans are not recorded and cost next to nothing.
+func Setup(ctx context.Context, cfg Config) (func(ctx context.Context) error, error) {
+	noop := func(ctx context.Context) error { return nil }
+
+	if err := cfg.Check(); err != nil {
+		return noop, err
+	}
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return noop, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		file, err = os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+		if err != nil {
+			return noop, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return noop, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", cfg.ServiceName),
+		attribute.String("service.version", cfg.ServiceVersion),
+	))
+	if err != nil {
+		res = resource.Default()
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Fail records err on span and returns it, for use in return statements
+func Fail(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Instrument wraps a notification handler in a span per notification
+// The span continues the trace of the context, e.g. the receipt of the
+// NOTIFY carried through the worker pool.
+func Instrument(database, module string, handler func(ctx context.Context, payload string) error) func(ctx context.Context, payload string) error {
+	name := module + " process"
+
+	return func(ctx context.Context, payload string) error {
+		ctx, span := Start(ctx, name, Database(database), Module(module))
+		defer span.End()
+
+		return Fail(span, handler(ctx, payload))
+	}
+}
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// record installs a provider recording spans in memory for the test
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestConfig_Check(t *testing.T) {
+	valid := []Config{
+		{},
+		{Exporter: ExporterNone},
+		{Exporter: ExporterOTLP},
+		{Exporter: ExporterStdout},
+		{Exporter: ExporterFile, File: "/tmp/traces.json"},
+	}
+	for _, cfg := range valid {
+		if err := cfg.Check(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", cfg, err)
+		}
+	}
+
+	if err := (Config{Exporter: ExporterFile}).Check(); err == nil {
+		t.Error("Expected error for file exporter without file")
+	}
+	if err := (Config{Exporter: "zipkin"}).Check(); err == nil || !strings.Contains(err.Error(), "otlp") {
+		t.Errorf("Expected error listing the exporters, got %v", err)
+	}
+}
+
+func TestSetup_FileExporter(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterFile, File: path, ServiceName: "pgbridge"})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	_, span := Start(context.Background(), "test span", Database("db1"), RowID(42))
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read trace file: %v", err)
+	}
+	var exported struct {
+		Name       string
+		Attributes []struct{ Key string }
+	}
+	if err := json.Unmarshal(data, &exported); err != nil {
+		t.Fatalf("Expected a JSON span, got %q: %v", data, err)
+	}
+	if exported.Name != "test span" || len(exported.Attributes) != 2 {
+		t.Errorf("Unexpected span %+v", exported)
+	}
+}
+
+func TestSetup_None(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	recorder := record(t)
+	failure := errors.New("smtp down")
+
+	handler := Instrument("db1", "pgb_mail", func(ctx context.Context, payload string) error {
+		_, child := Start(ctx, "pgb_mail SMTP send")
+		child.End()
+		return failure
+	})
+
+	if err := handler(context.Background(), "42"); !errors.Is(err, failure) {
+		t.Fatalf("Expected handler error, got %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	child, process := spans[0], spans[1]
+	if process.Name() != "pgb_mail process" || process.Status().Code != codes.Error {
+		t.Errorf("Expected failed process span, got %s (%v)", process.Name(), process.Status())
+	}
+	if child.Parent().SpanID() != process.SpanContext().SpanID() {
+		t.Error("Expected steps to be children of the process span")
+	}
+}
+
+func TestQueryTracer_SkipsUntracedQueries(t *testing.T) {
+	recorder := record(t)
+	tracer := NewQueryTracer("db1")
+
+	// No span in the context: health checks and log writes stay untraced
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	if len(recorder.Ended()) != 0 {
+		t.Errorf("Expected no spans, got %d", len(recorder.Ended()))
+	}
+}
+
+func TestOperation(t *testing.T) {
+	cases := map[string]string{
+		"select id from pgb.pgb_mail": "SELECT",
+		"INSERT INTO x VALUES (1)":    "INSERT",
+		"listen":                      "LISTEN",
+	}
+	for statement, want := range cases {
+		if got := operation(statement); got != want {
+			t.Errorf("operation(%q) = %q, expected %q", statement, got, want)
+		}
+	}
+}
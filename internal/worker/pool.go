@@ -0,0 +1,523 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"pgbridge/internal/logger"
+)
+
+const (
+	// DefaultWorkers is the number of concurrent workers per module
+	DefaultWorkers = 4
+	// DefaultQueueSize is the number of jobs buffered before Submit blocks
+	DefaultQueueSize = 100
+	// DefaultJobTimeout bounds the processing time of a single job
+	DefaultJobTimeout = 30 * time.Second
+
+	// abortGrace is how long Drain waits for cancelled jobs to return
+	// before giving up on them
+	abortGrace = 5 * time.Second
+	// keyTimeout bounds deriving the ordering key of a job on Submit
+	keyTimeout = 5 * time.Second
+)
+
+// ErrPoolStopped is returned by Submit after the pool has been stopped
+var ErrPoolStopped = errors.New("worker pool stopped")
+
+// ErrQueueFull is returned by TrySubmit when the queue has no room
+var ErrQueueFull = errors.New("worker queue full")
+
+// ErrDuplicateJob is returned by Submit when deduplication is enabled and a
+// job with the same payload is already queued or in flight
+var ErrDuplicateJob = errors.New("job already pending")
+
+// Handler processes a single job payload
+type Handler func(ctx context.Context, payload string) error
+
+// KeyFunc derives the ordering key for a payload
+type KeyFunc func(ctx context.Context, payload string) (string, error)
+
+// Job is a unit of work submitted to a Pool
+type Job struct {
+	// Key groups jobs that must be processed in submission order
+	// (only used when ordering is enabled)
+	Key     string
+	Payload string
+	// Priority above 0 makes the job urgent: urgent jobs are handled
+	// before the others queued (not with ordering, which keeps per-key
+	// submission order)
+	Priority int
+	// Trace is the span of the producer, continued by the handler
+	Trace trace.SpanContext
+}
+
+// Config holds the worker pool settings
+type Config struct {
+	Workers    int
+	QueueSize  int
+	JobTimeout time.Duration
+	// Ordered enables per-key ordering: jobs with the same key are always
+	// handled by the same worker, one at a time, in submission order
+	Ordered bool
+	// KeyFunc is used to derive a key for jobs submitted without one
+	// when Ordered is set
+	KeyFunc KeyFunc
+	// Dedup drops jobs whose payload is already queued or in flight, so
+	// the same item submitted by several producers is handled once
+	Dedup bool
+	// DedupKey maps a payload to the key compared by Dedup; payloads are
+	// compared as-is when nil
+	DedupKey func(payload string) string
+}
+
+// DrainStats counts the jobs that were pending when a pool was stopped
+type DrainStats struct {
+	// Drained jobs finished before the deadline
+	Drained int
+	// Aborted jobs were cancelled in flight or discarded from the queue
+	Aborted int
+}
+
+// Pool runs jobs on a fixed number of workers fed by a bounded queue.
+// Submit blocks while the queue is full, so a burst of notifications
+// applies backpressure to the producer instead of fanning out unbounded.
+type Pool struct {
+	name     string
+	config   Config
+	handler  Handler
+	logger   *logger.Logger
+	queues   []chan Job
+	urgent   chan Job
+	next     atomic.Uint64
+	inFlight atomic.Int64
+	finished atomic.Int64
+	aborted  atomic.Int64
+	paused   atomic.Bool
+	deferred atomic.Int64
+	stats    DrainStats
+	pending  map[string]struct{}
+	pendMu   sync.Mutex
+	closing  chan struct{}
+	senders  sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
+	started  bool
+	stopped  bool
+	stopOnce sync.Once
+}
+
+// NewPool creates a new worker pool
+// The name is used for logging (e.g. "database/module")
+func NewPool(name string, config Config, handler Handler, log *logger.Logger) *Pool {
+	// Set defaults if not provided
+	if config.Workers <= 0 {
+		config.Workers = DefaultWorkers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.JobTimeout <= 0 {
+		config.JobTimeout = DefaultJobTimeout
+	}
+
+	// In ordered mode each worker owns a queue and jobs are sharded by key;
+	// otherwise all workers share a single queue, plus one for urgent jobs
+	// that they empty first
+	var queues []chan Job
+	var urgent chan Job
+	if config.Ordered {
+		perWorker := config.QueueSize / config.Workers
+		if perWorker < 1 {
+			perWorker = 1
+		}
+		queues = make([]chan Job, config.Workers)
+		for i := range queues {
+			queues[i] = make(chan Job, perWorker)
+		}
+	} else {
+		queues = []chan Job{make(chan Job, config.QueueSize)}
+		urgent = make(chan Job, config.QueueSize)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Pool{
+		name:    name,
+		config:  config,
+		handler: handler,
+		logger:  log,
+		queues:  queues,
+		urgent:  urgent,
+		pending: make(map[string]struct{}),
+		closing: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start launches the workers
+func (p *Pool) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started || p.stopped {
+		return
+	}
+	p.started = true
+
+	for i := 0; i < p.config.Workers; i++ {
+		queue := p.queues[0]
+		if p.config.Ordered {
+			queue = p.queues[i]
+		}
+		p.wg.Add(1)
+		go p.work(queue)
+	}
+}
+
+// Submit queues a job, blocking while the queue is full
+// Returns ErrPoolStopped if the pool has been stopped, ErrDuplicateJob if
+// deduplication is enabled and the payload is already pending, or the
+// context error if ctx is done before the job could be queued. A Submit
+// blocked on a full queue returns ErrPoolStopped as soon as Drain is called.
+func (p *Pool) Submit(ctx context.Context, job Job) error {
+	return p.submit(ctx, job, true)
+}
+
+// TrySubmit queues a job like Submit, but returns ErrQueueFull instead of
+// blocking while the queue is full
+func (p *Pool) TrySubmit(ctx context.Context, job Job) error {
+	return p.submit(ctx, job, false)
+}
+
+// SubmitAll submits a job per payload in order, blocking while the queue
+// is full, and returns how many were queued; payloads that are pending
+// already are skipped
+func (p *Pool) SubmitAll(ctx context.Context, payloads []string) (int, error) {
+	submitted := 0
+	for _, payload := range payloads {
+		err := p.Submit(ctx, Job{Payload: payload})
+		if errors.Is(err, ErrDuplicateJob) {
+			continue
+		}
+		if err != nil {
+			return submitted, err
+		}
+		submitted++
+	}
+	return submitted, nil
+}
+
+// submit queues a job, waiting for room in the queue if wait is set
+func (p *Pool) submit(ctx context.Context, job Job, wait bool) error {
+	// The lock only covers the stopped check: Drain must not wait for
+	// producers blocked on a full queue
+	p.mu.RLock()
+	if p.stopped {
+		p.mu.RUnlock()
+		return ErrPoolStopped
+	}
+	p.senders.Add(1)
+	p.mu.RUnlock()
+	defer p.senders.Done()
+
+	if !p.track(job.Payload) {
+		return ErrDuplicateJob
+	}
+
+	queue := p.queueFor(ctx, &job)
+
+	if !wait {
+		select {
+		case queue <- job:
+			return nil
+		default:
+			p.untrack(job.Payload)
+			return ErrQueueFull
+		}
+	}
+
+	select {
+	case queue <- job:
+		return nil
+	case <-p.closing:
+		p.untrack(job.Payload)
+		return ErrPoolStopped
+	case <-ctx.Done():
+		p.untrack(job.Payload)
+		return ctx.Err()
+	}
+}
+
+// dedupKey returns the key a payload is deduplicated by
+func (p *Pool) dedupKey(payload string) string {
+	if p.config.DedupKey != nil {
+		return p.config.DedupKey(payload)
+	}
+	return payload
+}
+
+// track records a payload as pending; returns false if deduplication is
+// enabled and the payload is pending already
+func (p *Pool) track(payload string) bool {
+	if !p.config.Dedup {
+		return true
+	}
+	key := p.dedupKey(payload)
+
+	p.pendMu.Lock()
+	defer p.pendMu.Unlock()
+
+	if _, ok := p.pending[key]; ok {
+		return false
+	}
+	p.pending[key] = struct{}{}
+	return true
+}
+
+// untrack removes a payload from the pending set
+func (p *Pool) untrack(payload string) {
+	if !p.config.Dedup {
+		return
+	}
+	key := p.dedupKey(payload)
+
+	p.pendMu.Lock()
+	defer p.pendMu.Unlock()
+
+	delete(p.pending, key)
+}
+
+// queueFor selects the queue for a job, deriving its key if needed
+// KeyFunc runs on the producer, bounded by keyTimeout; a job whose key
+// cannot be derived in time is queued without ordering
+func (p *Pool) queueFor(ctx context.Context, job *Job) chan Job {
+	if !p.config.Ordered {
+		if job.Priority > 0 {
+			return p.urgent
+		}
+		return p.queues[0]
+	}
+
+	if job.Key == "" && p.config.KeyFunc != nil {
+		keyCtx, cancel := context.WithTimeout(ctx, keyTimeout)
+		key, err := p.config.KeyFunc(keyCtx, job.Payload)
+		cancel()
+		if err != nil {
+			if p.logger != nil {
+				p.logger.LogSystemf(logger.LevelWarn, "worker", "Failed to derive ordering key on %s for payload %s: %v", p.name, job.Payload, err)
+			}
+		} else {
+			job.Key = key
+		}
+	}
+
+	// Jobs without a key have no ordering constraint
+	if job.Key == "" {
+		return p.queues[p.next.Add(1)%uint64(len(p.queues))]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(job.Key))
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
+
+// work runs jobs from a queue, and urgent jobs before them, until the
+// queues are closed
+func (p *Pool) work(queue chan Job) {
+	defer p.wg.Done()
+
+	urgent := p.urgent
+	for queue != nil || urgent != nil {
+		select {
+		case job, ok := <-urgent:
+			if !ok {
+				urgent = nil
+				continue
+			}
+			p.process(job)
+			continue
+		default:
+		}
+
+		select {
+		case job, ok := <-urgent:
+			if !ok {
+				urgent = nil
+				continue
+			}
+			p.process(job)
+		case job, ok := <-queue:
+			if !ok {
+				queue = nil
+				continue
+			}
+			p.process(job)
+		}
+	}
+}
+
+// process runs the handler for a single job
+// Once the pool has been cancelled by Drain, remaining jobs are skipped;
+// while the pool is paused they are deferred
+func (p *Pool) process(job Job) {
+	defer p.untrack(job.Payload)
+
+	if p.ctx.Err() != nil {
+		p.aborted.Add(1)
+		return
+	}
+
+	if p.paused.Load() {
+		p.deferred.Add(1)
+		if p.logger != nil {
+			p.logger.LogSystemf(logger.LevelDebug, "worker", "Deferring notification on paused %s: %s", p.name, job.Payload)
+		}
+		return
+	}
+
+	p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.config.JobTimeout)
+	defer cancel()
+	if job.Trace.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, job.Trace)
+	}
+
+	err := p.handler(ctx, job.Payload)
+
+	if p.ctx.Err() != nil {
+		p.aborted.Add(1)
+	} else {
+		p.finished.Add(1)
+	}
+
+	if err != nil {
+		if p.logger != nil {
+			p.logger.LogSystemf(logger.LevelError, "worker", "Failed to process notification on %s: %v", p.name, err)
+		}
+	}
+}
+
+// Pause defers jobs instead of handling them, until Resume. Jobs keep being
+// accepted so the producer never blocks; deferred jobs are dropped, and
+// the caller picks up their items on resume, e.g. with ProcessQueue.
+// Jobs already in flight finish.
+func (p *Pool) Pause() {
+	p.paused.Store(true)
+}
+
+// Resume handles jobs again and returns how many were deferred while the
+// pool was paused
+func (p *Pool) Resume() int {
+	p.paused.Store(false)
+	return int(p.deferred.Swap(0))
+}
+
+// Paused returns whether the pool defers jobs
+func (p *Pool) Paused() bool {
+	return p.paused.Load()
+}
+
+// QueueDepth returns the number of jobs waiting to be processed
+func (p *Pool) QueueDepth() int {
+	depth := len(p.urgent)
+	for _, queue := range p.queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// Stop stops accepting new jobs and waits for queued jobs to finish
+func (p *Pool) Stop() {
+	p.Drain(context.Background())
+}
+
+// Abort stops the pool without finishing its work: in-flight jobs are
+// cancelled and queued ones are discarded, e.g. to leave them to another
+// instance
+func (p *Pool) Abort() DrainStats {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return p.Drain(ctx)
+}
+
+// Drain stops accepting new jobs and waits for queued and in-flight jobs
+// to finish. When ctx is done first, in-flight jobs are cancelled and the
+// rest of the queue is discarded. Returns what happened to the jobs that
+// were pending when Drain was called.
+func (p *Pool) Drain(ctx context.Context) DrainStats {
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.stopped = true
+		close(p.closing)
+		p.mu.Unlock()
+
+		// Already out of time: no queued job is started anymore
+		if ctx.Err() != nil {
+			p.cancel()
+		}
+
+		// Blocked producers give up on closing; once they returned nothing
+		// sends anymore and the queues can be closed
+		p.senders.Wait()
+		for _, queue := range p.queues {
+			close(queue)
+		}
+		if p.urgent != nil {
+			close(p.urgent)
+		}
+
+		finishedBefore := p.finished.Load()
+
+		done := make(chan struct{})
+		go func() {
+			p.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if p.logger != nil {
+				p.logger.LogSystemf(logger.LevelWarn, "worker", "Drain deadline reached on %s, cancelling %d in-flight and %d queued jobs", p.name, p.inFlight.Load(), p.QueueDepth())
+			}
+			p.cancel()
+
+			timer := time.NewTimer(abortGrace)
+			select {
+			case <-done:
+			case <-timer.C:
+				if p.logger != nil {
+					p.logger.LogSystemf(logger.LevelWarn, "worker", "Abandoning %d jobs on %s that did not return after cancellation", p.inFlight.Load(), p.name)
+				}
+			}
+			timer.Stop()
+		}
+		p.cancel()
+
+		// Jobs still in flight were abandoned; jobs still queued were
+		// never picked up (no workers, or workers abandoned)
+		p.stats = DrainStats{
+			Drained: int(p.finished.Load() - finishedBefore),
+			Aborted: int(p.aborted.Load()+p.inFlight.Load()) + p.QueueDepth(),
+		}
+	})
+
+	return p.stats
+}
+
+// String returns a short description of the pool configuration
+func (p *Pool) String() string {
+	return fmt.Sprintf("%s (workers=%d, queue_size=%d, ordered=%t)", p.name, p.config.Workers, p.config.QueueSize, p.config.Ordered)
+}
@@ -0,0 +1,510 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewPool_Defaults(t *testing.T) {
+	pool := NewPool("test", Config{}, func(ctx context.Context, payload string) error { return nil }, nil)
+
+	if pool.config.Workers != DefaultWorkers {
+		t.Errorf("Expected %d workers, got %d", DefaultWorkers, pool.config.Workers)
+	}
+	if pool.config.QueueSize != DefaultQueueSize {
+		t.Errorf("Expected queue size %d, got %d", DefaultQueueSize, pool.config.QueueSize)
+	}
+	if pool.config.JobTimeout != DefaultJobTimeout {
+		t.Errorf("Expected job timeout %v, got %v", DefaultJobTimeout, pool.config.JobTimeout)
+	}
+	if len(pool.queues) != 1 {
+		t.Errorf("Expected a single shared queue, got %d", len(pool.queues))
+	}
+}
+
+func TestPool_ProcessesAllJobs(t *testing.T) {
+	var processed atomic.Int64
+	pool := NewPool("test", Config{Workers: 3, QueueSize: 5}, func(ctx context.Context, payload string) error {
+		processed.Add(1)
+		return nil
+	}, nil)
+	pool.Start()
+
+	for i := 0; i < 50; i++ {
+		if err := pool.Submit(context.Background(), Job{Payload: fmt.Sprintf("%d", i)}); err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+	}
+
+	pool.Stop()
+
+	if processed.Load() != 50 {
+		t.Errorf("Expected 50 processed jobs, got %d", processed.Load())
+	}
+}
+
+func TestPool_BoundedConcurrency(t *testing.T) {
+	var current, peak atomic.Int64
+	pool := NewPool("test", Config{Workers: 2, QueueSize: 10}, func(ctx context.Context, payload string) error {
+		n := current.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		current.Add(-1)
+		return nil
+	}, nil)
+	pool.Start()
+
+	for i := 0; i < 20; i++ {
+		pool.Submit(context.Background(), Job{Payload: "x"})
+	}
+	pool.Stop()
+
+	if peak.Load() > 2 {
+		t.Errorf("Expected at most 2 concurrent jobs, got %d", peak.Load())
+	}
+}
+
+func TestPool_SubmitBlocksWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	pool := NewPool("test", Config{Workers: 1, QueueSize: 1}, func(ctx context.Context, payload string) error {
+		<-release
+		return nil
+	}, nil)
+	pool.Start()
+	defer func() {
+		close(release)
+		pool.Stop()
+	}()
+
+	// One job in progress, one in the queue
+	pool.Submit(context.Background(), Job{Payload: "1"})
+	pool.Submit(context.Background(), Job{Payload: "2"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Retry until the worker has picked up the first job and the queue is full
+	var err error
+	for i := 0; i < 3; i++ {
+		err = pool.Submit(ctx, Job{Payload: "3"})
+		if err != nil {
+			break
+		}
+	}
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded when the queue is full, got %v", err)
+	}
+}
+
+func TestPool_TrySubmitWhenFull(t *testing.T) {
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	pool := NewPool("test", Config{Workers: 1, QueueSize: 1, Dedup: true}, func(ctx context.Context, payload string) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}, nil)
+	pool.Start()
+	defer func() {
+		close(release)
+		pool.Stop()
+	}()
+
+	// One job in progress, one in the queue
+	pool.Submit(context.Background(), Job{Payload: "1"})
+	<-started
+	pool.Submit(context.Background(), Job{Payload: "2"})
+
+	if err := pool.TrySubmit(context.Background(), Job{Payload: "3"}); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	// The rejected job is not pending, so it can be submitted later
+	release <- struct{}{}
+	if err := pool.Submit(context.Background(), Job{Payload: "3"}); err != nil {
+		t.Errorf("Expected the job to be accepted once there is room, got %v", err)
+	}
+}
+
+func TestPool_OrderedPerKey(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string][]string{}
+
+	pool := NewPool("test", Config{Workers: 4, QueueSize: 100, Ordered: true}, func(ctx context.Context, payload string) error {
+		key := strings.SplitN(payload, ":", 2)[0]
+		mu.Lock()
+		seen[key] = append(seen[key], payload)
+		mu.Unlock()
+		return nil
+	}, nil)
+	pool.Start()
+
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("user%d", i%3)
+		pool.Submit(context.Background(), Job{Key: key, Payload: fmt.Sprintf("%s:%02d", key, i)})
+	}
+	pool.Stop()
+
+	for key, payloads := range seen {
+		for i := 1; i < len(payloads); i++ {
+			if payloads[i-1] > payloads[i] {
+				t.Errorf("Jobs for key %s processed out of order: %v", key, payloads)
+				break
+			}
+		}
+	}
+}
+
+func TestPool_OrderedKeyFunc(t *testing.T) {
+	var calls atomic.Int64
+	pool := NewPool("test", Config{
+		Workers: 2,
+		Ordered: true,
+		KeyFunc: func(ctx context.Context, payload string) (string, error) {
+			calls.Add(1)
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("Expected KeyFunc to run with a deadline")
+			}
+			return "key-" + payload, nil
+		},
+	}, func(ctx context.Context, payload string) error { return nil }, nil)
+	pool.Start()
+
+	pool.Submit(context.Background(), Job{Payload: "1"})
+	pool.Submit(context.Background(), Job{Key: "given", Payload: "2"})
+	pool.Stop()
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected KeyFunc to be called once, got %d", calls.Load())
+	}
+}
+
+func TestPool_UrgentJobsFirst(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var handled []string
+	pool := NewPool("test", Config{Workers: 1, QueueSize: 10}, func(ctx context.Context, payload string) error {
+		if payload == "busy" {
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		handled = append(handled, payload)
+		mu.Unlock()
+		return nil
+	}, nil)
+	pool.Start()
+
+	// Queue behind a busy worker, the urgent job last
+	pool.Submit(context.Background(), Job{Payload: "busy"})
+	<-started
+	pool.Submit(context.Background(), Job{Payload: "1"})
+	pool.Submit(context.Background(), Job{Payload: "2"})
+	pool.Submit(context.Background(), Job{Payload: "urgent", Priority: 5})
+	close(release)
+	pool.Stop()
+
+	expected := []string{"busy", "urgent", "1", "2"}
+	if strings.Join(handled, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, handled)
+	}
+}
+
+func TestPool_SubmitAfterStop(t *testing.T) {
+	pool := NewPool("test", Config{}, func(ctx context.Context, payload string) error { return nil }, nil)
+	pool.Start()
+	pool.Stop()
+
+	if err := pool.Submit(context.Background(), Job{Payload: "1"}); err != ErrPoolStopped {
+		t.Errorf("Expected ErrPoolStopped, got %v", err)
+	}
+
+	// Stop must be idempotent
+	pool.Stop()
+}
+
+func TestPool_PauseDefersJobs(t *testing.T) {
+	var processed atomic.Int64
+	pool := NewPool("test", Config{Workers: 2, QueueSize: 2}, func(ctx context.Context, payload string) error {
+		processed.Add(1)
+		return nil
+	}, nil)
+	pool.Start()
+	defer pool.Stop()
+
+	pool.Pause()
+	if !pool.Paused() {
+		t.Fatal("Expected the pool to be paused")
+	}
+
+	// More jobs than the queue holds: a paused pool must not block Submit
+	for i := 0; i < 5; i++ {
+		if err := pool.Submit(context.Background(), Job{Payload: fmt.Sprintf("%d", i)}); err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pool.deferred.Load() < 5 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if processed.Load() != 0 {
+		t.Errorf("Expected no jobs handled while paused, got %d", processed.Load())
+	}
+
+	if deferred := pool.Resume(); deferred != 5 {
+		t.Errorf("Expected 5 deferred jobs, got %d", deferred)
+	}
+
+	pool.Submit(context.Background(), Job{Payload: "after"})
+	pool.Stop()
+	if processed.Load() != 1 {
+		t.Errorf("Expected the job submitted after Resume to be handled, got %d", processed.Load())
+	}
+}
+
+func TestPool_JobTimeout(t *testing.T) {
+	result := make(chan error, 1)
+	pool := NewPool("test", Config{Workers: 1, JobTimeout: 10 * time.Millisecond}, func(ctx context.Context, payload string) error {
+		<-ctx.Done()
+		result <- ctx.Err()
+		return ctx.Err()
+	}, nil)
+	pool.Start()
+
+	pool.Submit(context.Background(), Job{Payload: "1"})
+	pool.Stop()
+
+	if err := <-result; err != context.DeadlineExceeded {
+		t.Errorf("Expected job context to time out, got %v", err)
+	}
+}
+
+func TestPool_DrainFinishesPendingJobs(t *testing.T) {
+	var processed atomic.Int64
+	pool := NewPool("test", Config{Workers: 2, QueueSize: 20}, func(ctx context.Context, payload string) error {
+		time.Sleep(5 * time.Millisecond)
+		processed.Add(1)
+		return nil
+	}, nil)
+	pool.Start()
+
+	for i := 0; i < 10; i++ {
+		pool.Submit(context.Background(), Job{Payload: fmt.Sprintf("%d", i)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stats := pool.Drain(ctx)
+
+	if processed.Load() != 10 {
+		t.Errorf("Expected 10 jobs processed, got %d", processed.Load())
+	}
+	if stats.Drained == 0 || stats.Aborted != 0 {
+		t.Errorf("Expected pending jobs to be drained and none aborted, got %+v", stats)
+	}
+}
+
+func TestPool_DrainDeadlineAbortsJobs(t *testing.T) {
+	started := make(chan struct{}, 1)
+	var cancelled atomic.Int64
+	pool := NewPool("test", Config{Workers: 1, QueueSize: 10, JobTimeout: time.Minute}, func(ctx context.Context, payload string) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		cancelled.Add(1)
+		return ctx.Err()
+	}, nil)
+	pool.Start()
+
+	for i := 0; i < 5; i++ {
+		pool.Submit(context.Background(), Job{Payload: fmt.Sprintf("%d", i)})
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	stats := pool.Drain(ctx)
+
+	if cancelled.Load() != 1 {
+		t.Errorf("Expected the in-flight job to be cancelled, got %d", cancelled.Load())
+	}
+	if stats.Drained != 0 || stats.Aborted != 5 {
+		t.Errorf("Expected 0 drained and 5 aborted, got %+v", stats)
+	}
+
+	// Later calls return the same result
+	if again := pool.Drain(context.Background()); again != stats {
+		t.Errorf("Expected repeated Drain to return %+v, got %+v", stats, again)
+	}
+}
+
+func TestPool_Abort(t *testing.T) {
+	started := make(chan struct{}, 1)
+	var handled atomic.Int64
+	pool := NewPool("test", Config{Workers: 1, QueueSize: 10, JobTimeout: time.Minute}, func(ctx context.Context, payload string) error {
+		handled.Add(1)
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil)
+	pool.Start()
+
+	for i := 0; i < 5; i++ {
+		pool.Submit(context.Background(), Job{Payload: fmt.Sprintf("%d", i)})
+	}
+	<-started
+
+	stats := pool.Abort()
+
+	if handled.Load() != 1 {
+		t.Errorf("Expected no queued job to be started, got %d handled", handled.Load())
+	}
+	if stats.Drained != 0 || stats.Aborted != 5 {
+		t.Errorf("Expected 0 drained and 5 aborted, got %+v", stats)
+	}
+}
+
+func TestPool_DrainUnblocksSubmit(t *testing.T) {
+	started := make(chan struct{}, 1)
+	pool := NewPool("test", Config{Workers: 1, QueueSize: 1, JobTimeout: time.Minute}, func(ctx context.Context, payload string) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil)
+	pool.Start()
+
+	// One job in flight, one queued, one producer blocked on the full queue
+	pool.Submit(context.Background(), Job{Payload: "1"})
+	<-started
+	pool.Submit(context.Background(), Job{Payload: "2"})
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- pool.Submit(context.Background(), Job{Payload: "3"})
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	begin := time.Now()
+	stats := pool.Drain(ctx)
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("Expected Drain to keep its deadline, took %s", elapsed)
+	}
+	if stats.Aborted != 2 {
+		t.Errorf("Expected 2 aborted jobs, got %+v", stats)
+	}
+
+	select {
+	case err := <-blocked:
+		if err != ErrPoolStopped {
+			t.Errorf("Expected the blocked Submit to return ErrPoolStopped, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the blocked Submit to return on Drain")
+	}
+}
+
+func TestPool_Dedup(t *testing.T) {
+	release := make(chan struct{})
+	var processed atomic.Int64
+	pool := NewPool("test", Config{Workers: 1, QueueSize: 10, Dedup: true}, func(ctx context.Context, payload string) error {
+		<-release
+		processed.Add(1)
+		return nil
+	}, nil)
+	pool.Start()
+
+	if err := pool.Submit(context.Background(), Job{Payload: "1"}); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if err := pool.Submit(context.Background(), Job{Payload: "1"}); err != ErrDuplicateJob {
+		t.Errorf("Expected ErrDuplicateJob for a pending payload, got %v", err)
+	}
+	if err := pool.Submit(context.Background(), Job{Payload: "2"}); err != nil {
+		t.Errorf("Expected a different payload to be accepted, got %v", err)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for processed.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Once processed, the payload can be submitted again
+	if err := pool.Submit(context.Background(), Job{Payload: "1"}); err != nil {
+		t.Errorf("Expected payload to be accepted after processing, got %v", err)
+	}
+	pool.Stop()
+
+	if processed.Load() != 3 {
+		t.Errorf("Expected 3 jobs processed, got %d", processed.Load())
+	}
+}
+
+func TestPool_DedupKey(t *testing.T) {
+	release := make(chan struct{})
+	pool := NewPool("test", Config{
+		Workers:   1,
+		QueueSize: 10,
+		Dedup:     true,
+		DedupKey:  func(payload string) string { return strings.TrimSpace(payload) },
+	}, func(ctx context.Context, payload string) error {
+		<-release
+		return nil
+	}, nil)
+	pool.Start()
+	defer pool.Stop()
+	defer close(release)
+
+	if err := pool.Submit(context.Background(), Job{Payload: "1"}); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if err := pool.Submit(context.Background(), Job{Payload: " 1 "}); err != ErrDuplicateJob {
+		t.Errorf("Expected ErrDuplicateJob for a payload with the same key, got %v", err)
+	}
+}
+
+func TestPool_ContinuesTrace(t *testing.T) {
+	producer := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	got := make(chan trace.SpanContext, 1)
+	pool := NewPool("test", Config{Workers: 1}, func(ctx context.Context, payload string) error {
+		got <- trace.SpanContextFromContext(ctx)
+		return nil
+	}, nil)
+	pool.Start()
+	defer pool.Stop()
+
+	if err := pool.Submit(context.Background(), Job{Payload: "1", Trace: producer}); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	select {
+	case sc := <-got:
+		if !sc.Equal(producer) {
+			t.Errorf("Expected handler to continue the producer's trace, got %v", sc)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for job")
+	}
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"pgbridge/internal/logger"
+)
+
+// PendingFunc returns the payloads of items that were not processed and
+// are older than the grace period
+type PendingFunc func(ctx context.Context, olderThan time.Duration) ([]string, error)
+
+// Sweeper periodically looks for items that were missed by the live
+// notification path and submits them to a pool. Combined with Config.Dedup
+// an item is never handled twice at the same time, whichever path
+// submits it first.
+type Sweeper struct {
+	name     string
+	pool     *Pool
+	pending  PendingFunc
+	interval time.Duration
+	grace    time.Duration
+	logger   *logger.Logger
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewSweeper creates a sweeper that runs every interval and picks up
+// items older than grace
+func NewSweeper(name string, pool *Pool, pending PendingFunc, interval, grace time.Duration, log *logger.Logger) *Sweeper {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Sweeper{
+		name:     name,
+		pool:     pool,
+		pending:  pending,
+		interval: interval,
+		grace:    grace,
+		logger:   log,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start begins sweeping periodically
+func (s *Sweeper) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// run sweeps on every tick until stopped
+func (s *Sweeper) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			submitted, err := s.Sweep(s.ctx)
+			if err != nil {
+				if s.ctx.Err() != nil {
+					return
+				}
+				if s.logger != nil {
+					s.logger.LogSystemf(logger.LevelWarn, "worker", "Queue sweep on %s failed: %v", s.name, err)
+				}
+				continue
+			}
+			if submitted > 0 && s.logger != nil {
+				s.logger.LogSystemf(logger.LevelInfo, "worker", "Queue sweep on %s picked up %d missed items", s.name, submitted)
+			}
+		}
+	}
+}
+
+// Sweep runs a single pass and returns the number of items submitted
+// Items already queued or in flight in the pool are skipped, and nothing
+// is swept while the pool is paused.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	if s.pool.Paused() {
+		return 0, nil
+	}
+
+	payloads, err := s.pending(ctx, s.grace)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.pool.SubmitAll(ctx, payloads)
+}
+
+// Stop stops sweeping and waits for a running pass to finish
+func (s *Sweeper) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		s.wg.Wait()
+	})
+}
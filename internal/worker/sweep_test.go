@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSweeper_SkipsPendingItems(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var handled []string
+	pool := NewPool("test", Config{Workers: 1, QueueSize: 10, Dedup: true}, func(ctx context.Context, payload string) error {
+		<-release
+		mu.Lock()
+		handled = append(handled, payload)
+		mu.Unlock()
+		return nil
+	}, nil)
+	pool.Start()
+
+	// "1" arrives through the live path first
+	pool.Submit(context.Background(), Job{Payload: "1"})
+
+	var grace time.Duration
+	sweeper := NewSweeper("test", pool, func(ctx context.Context, olderThan time.Duration) ([]string, error) {
+		grace = olderThan
+		return []string{"1", "2", "3"}, nil
+	}, time.Hour, 30*time.Second, nil)
+
+	submitted, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if submitted != 2 {
+		t.Errorf("Expected 2 items submitted, got %d", submitted)
+	}
+	if grace != 30*time.Second {
+		t.Errorf("Expected grace period to be passed, got %v", grace)
+	}
+
+	close(release)
+	pool.Stop()
+
+	if len(handled) != 3 {
+		t.Errorf("Expected each item handled once, got %v", handled)
+	}
+}
+
+func TestSweeper_RunsPeriodically(t *testing.T) {
+	var sweeps atomic.Int64
+	pool := NewPool("test", Config{Dedup: true}, func(ctx context.Context, payload string) error { return nil }, nil)
+	pool.Start()
+	defer pool.Stop()
+
+	sweeper := NewSweeper("test", pool, func(ctx context.Context, olderThan time.Duration) ([]string, error) {
+		sweeps.Add(1)
+		return nil, errors.New("database unavailable")
+	}, 10*time.Millisecond, 0, nil)
+	sweeper.Start()
+
+	time.Sleep(55 * time.Millisecond)
+	sweeper.Stop()
+	count := sweeps.Load()
+
+	if count < 2 {
+		t.Errorf("Expected several sweeps despite errors, got %d", count)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if sweeps.Load() != count {
+		t.Error("Expected no sweeps after Stop")
+	}
+}
+
+func TestSweeper_SkipsPausedPool(t *testing.T) {
+	pool := NewPool("test", Config{Dedup: true}, func(ctx context.Context, payload string) error { return nil }, nil)
+	pool.Start()
+	defer pool.Stop()
+	pool.Pause()
+
+	called := false
+	sweeper := NewSweeper("test", pool, func(ctx context.Context, olderThan time.Duration) ([]string, error) {
+		called = true
+		return []string{"1"}, nil
+	}, time.Hour, 0, nil)
+
+	submitted, err := sweeper.Sweep(context.Background())
+	if err != nil || submitted != 0 || called {
+		t.Errorf("Expected no sweep while paused, got %d submitted, called %t, %v", submitted, called, err)
+	}
+}
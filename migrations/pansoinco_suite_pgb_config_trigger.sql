@@ -0,0 +1,41 @@
+-- Triggers for live reconfiguration of pgbridge
+-- These triggers send a notification when the pgbridge configuration changes
+-- pgbridge (--db-config mode) listens to this notification and reloads its configuration
+-- pgbridge installs them itself when its role owns the tables; otherwise run this as the owner
+
+-- Create the trigger function (in public schema)
+CREATE OR REPLACE FUNCTION public.trg_pgb_config_notify()
+RETURNS TRIGGER AS $$
+BEGIN
+    -- Send NOTIFY with the operation and table, e.g. 'UPDATE sw_pgb'
+    PERFORM pg_notify('pgb_config', TG_OP || ' ' || TG_TABLE_NAME);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Drop existing triggers if they exist
+DROP TRIGGER IF EXISTS S01_pgb_config_notify ON public.sw_pgb;
+DROP TRIGGER IF EXISTS S02_pgb_config_notify ON public.sw_instance;
+
+-- Any change to sw_pgb can enable, disable or reconfigure services
+CREATE TRIGGER S01_pgb_config_notify
+AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON public.sw_pgb
+FOR EACH STATEMENT
+EXECUTE FUNCTION public.trg_pgb_config_notify();
+
+-- Updating or deleting an instance changes the name or connection string of its database
+CREATE TRIGGER S02_pgb_config_notify
+AFTER UPDATE OR DELETE ON public.sw_instance
+FOR EACH STATEMENT
+EXECUTE FUNCTION public.trg_pgb_config_notify();
+
+-- Verify the triggers were created
+SELECT
+    tgname as trigger_name,
+    relname as table_name,
+    proname as function_name,
+    tgenabled as enabled
+FROM pg_trigger t
+JOIN pg_class c ON t.tgrelid = c.oid
+JOIN pg_proc p ON t.tgfoid = p.oid
+WHERE tgname IN ('s01_pgb_config_notify', 's02_pgb_config_notify');
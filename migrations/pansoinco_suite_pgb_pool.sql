@@ -0,0 +1,15 @@
+-- Connection pool settings per database for pgbridge (--db-config mode)
+-- The column holds options like the pool(...) entry of the configuration file, e.g.
+--   'max_conns=20; min_conns=2; max_conn_lifetime=1h; statement_timeout=30s; application_name=pgbridge'
+-- NULL keeps the defaults; pgbridge works without the column
+
+ALTER TABLE public.sw_pgb ADD COLUMN IF NOT EXISTS pgb_pool character varying;
+
+COMMENT ON COLUMN public.sw_pgb.pgb_pool IS 'pgbridge connection pool settings, e.g. max_conns=20; statement_timeout=30s';
+
+-- Verify the column was added
+SELECT
+    column_name,
+    data_type
+FROM information_schema.columns
+WHERE table_name = 'sw_pgb' AND column_name = 'pgb_pool';